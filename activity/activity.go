@@ -143,6 +143,22 @@ func GetTrendingActivities(w http.ResponseWriter, r *http.Request, _ httprouter.
 	log.Println("Fetched trending activities:", activities)
 }
 
+// Record logs an activity raised by the server itself, such as a check-in,
+// and publishes it like activities sent by clients
+func Record(a structs.Activity) {
+	if a.Timestamp.IsZero() {
+		a.Timestamp = time.Now()
+	}
+	if _, err := db.ActivitiesCollection.InsertOne(context.TODO(), a); err != nil {
+		log.Println("Failed to insert activity into database:", err)
+		return
+	}
+	activityJSON, _ := json.Marshal(a)
+	if err := redisClient.Publish(context.TODO(), "activity_events", activityJSON).Err(); err != nil {
+		log.Println("Failed to publish activity to Redis:", err)
+	}
+}
+
 // Utility function for sending error responses
 func SendErrorResponse(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,197 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/middleware"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Hit types recorded against an event
+const (
+	HitView     = "view"
+	HitCheckout = "checkout"
+	HitPurchase = "purchase"
+)
+
+// Hit is one tracked interaction with an event page or its tickets
+type Hit struct {
+	EventID   string    `json:"eventid" bson:"eventid"`
+	Type      string    `json:"type" bson:"type"`
+	VisitorID string    `json:"visitorid" bson:"visitorid"`
+	UserID    string    `json:"userid,omitempty" bson:"userid,omitempty"`
+	Source    string    `json:"source" bson:"source"`
+	TicketID  string    `json:"ticketid,omitempty" bson:"ticketid,omitempty"`
+	Quantity  int       `json:"quantity,omitempty" bson:"quantity,omitempty"`
+	Revenue   float64   `json:"revenue,omitempty" bson:"revenue,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// sourceCookie remembers where a visitor first came from, so purchases made
+// later through the API are credited to the landing source rather than to
+// the frontend that calls the API
+const (
+	sourceCookie = "naevis_src"
+	// How long a landing source is credited with later purchases
+	attributionWindow = 30 * 24 * time.Hour
+)
+
+// TrackView records an event page view. The first view that arrives from
+// somewhere also remembers that source for the visitor's later purchases.
+func TrackView(w http.ResponseWriter, r *http.Request, eventID string) {
+	hit := Hit{EventID: eventID, Type: HitView, Source: trafficSource(r)}
+	if _, err := r.Cookie(sourceCookie); err != nil {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sourceCookie,
+			Value:    url.QueryEscape(hit.Source),
+			Path:     "/",
+			MaxAge:   int(attributionWindow.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	record(r, hit)
+}
+
+// TrackCheckout records the start of a payment session, credited to the
+// visitor's landing source
+func TrackCheckout(r *http.Request, eventID, ticketID string, quantity int) {
+	record(r, Hit{EventID: eventID, Type: HitCheckout, TicketID: ticketID, Quantity: quantity})
+}
+
+// TrackPurchase records a completed ticket purchase, credited to the
+// visitor's landing source
+func TrackPurchase(r *http.Request, eventID, ticketID string, quantity int, revenue float64) {
+	record(r, Hit{EventID: eventID, Type: HitPurchase, TicketID: ticketID, Quantity: quantity, Revenue: revenue})
+}
+
+// record fills in who and where from the request and stores the hit in the
+// background so tracking never slows down or fails the tracked request.
+// Hits without a source take the visitor's landing source.
+func record(r *http.Request, hit Hit) {
+	hit.UserID = requestUserID(r)
+	hit.VisitorID = visitorID(r, hit.UserID)
+	hit.CreatedAt = time.Now().UTC()
+	landing := ""
+	if c, err := r.Cookie(sourceCookie); err == nil {
+		landing, _ = url.QueryUnescape(c.Value)
+	}
+	anonymous := visitorID(r, "")
+
+	go func() {
+		if hit.Source == "" {
+			hit.Source = landingSource(hit, landing, anonymous)
+		}
+		if _, err := db.EventAnalyticsCollection.InsertOne(context.TODO(), hit); err != nil {
+			log.Printf("Error recording %s hit for event %s: %v", hit.Type, hit.EventID, err)
+		}
+	}()
+}
+
+// landingSource is where the visitor came from when they first viewed the
+// event: the source cookie if the frontend sends it, else their earliest
+// recent view, as the signed-in user or from the same anonymous device
+func landingSource(hit Hit, cookie, anonymous string) string {
+	if cookie != "" {
+		return cookie
+	}
+	visitors := bson.A{anonymous}
+	if hit.UserID != "" {
+		visitors = append(visitors, hit.VisitorID)
+	}
+	var first Hit
+	err := db.EventAnalyticsCollection.FindOne(context.TODO(), bson.M{
+		"eventid":    hit.EventID,
+		"type":       HitView,
+		"visitorid":  bson.M{"$in": visitors},
+		"created_at": bson.M{"$gte": hit.CreatedAt.Add(-attributionWindow)},
+	}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&first)
+	if err != nil || first.Source == "" {
+		return "direct"
+	}
+	return first.Source
+}
+
+func requestUserID(r *http.Request) string {
+	if claims, err := middleware.ValidateJWT(r.Header.Get("Authorization")); err == nil {
+		return claims.UserID
+	}
+	return ""
+}
+
+// visitorID identifies signed-in users by ID and anonymous visitors by a hash
+// of their address and user agent, so raw IPs are never stored
+func visitorID(r *http.Request, userID string) string {
+	if userID != "" {
+		return "u:" + userID
+	}
+	ip := r.Header.Get("X-Forwarded-For")
+	if i := strings.IndexByte(ip, ','); i >= 0 {
+		ip = ip[:i]
+	}
+	if ip == "" {
+		ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(ip) + "|" + r.UserAgent()))
+	return "a:" + hex.EncodeToString(sum[:8])
+}
+
+// trafficSource prefers an explicit utm_source or ref parameter, on the
+// request or on the frontend page it came from, then the referring host, and
+// falls back to "direct". Our own frontend is not a source.
+func trafficSource(r *http.Request) string {
+	ref, _ := url.Parse(r.Referer())
+	queries := []url.Values{r.URL.Query()}
+	if ref != nil {
+		queries = append(queries, ref.Query())
+	}
+	for _, q := range queries {
+		for _, key := range []string{"utm_source", "ref"} {
+			if v := strings.TrimSpace(q.Get(key)); v != "" {
+				return strings.ToLower(v)
+			}
+		}
+	}
+	if ref != nil && ref.Host != "" && !ownHost(r, ref.Hostname()) {
+		return strings.TrimPrefix(strings.ToLower(ref.Hostname()), "www.")
+	}
+	return "direct"
+}
+
+// ownHost reports whether host is this API or the frontend it serves
+func ownHost(r *http.Request, host string) bool {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(r.Host); err == nil && strings.ToLower(h) == host {
+		return true
+	}
+	if strings.ToLower(r.Host) == host {
+		return true
+	}
+	if u, err := url.Parse(globals.FrontendURL()); err == nil && u.Host != "" {
+		return strings.ToLower(u.Hostname()) == host
+	}
+	return false
+}
+
+// EnsureIndexes creates the indexes the dashboard aggregations rely on
+func EnsureIndexes() {
+	_, err := db.EventAnalyticsCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "eventid", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating analytics indexes: %v", err)
+	}
+}
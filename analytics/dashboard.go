@@ -0,0 +1,317 @@
+package analytics
+
+import (
+	"context"
+	"naevis/db"
+	"naevis/structs"
+	"naevis/utils"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var validIntervals = map[string]bool{"hour": true, "day": true, "week": true, "month": true}
+
+// Totals summarises one hit type over the requested range
+type Totals struct {
+	Views          int     `json:"views"`
+	UniqueVisitors int     `json:"unique_visitors"`
+	CheckoutStarts int     `json:"checkout_starts"`
+	Purchases      int     `json:"purchases"`
+	TicketsSold    int     `json:"tickets_sold"`
+	Revenue        float64 `json:"revenue"`
+}
+
+// FunnelStep is one stage of the view → checkout → purchase funnel
+type FunnelStep struct {
+	Step     string  `json:"step"`
+	Count    int     `json:"count"`
+	Visitors int     `json:"visitors"`
+	Rate     float64 `json:"rate"` // share of the previous step's visitors
+}
+
+// ViewBucket is page traffic for one time bucket
+type ViewBucket struct {
+	Bucket         time.Time `json:"bucket" bson:"bucket"`
+	Views          int       `json:"views" bson:"views"`
+	UniqueVisitors int       `json:"unique_visitors" bson:"unique_visitors"`
+}
+
+// SalesBucket is sales of one ticket type in one time bucket
+type SalesBucket struct {
+	Bucket     time.Time `json:"bucket" bson:"bucket"`
+	TicketID   string    `json:"ticketid" bson:"ticketid"`
+	TicketName string    `json:"ticket_name" bson:"-"`
+	Orders     int       `json:"orders" bson:"orders"`
+	Quantity   int       `json:"quantity" bson:"quantity"`
+	Revenue    float64   `json:"revenue" bson:"revenue"`
+}
+
+// SourceStats is traffic and conversions attributed to one source
+type SourceStats struct {
+	Source         string `json:"source"`
+	Views          int    `json:"views"`
+	UniqueVisitors int    `json:"unique_visitors"`
+	Purchases      int    `json:"purchases"`
+}
+
+// Dashboard is the organizer's analytics view of an event
+type Dashboard struct {
+	EventID       string        `json:"eventid"`
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	Interval      string        `json:"interval"`
+	TimeZone      string        `json:"tz"`
+	Totals        Totals        `json:"totals"`
+	Funnel        []FunnelStep  `json:"funnel"`
+	ViewsOverTime []ViewBucket  `json:"views_over_time"`
+	SalesOverTime []SalesBucket `json:"sales_over_time"`
+	Sources       []SourceStats `json:"sources"`
+}
+
+type typeTotal struct {
+	Type     string  `bson:"_id"`
+	Count    int     `bson:"count"`
+	Visitors int     `bson:"visitors"`
+	Quantity int     `bson:"quantity"`
+	Revenue  float64 `bson:"revenue"`
+}
+
+type sourceRow struct {
+	ID struct {
+		Source string `bson:"source"`
+		Type   string `bson:"type"`
+	} `bson:"_id"`
+	Count    int `bson:"count"`
+	Visitors int `bson:"visitors"`
+}
+
+func parseDashboardTime(s string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// GetEventAnalytics returns views, unique visitors, the purchase funnel, sales
+// per ticket type over time and traffic sources for an event.
+// Query: from, to (RFC3339 or YYYY-MM-DD; default last 30 days),
+// interval (hour|day|week|month; default day), tz (IANA zone; default UTC).
+func GetEventAnalytics(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	q := r.URL.Query()
+
+	tz := q.Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		http.Error(w, "Invalid tz", http.StatusBadRequest)
+		return
+	}
+
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if !validIntervals[interval] {
+		http.Error(w, "interval must be hour, day, week or month", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -30)
+	if v := q.Get("from"); v != "" {
+		t, ok := parseDashboardTime(v, loc)
+		if !ok {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t.UTC()
+	}
+	if v := q.Get("to"); v != "" {
+		t, ok := parseDashboardTime(v, loc)
+		if !ok {
+			http.Error(w, "Invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t.UTC()
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+	if interval == "hour" && to.Sub(from) > 31*24*time.Hour {
+		http.Error(w, "Hourly buckets are limited to 31 days", http.StatusBadRequest)
+		return
+	}
+
+	// $dateTrunc needs MongoDB 5.0 or later
+	bucket := bson.M{"$dateTrunc": bson.M{"date": "$created_at", "unit": interval, "timezone": tz}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"eventid": eventID, "created_at": bson.M{"$gte": from, "$lt": to}}}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":      bson.M{"type": "$type", "visitor": "$visitorid"},
+					"count":    bson.M{"$sum": 1},
+					"quantity": bson.M{"$sum": "$quantity"},
+					"revenue":  bson.M{"$sum": "$revenue"},
+				}},
+				bson.M{"$group": bson.M{
+					"_id":      "$_id.type",
+					"count":    bson.M{"$sum": "$count"},
+					"visitors": bson.M{"$sum": 1},
+					"quantity": bson.M{"$sum": "$quantity"},
+					"revenue":  bson.M{"$sum": "$revenue"},
+				}},
+			},
+			"views": bson.A{
+				bson.M{"$match": bson.M{"type": HitView}},
+				bson.M{"$group": bson.M{"_id": bson.M{"bucket": bucket, "visitor": "$visitorid"}, "count": bson.M{"$sum": 1}}},
+				bson.M{"$group": bson.M{"_id": "$_id.bucket", "views": bson.M{"$sum": "$count"}, "unique_visitors": bson.M{"$sum": 1}}},
+				bson.M{"$project": bson.M{"_id": 0, "bucket": "$_id", "views": 1, "unique_visitors": 1}},
+				bson.M{"$sort": bson.M{"bucket": 1}},
+			},
+			"sales": bson.A{
+				bson.M{"$match": bson.M{"type": HitPurchase}},
+				bson.M{"$group": bson.M{
+					"_id":      bson.M{"bucket": bucket, "ticketid": "$ticketid"},
+					"orders":   bson.M{"$sum": 1},
+					"quantity": bson.M{"$sum": "$quantity"},
+					"revenue":  bson.M{"$sum": "$revenue"},
+				}},
+				bson.M{"$project": bson.M{"_id": 0, "bucket": "$_id.bucket", "ticketid": "$_id.ticketid", "orders": 1, "quantity": 1, "revenue": 1}},
+				bson.M{"$sort": bson.D{{Key: "bucket", Value: 1}, {Key: "ticketid", Value: 1}}},
+			},
+			"sources": bson.A{
+				bson.M{"$group": bson.M{"_id": bson.M{"source": "$source", "type": "$type", "visitor": "$visitorid"}, "count": bson.M{"$sum": 1}}},
+				bson.M{"$group": bson.M{
+					"_id":      bson.M{"source": "$_id.source", "type": "$_id.type"},
+					"count":    bson.M{"$sum": "$count"},
+					"visitors": bson.M{"$sum": 1},
+				}},
+			},
+		}}},
+	}
+
+	cursor, err := db.EventAnalyticsCollection.Aggregate(context.TODO(), pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		http.Error(w, "Failed to aggregate analytics", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var facets []struct {
+		Totals  []typeTotal   `bson:"totals"`
+		Views   []ViewBucket  `bson:"views"`
+		Sales   []SalesBucket `bson:"sales"`
+		Sources []sourceRow   `bson:"sources"`
+	}
+	if err := cursor.All(context.TODO(), &facets); err != nil || len(facets) == 0 {
+		http.Error(w, "Failed to decode analytics", http.StatusInternalServerError)
+		return
+	}
+	f := facets[0]
+
+	dash := Dashboard{
+		EventID:       eventID,
+		From:          from,
+		To:            to,
+		Interval:      interval,
+		TimeZone:      tz,
+		ViewsOverTime: f.Views,
+		SalesOverTime: f.Sales,
+	}
+	if dash.ViewsOverTime == nil {
+		dash.ViewsOverTime = []ViewBucket{}
+	}
+	if dash.SalesOverTime == nil {
+		dash.SalesOverTime = []SalesBucket{}
+	}
+
+	byType := map[string]typeTotal{}
+	for _, t := range f.Totals {
+		byType[t.Type] = t
+	}
+	views, checkouts, purchases := byType[HitView], byType[HitCheckout], byType[HitPurchase]
+	dash.Totals = Totals{
+		Views:          views.Count,
+		UniqueVisitors: views.Visitors,
+		CheckoutStarts: checkouts.Count,
+		Purchases:      purchases.Count,
+		TicketsSold:    purchases.Quantity,
+		Revenue:        purchases.Revenue,
+	}
+	dash.Funnel = []FunnelStep{
+		{Step: HitView, Count: views.Count, Visitors: views.Visitors, Rate: 1},
+		{Step: HitCheckout, Count: checkouts.Count, Visitors: checkouts.Visitors, Rate: ratio(checkouts.Visitors, views.Visitors)},
+		{Step: HitPurchase, Count: purchases.Count, Visitors: purchases.Visitors, Rate: ratio(purchases.Visitors, checkouts.Visitors)},
+	}
+
+	names := ticketNames(eventID)
+	for i := range dash.SalesOverTime {
+		dash.SalesOverTime[i].TicketName = names[dash.SalesOverTime[i].TicketID]
+	}
+
+	sources := map[string]*SourceStats{}
+	for _, row := range f.Sources {
+		s, ok := sources[row.ID.Source]
+		if !ok {
+			s = &SourceStats{Source: row.ID.Source}
+			sources[row.ID.Source] = s
+		}
+		switch row.ID.Type {
+		case HitView:
+			s.Views, s.UniqueVisitors = row.Count, row.Visitors
+		case HitPurchase:
+			s.Purchases = row.Count
+		}
+	}
+	dash.Sources = make([]SourceStats, 0, len(sources))
+	for _, s := range sources {
+		dash.Sources = append(dash.Sources, *s)
+	}
+	sort.Slice(dash.Sources, func(i, j int) bool {
+		if dash.Sources[i].Views != dash.Sources[j].Views {
+			return dash.Sources[i].Views > dash.Sources[j].Views
+		}
+		return dash.Sources[i].Source < dash.Sources[j].Source
+	})
+
+	utils.SendJSONResponse(w, http.StatusOK, dash)
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+func ticketNames(eventID string) map[string]string {
+	names := map[string]string{}
+	cursor, err := db.TicketsCollection.Find(context.TODO(), bson.M{"eventid": eventID},
+		options.Find().SetProjection(bson.M{"ticketid": 1, "name": 1}))
+	if err != nil {
+		return names
+	}
+	var tickets []structs.Ticket
+	if err := cursor.All(context.TODO(), &tickets); err != nil {
+		return names
+	}
+	for _, t := range tickets {
+		names[t.TicketID] = t.Name
+	}
+	return names
+}
@@ -0,0 +1,85 @@
+package artists
+
+import (
+	"context"
+	"naevis/db"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ArtistSession is a timetable slot the artist plays, with its event title
+type ArtistSession struct {
+	structs.Session `bson:",inline"`
+	EventTitle      string `json:"eventtitle"`
+	StageName       string `json:"stagename"`
+}
+
+// GetArtistSessions returns the artist's upcoming sessions across all events
+func GetArtistSessions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	artistID := ps.ByName("id")
+
+	cursor, err := db.SessionsCollection.Find(context.TODO(),
+		bson.M{"artists": artistID, "end": bson.M{"$gte": time.Now().UTC()}},
+		options.Find().SetSort(bson.D{{Key: "start", Value: 1}}).SetLimit(100))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var sessions []structs.Session
+	if err := cursor.All(context.TODO(), &sessions); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to parse sessions")
+		return
+	}
+
+	eventIDs := []string{}
+	stageIDs := []string{}
+	for _, s := range sessions {
+		eventIDs = append(eventIDs, s.EventID)
+		stageIDs = append(stageIDs, s.StageID)
+	}
+
+	// Sessions of unpublished events stay off the artist's page
+	titles := map[string]string{}
+	if len(eventIDs) > 0 {
+		var evs []structs.Event
+		cur, err := db.EventsCollection.Find(context.TODO(), trash.Live(bson.M{
+			"eventid": bson.M{"$in": eventIDs},
+			"status":  bson.M{"$nin": []string{structs.EventStatusDraft, structs.EventStatusScheduled}},
+		}), options.Find().SetProjection(bson.M{"eventid": 1, "title": 1}))
+		if err == nil && cur.All(context.TODO(), &evs) == nil {
+			for _, e := range evs {
+				titles[e.EventID] = e.Title
+			}
+		}
+	}
+	stageNames := map[string]string{}
+	if len(stageIDs) > 0 {
+		var stages []structs.Stage
+		cur, err := db.StagesCollection.Find(context.TODO(), bson.M{"stageid": bson.M{"$in": stageIDs}})
+		if err == nil && cur.All(context.TODO(), &stages) == nil {
+			for _, st := range stages {
+				stageNames[st.StageID] = st.Name
+			}
+		}
+	}
+
+	result := []ArtistSession{}
+	for _, s := range sessions {
+		title, ok := titles[s.EventID]
+		if !ok {
+			continue
+		}
+		result = append(result, ArtistSession{Session: s, EventTitle: title, StageName: stageNames[s.StageID]})
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, result)
+}
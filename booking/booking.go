@@ -4,23 +4,76 @@ import (
 	"context"
 	"encoding/json"
 	"naevis/db"
+	"naevis/globals"
+	"naevis/utils"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// Slot is a bookable time. Slots made through AddSlot are global; slots
+// generated from a SlotTemplate belong to a place's Resource.
 type Slot struct {
-	Date     string `json:"date" bson:"date"` // e.g., "2025-05-01"
-	Time     string `json:"time" bson:"time"` // e.g., "18:00"
-	Capacity int    `json:"capacity" bson:"capacity"`
+	SlotID     string    `json:"slotid,omitempty" bson:"slotid,omitempty"`
+	PlaceID    string    `json:"placeid,omitempty" bson:"placeid,omitempty"`
+	ResourceID string    `json:"resourceid,omitempty" bson:"resourceid,omitempty"`
+	TemplateID string    `json:"templateid,omitempty" bson:"templateid,omitempty"`
+	Date       string    `json:"date" bson:"date"` // e.g., "2025-05-01"
+	Time       string    `json:"time" bson:"time"` // e.g., "18:00"
+	Start      time.Time `json:"start" bson:"start,omitempty"`
+	Duration   int       `json:"duration,omitempty" bson:"duration,omitempty"` // Minutes
+	Capacity   int       `json:"capacity" bson:"capacity"`
+	Booked     int       `json:"booked" bson:"booked"` // Seats held; see reserveSeats
+	MinParty   int       `json:"min_party,omitempty" bson:"min_party,omitempty"`
+	MaxParty   int       `json:"max_party,omitempty" bson:"max_party,omitempty"`
+	Available  *int      `json:"available,omitempty" bson:"-"` // Seats left, filled per response
 }
 
+// Booking statuses. Bookings made before statuses existed have none and
+// count as confirmed.
+const (
+	StatusConfirmed = "confirmed"
+	StatusCancelled = "cancelled"
+	StatusAttended  = "attended"
+	StatusNoShow    = "no_show"
+)
+
 type Booking struct {
-	Date  string `json:"date" bson:"date"`
-	Time  string `json:"time" bson:"time"`
-	Name  string `json:"name" bson:"name"`
-	Seats int    `json:"seats" bson:"seats"`
+	BookingID       string     `json:"bookingid,omitempty" bson:"bookingid,omitempty"`
+	PlaceID         string     `json:"placeid,omitempty" bson:"placeid,omitempty"`
+	ResourceID      string     `json:"resourceid,omitempty" bson:"resourceid,omitempty"`
+	SlotID          string     `json:"slotid,omitempty" bson:"slotid,omitempty"`
+	UserID          string     `json:"userid,omitempty" bson:"userid,omitempty"`
+	Date            string     `json:"date" bson:"date"`
+	Time            string     `json:"time" bson:"time"`
+	Start           time.Time  `json:"start" bson:"start,omitempty"`
+	Name            string     `json:"name" bson:"name"`
+	Seats           int        `json:"seats" bson:"seats"`
+	Status          string     `json:"status,omitempty" bson:"status,omitempty"`
+	DepositRequired bool       `json:"deposit_required,omitempty" bson:"deposit_required,omitempty"` // Set from the place's policy and the user's no-shows
+	DepositAmount   float64    `json:"deposit_amount,omitempty" bson:"deposit_amount,omitempty"`
+	Rescheduled     int        `json:"rescheduled,omitempty" bson:"rescheduled,omitempty"` // Times moved to another slot
+	CancelledAt     *time.Time `json:"cancelled_at,omitempty" bson:"cancelled_at,omitempty"`
+	CancelledBy     string     `json:"cancelled_by,omitempty" bson:"cancelled_by,omitempty"`
+	MarkedBy        string     `json:"marked_by,omitempty" bson:"marked_by,omitempty"` // Who recorded attended or no-show
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at" bson:"updated_at,omitempty"`
+	NoShows         *int       `json:"no_shows,omitempty" bson:"-"` // Guest's no-show count, shown to owners
+}
+
+// activeOnly narrows a filter to bookings that hold seats
+func activeOnly(filter bson.M) bson.M {
+	filter["status"] = bson.M{"$ne": StatusCancelled}
+	return filter
+}
+
+// globalOnly narrows a filter to the global slots and bookings, leaving out
+// those that belong to a place
+func globalOnly(filter bson.M) bson.M {
+	filter["placeid"] = bson.M{"$exists": false}
+	return filter
 }
 
 func AddSlot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -30,11 +83,15 @@ func AddSlot(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
+	// Place slots come from templates; see GenerateSlots
+	slot.SlotID, slot.PlaceID, slot.ResourceID, slot.TemplateID = "", "", "", ""
+	slot.Booked = 0
+
 	ctx := context.Background()
 	coll := db.SlotCollection
 
 	// Check for duplicate slot
-	filter := bson.M{"date": slot.Date, "time": slot.Time}
+	filter := globalOnly(bson.M{"date": slot.Date, "time": slot.Time})
 	count, _ := coll.CountDocuments(ctx, filter)
 	if count > 0 {
 		http.Error(w, "Slot already exists", http.StatusConflict)
@@ -55,13 +112,20 @@ func DeleteSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	time := ps.ByName("time")
 
 	ctx := context.Background()
-	coll := db.SlotCollection
 
-	_, err := coll.DeleteOne(ctx, bson.M{"date": date, "time": time})
+	// A slot with active bookings stays; they have to be cancelled first
+	filter := globalOnly(bson.M{"date": date, "time": time})
+	deleted, err := deleteEmptySlot(ctx, filter)
 	if err != nil {
 		http.Error(w, "DB error", 500)
 		return
 	}
+	if !deleted {
+		if n, _ := db.SlotCollection.CountDocuments(ctx, filter); n > 0 {
+			http.Error(w, "Slot has active bookings", http.StatusConflict)
+			return
+		}
+	}
 
 	w.WriteHeader(204)
 }
@@ -70,7 +134,7 @@ func GetSlotsByDate(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	date := ps.ByName("date")
 	ctx := context.Background()
 
-	cursor, err := db.SlotCollection.Find(ctx, bson.M{"date": date})
+	cursor, err := db.SlotCollection.Find(ctx, globalOnly(bson.M{"date": date}))
 	if err != nil {
 		http.Error(w, "DB error", 500)
 		return
@@ -90,7 +154,7 @@ func GetBookingsByDate(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	date := ps.ByName("date")
 	ctx := context.Background()
 
-	cursor, err := db.BookingsCollection.Find(ctx, bson.M{"date": date})
+	cursor, err := db.BookingsCollection.Find(ctx, globalOnly(bson.M{"date": date}))
 	if err != nil {
 		http.Error(w, "DB error", 500)
 		return
@@ -113,39 +177,55 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		return
 	}
 
+	// Place slots are booked by ID with party-size and capacity checks
+	if booking.SlotID != "" {
+		userID, _ := r.Context().Value(globals.UserIDKey).(string)
+		created, status, err := BookSlot(r.Context(), booking.SlotID, userID, booking.Name, booking.Seats)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		utils.SendJSONResponse(w, http.StatusCreated, created)
+		return
+	}
+
 	if booking.Name == "" || booking.Date == "" || booking.Time == "" || booking.Seats < 1 {
 		http.Error(w, "Missing or invalid fields", 400)
 		return
 	}
 
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	start, _ := time.Parse(dateLayout+" "+clockLayout, booking.Date+" "+booking.Time)
+	booking = Booking{
+		BookingID: utils.GenerateID(14),
+		UserID:    userID,
+		Date:      booking.Date,
+		Time:      booking.Time,
+		Start:     start,
+		Name:      booking.Name,
+		Seats:     booking.Seats,
+		Status:    StatusConfirmed,
+		CreatedAt: time.Now().UTC(),
+	}
+
 	ctx := context.Background()
 	slotsColl := db.SlotCollection
 	bookingsColl := db.BookingsCollection
 
 	// 1. Check slot exists
-	var slot Slot
-	err := slotsColl.FindOne(ctx, bson.M{"date": booking.Date, "time": booking.Time}).Decode(&slot)
-	if err != nil {
+	filter := slotFilter(booking)
+	if err := slotsColl.FindOne(ctx, filter).Err(); err != nil {
 		http.Error(w, "Slot not found", 404)
 		return
 	}
 
-	// 2. Sum existing bookings for this slot
-	cursor, err := bookingsColl.Find(ctx, bson.M{"date": booking.Date, "time": booking.Time})
+	// 2. Take the seats, if they are still free
+	ok, err := reserveSeats(ctx, filter, booking.Seats)
 	if err != nil {
 		http.Error(w, "DB error", 500)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	totalBooked := 0
-	for cursor.Next(ctx) {
-		var b Booking
-		cursor.Decode(&b)
-		totalBooked += b.Seats
-	}
-
-	if totalBooked+booking.Seats > slot.Capacity {
+	if !ok {
 		http.Error(w, "Not enough seats available", http.StatusConflict)
 		return
 	}
@@ -153,9 +233,10 @@ func CreateBooking(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 	// 3. Insert booking
 	_, err = bookingsColl.InsertOne(ctx, booking)
 	if err != nil {
+		giveBack(ctx, filter, booking.Seats, booking.BookingID)
 		http.Error(w, "Could not book", 500)
 		return
 	}
 
-	w.WriteHeader(201)
+	utils.SendJSONResponse(w, http.StatusCreated, booking)
 }
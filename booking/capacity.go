@@ -0,0 +1,144 @@
+package booking
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Seats are held on the slot itself: every slot keeps a "booked" counter
+// and a booking first reserves its seats with a single conditional update
+// that only matches while booked+seats still fits the capacity. Mongo
+// applies an update to one document atomically, so concurrent bookings
+// cannot overfill a slot, without needing transactions (and a replica set).
+
+// slotFilter identifies the slot a booking holds seats in
+func slotFilter(b Booking) bson.M {
+	if b.SlotID != "" {
+		return bson.M{"slotid": b.SlotID}
+	}
+	return globalOnly(bson.M{"date": b.Date, "time": b.Time})
+}
+
+// with returns a copy of filter with the extra conditions added
+func with(filter, extra bson.M) bson.M {
+	out := bson.M{}
+	for k, v := range filter {
+		out[k] = v
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
+
+// initCounter seeds the counter of a slot created before counters existed
+// with the seats its bookings hold. Bookings are only added once the counter
+// exists, so the sum cannot miss one.
+func initCounter(ctx context.Context, filter bson.M) error {
+	held := activeOnly(bson.M{})
+	if id, ok := filter["slotid"]; ok {
+		held["slotid"] = id
+	} else {
+		held = globalOnly(with(held, bson.M{"date": filter["date"], "time": filter["time"]}))
+	}
+	cursor, err := db.BookingsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: held}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "seats": bson.M{"$sum": "$seats"}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var rows []struct {
+		Seats int `bson:"seats"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return err
+	}
+	booked := 0
+	if len(rows) > 0 {
+		booked = rows[0].Seats
+	}
+
+	_, err = db.SlotCollection.UpdateOne(ctx,
+		with(filter, bson.M{"booked": bson.M{"$exists": false}}),
+		bson.M{"$set": bson.M{"booked": booked}})
+	return err
+}
+
+// reserveSeats takes seats in the slot if they fit. It reports false when
+// the slot is full or does not exist.
+func reserveSeats(ctx context.Context, filter bson.M, seats int) (bool, error) {
+	fits := with(filter, bson.M{
+		"booked": bson.M{"$exists": true},
+		"$expr":  bson.M{"$lte": bson.A{bson.M{"$add": bson.A{"$booked", seats}}, "$capacity"}},
+	})
+
+	for seeded := false; ; seeded = true {
+		result, err := db.SlotCollection.UpdateOne(ctx, fits, bson.M{"$inc": bson.M{"booked": seats}})
+		if err != nil {
+			return false, err
+		}
+		if result.ModifiedCount == 1 {
+			return true, nil
+		}
+		if seeded {
+			return false, nil
+		}
+
+		// Try once more if the slot only lacked a counter
+		n, err := db.SlotCollection.CountDocuments(ctx, with(filter, bson.M{"booked": bson.M{"$exists": false}}))
+		if err != nil {
+			return false, err
+		}
+		if n == 0 {
+			return false, nil
+		}
+		if err := initCounter(ctx, filter); err != nil {
+			return false, err
+		}
+	}
+}
+
+// releaseSeats gives seats back to the slot, e.g. when a booking is
+// cancelled or could not be saved. It fails if the slot no longer holds
+// that many seats.
+func releaseSeats(ctx context.Context, filter bson.M, seats int) error {
+	result, err := db.SlotCollection.UpdateOne(ctx,
+		with(filter, bson.M{"booked": bson.M{"$gte": seats}}),
+		bson.M{"$inc": bson.M{"booked": -seats}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("slot %v does not hold %d seats", filter, seats)
+	}
+	return nil
+}
+
+// giveBack releases seats where the caller has nothing better to do with a
+// failure than log it. Unreleased seats stay taken for good, so it must not
+// go unnoticed.
+func giveBack(ctx context.Context, filter bson.M, seats int, bookingID string) {
+	if err := releaseSeats(ctx, filter, seats); err != nil {
+		log.Printf("Failed to release %d seats of booking %s: %v", seats, bookingID, err)
+	}
+}
+
+// deleteEmptySlot deletes the slot only while it holds no seats, in the same
+// update, so a booking cannot slip in between a check and the delete. It
+// reports whether the slot was deleted.
+func deleteEmptySlot(ctx context.Context, filter bson.M) (bool, error) {
+	if err := initCounter(ctx, filter); err != nil {
+		return false, err
+	}
+	result, err := db.SlotCollection.DeleteOne(ctx, with(filter, bson.M{"booked": bson.M{"$lte": 0}}))
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
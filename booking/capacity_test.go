@@ -0,0 +1,155 @@
+package booking
+
+import (
+	"context"
+	"fmt"
+	"naevis/db"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDB points the slot and booking collections at a scratch database on
+// the server in MONGO_URI (or MONGODB_URI), which is dropped afterwards.
+// Without one the test is skipped locally but fails in CI (CI set), so the
+// concurrency checks cannot silently stop running:
+//
+//	docker run -d -p 27017:27017 mongo:7
+//	MONGO_URI=mongodb://localhost:27017 go test ./booking
+func testDB(t *testing.T) context.Context {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		uri = os.Getenv("MONGODB_URI")
+	}
+	if uri == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("MONGO_URI is not set; CI must provide a MongoDB for these tests")
+		}
+		t.Skip("MONGO_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	database := client.Database(fmt.Sprintf("naevis_test_%d", time.Now().UnixNano()))
+	slots, bookings := db.SlotCollection, db.BookingsCollection
+	db.SlotCollection = database.Collection("slots")
+	db.BookingsCollection = database.Collection("bookings")
+	t.Cleanup(func() {
+		database.Drop(context.Background())
+		client.Disconnect(context.Background())
+		db.SlotCollection, db.BookingsCollection = slots, bookings
+	})
+	return ctx
+}
+
+// race has n goroutines reserve seats in the slot at once and returns how
+// many got them
+func race(ctx context.Context, t *testing.T, filter bson.M, n, seats int) int {
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	start := make(chan struct{})
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ok, err := reserveSeats(ctx, filter, seats)
+			if err != nil {
+				t.Errorf("reserveSeats: %v", err)
+			}
+			if ok {
+				won.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return int(won.Load())
+}
+
+func loadSlot(ctx context.Context, t *testing.T, filter bson.M) Slot {
+	var slot Slot
+	if err := db.SlotCollection.FindOne(ctx, filter).Decode(&slot); err != nil {
+		t.Fatalf("find slot: %v", err)
+	}
+	return slot
+}
+
+func TestReserveSeatsNeverOverfills(t *testing.T) {
+	ctx := testDB(t)
+
+	cases := []struct {
+		name                string
+		capacity, seats, n  int
+		heldBefore          int // Seats of bookings made before the slot had a counter
+		wantWon, wantBooked int
+		withoutCounter      bool
+	}{
+		{name: "single seats", capacity: 10, seats: 1, n: 50, wantWon: 10, wantBooked: 10},
+		{name: "parties", capacity: 10, seats: 3, n: 50, wantWon: 3, wantBooked: 9},
+		{name: "legacy slot", capacity: 10, seats: 1, n: 50, heldBefore: 4, withoutCounter: true, wantWon: 6, wantBooked: 10},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			slotID := fmt.Sprintf("slot-%d", i)
+			slot := bson.M{"slotid": slotID, "date": "2030-01-01", "time": "18:00", "capacity": c.capacity}
+			if !c.withoutCounter {
+				slot["booked"] = 0
+			}
+			if _, err := db.SlotCollection.InsertOne(ctx, slot); err != nil {
+				t.Fatal(err)
+			}
+			if c.heldBefore > 0 {
+				if _, err := db.BookingsCollection.InsertOne(ctx, bson.M{"slotid": slotID, "seats": c.heldBefore}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			filter := bson.M{"slotid": slotID}
+			won := race(ctx, t, filter, c.n, c.seats)
+			got := loadSlot(ctx, t, filter)
+			if got.Booked > got.Capacity {
+				t.Fatalf("booked %d exceeds capacity %d", got.Booked, got.Capacity)
+			}
+			if won != c.wantWon {
+				t.Errorf("%d reservations succeeded, want %d", won, c.wantWon)
+			}
+			if got.Booked != c.wantBooked {
+				t.Errorf("booked = %d, want %d", got.Booked, c.wantBooked)
+			}
+		})
+	}
+}
+
+func TestDeleteEmptySlotKeepsBookedSlots(t *testing.T) {
+	ctx := testDB(t)
+
+	for _, slotID := range []string{"empty", "booked"} {
+		if _, err := db.SlotCollection.InsertOne(ctx, bson.M{"slotid": slotID, "capacity": 4, "booked": 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, err := reserveSeats(ctx, bson.M{"slotid": "booked"}, 2); err != nil || !ok {
+		t.Fatalf("reserveSeats = %v, %v", ok, err)
+	}
+
+	for slotID, want := range map[string]bool{"empty": true, "booked": false} {
+		deleted, err := deleteEmptySlot(ctx, bson.M{"slotid": slotID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != want {
+			t.Errorf("deleteEmptySlot(%s) = %v, want %v", slotID, deleted, want)
+		}
+	}
+}
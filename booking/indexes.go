@@ -0,0 +1,60 @@
+package booking
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes for place resources, templates, slots,
+// bookings and booking policies. Global slots and bookings have no IDs, so the unique indexes
+// only cover place ones.
+func EnsureIndexes() {
+	ctx := context.TODO()
+	placeOnly := func(field string) *options.IndexOptions {
+		return options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: bson.M{"$exists": true}})
+	}
+
+	if _, err := db.BookingResourcesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "resourceid", Value: 1}}, Options: options.Index().SetUnique(true),
+	}); err != nil {
+		log.Printf("Error creating booking resource index: %v", err)
+	}
+
+	if _, err := db.SlotTemplatesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "resourceid", Value: 1}},
+	}); err != nil {
+		log.Printf("Error creating slot template index: %v", err)
+	}
+
+	if _, err := db.SlotCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slotid", Value: 1}}, Options: placeOnly("slotid")},
+		// Generating a template twice must not double up its slots
+		{Keys: bson.D{{Key: "resourceid", Value: 1}, {Key: "date", Value: 1}, {Key: "time", Value: 1}}, Options: placeOnly("resourceid")},
+		{Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "date", Value: 1}, {Key: "start", Value: 1}}},
+		{Keys: bson.D{{Key: "templateid", Value: 1}, {Key: "start", Value: 1}}},
+	}); err != nil {
+		log.Printf("Error creating slot indexes: %v", err)
+	}
+
+	if _, err := db.BookingsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "bookingid", Value: 1}}, Options: placeOnly("bookingid")},
+		{Keys: bson.D{{Key: "slotid", Value: 1}}},
+		{Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "date", Value: 1}, {Key: "time", Value: 1}}},
+		{Keys: bson.D{{Key: "resourceid", Value: 1}, {Key: "date", Value: 1}}},
+		// My bookings and no-show counts
+		{Keys: bson.D{{Key: "userid", Value: 1}, {Key: "start", Value: 1}}},
+	}); err != nil {
+		log.Printf("Error creating booking indexes: %v", err)
+	}
+
+	if _, err := db.BookingPoliciesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "placeid", Value: 1}}, Options: options.Index().SetUnique(true),
+	}); err != nil {
+		log.Printf("Error creating booking policy index: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/notifications"
+	"naevis/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultMyBookingsLimit = 50
+	maxMyBookingsLimit     = 200
+)
+
+// isConfirmed reports whether the booking still holds its seats and has not
+// been marked attended or no-show
+func (b Booking) isConfirmed() bool {
+	return b.Status == "" || b.Status == StatusConfirmed
+}
+
+// ownBooking loads one of the user's bookings
+func ownBooking(ctx context.Context, bookingID, userID string) (Booking, error) {
+	var b Booking
+	err := db.BookingsCollection.FindOne(ctx, bson.M{"bookingid": bookingID, "userid": userID}).Decode(&b)
+	return b, err
+}
+
+// GetMyBookings lists the caller's bookings. ?when=upcoming (default) gives
+// those not yet started, soonest first; ?when=past gives the rest, latest
+// first. ?limit caps the list.
+func GetMyBookings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	userID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+
+	limit := defaultMyBookingsLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxMyBookingsLimit)
+	}
+
+	now := time.Now().UTC()
+	filter := bson.M{"userid": userID}
+	opts := options.Find().SetLimit(int64(limit))
+	switch q.Get("when") {
+	case "", "upcoming":
+		filter["start"] = bson.M{"$gte": now}
+		opts.SetSort(bson.D{{Key: "start", Value: 1}})
+	case "past":
+		filter["start"] = bson.M{"$lt": now}
+		opts.SetSort(bson.D{{Key: "start", Value: -1}})
+	default:
+		http.Error(w, "when must be upcoming or past", http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := db.BookingsCollection.Find(r.Context(), filter, opts)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	bookings := []Booking{}
+	if err := cursor.All(r.Context(), &bookings); err != nil {
+		http.Error(w, "Parse error", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, bookings)
+}
+
+// notifyPlaceOwner tells the place's owner about a change to a booking
+func notifyPlaceOwner(ctx context.Context, b Booking, notifType, title string) {
+	if b.PlaceID == "" {
+		return
+	}
+	place, err := livePlace(ctx, b.PlaceID)
+	if err != nil || place.CreatedBy == "" {
+		return
+	}
+	body := fmt.Sprintf("%s, party of %d, %s %s", b.Name, b.Seats, b.Date, b.Time)
+	notifications.Send(place.CreatedBy, notifType, title, body, "place", b.PlaceID)
+}
+
+// CancelBooking cancels one of the caller's bookings, releasing its seats.
+// Place bookings can only be cancelled outside the place's cancellation
+// window.
+func CancelBooking(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+	ctx := r.Context()
+
+	b, err := ownBooking(ctx, ps.ByName("bookingid"), userID)
+	if err != nil {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if !b.isConfirmed() {
+		http.Error(w, "This booking is already "+b.Status, http.StatusConflict)
+		return
+	}
+	if !b.Start.After(time.Now()) {
+		http.Error(w, "This booking has already started", http.StatusConflict)
+		return
+	}
+	if b.PlaceID != "" {
+		policy, err := policyFor(ctx, b.PlaceID)
+		if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		if !policy.canChange(b.Start) {
+			http.Error(w, fmt.Sprintf("Bookings can only be cancelled up to %d hours before they start", policy.CancelWindowHours), http.StatusConflict)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	result, err := db.BookingsCollection.UpdateOne(ctx,
+		activeOnly(bson.M{"bookingid": b.BookingID}),
+		bson.M{"$set": bson.M{"status": StatusCancelled, "cancelled_at": now, "cancelled_by": userID, "updated_at": now}})
+	if err != nil {
+		http.Error(w, "Failed to cancel booking", http.StatusInternalServerError)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		http.Error(w, "This booking was changed meanwhile", http.StatusConflict)
+		return
+	}
+	giveBack(ctx, slotFilter(b), b.Seats, b.BookingID)
+	b.Status, b.CancelledAt, b.CancelledBy, b.UpdatedAt = StatusCancelled, &now, userID, now
+
+	go notifyPlaceOwner(context.Background(), b, "booking-cancelled", "A booking was cancelled")
+
+	utils.SendJSONResponse(w, http.StatusOK, b)
+}
+
+// RescheduleBooking moves one of the caller's place bookings to another slot
+// at the same place, optionally with a new party size. Availability is
+// checked again and the cancellation window applies.
+//
+//	{"slotid": "...", "seats": 3}
+func RescheduleBooking(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+	ctx := r.Context()
+
+	var req struct {
+		SlotID string `json:"slotid"`
+		Seats  int    `json:"seats"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SlotID == "" || req.Seats < 0 {
+		http.Error(w, "slotid is required", http.StatusBadRequest)
+		return
+	}
+
+	b, err := ownBooking(ctx, ps.ByName("bookingid"), userID)
+	if err != nil || b.PlaceID == "" {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if !b.isConfirmed() {
+		http.Error(w, "This booking is already "+b.Status, http.StatusConflict)
+		return
+	}
+	policy, err := policyFor(ctx, b.PlaceID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !policy.canChange(b.Start) {
+		http.Error(w, fmt.Sprintf("Bookings can only be changed up to %d hours before they start", policy.CancelWindowHours), http.StatusConflict)
+		return
+	}
+
+	seats := b.Seats
+	if req.Seats > 0 {
+		seats = req.Seats
+	}
+	var slot Slot
+	if err := db.SlotCollection.FindOne(ctx, bson.M{"placeid": b.PlaceID, "slotid": req.SlotID}).Decode(&slot); err != nil {
+		http.Error(w, "Slot not found at this place", http.StatusNotFound)
+		return
+	}
+	if status, err := checkSlot(ctx, slot, seats); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// Take the new seats before giving up the old ones, so a failed move
+	// leaves the booking as it was
+	moved := slot.SlotID != b.SlotID
+	extra := seats
+	if !moved {
+		extra = seats - b.Seats
+	}
+	if extra > 0 {
+		ok, err := reserveSeats(ctx, bson.M{"slotid": slot.SlotID}, extra)
+		if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Not enough seats available", http.StatusConflict)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	set := bson.M{
+		"slotid":     slot.SlotID,
+		"resourceid": slot.ResourceID,
+		"date":       slot.Date,
+		"time":       slot.Time,
+		"start":      slot.Start,
+		"seats":      seats,
+		"updated_at": now,
+	}
+	update := bson.M{"$set": set}
+	if moved {
+		update["$inc"] = bson.M{"rescheduled": 1}
+	}
+	result, err := db.BookingsCollection.UpdateOne(ctx, activeOnly(bson.M{"bookingid": b.BookingID}), update)
+	if err != nil || result.ModifiedCount == 0 {
+		if extra > 0 {
+			giveBack(ctx, bson.M{"slotid": slot.SlotID}, extra, b.BookingID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to reschedule booking", http.StatusInternalServerError)
+		} else {
+			http.Error(w, "This booking was changed meanwhile", http.StatusConflict)
+		}
+		return
+	}
+
+	// Give back the seats the booking no longer holds
+	if moved {
+		giveBack(ctx, slotFilter(b), b.Seats, b.BookingID)
+		b.Rescheduled++
+	} else if extra < 0 {
+		giveBack(ctx, slotFilter(b), -extra, b.BookingID)
+	}
+	b.SlotID, b.ResourceID, b.Date, b.Time, b.Start, b.Seats, b.UpdatedAt = slot.SlotID, slot.ResourceID, slot.Date, slot.Time, slot.Start, seats, now
+
+	go notifyPlaceOwner(context.Background(), b, "booking-rescheduled", "A booking was changed")
+
+	utils.SendJSONResponse(w, http.StatusOK, b)
+}
+
+// MarkAttendance lets a place's owner or managers record whether a guest
+// came, once the booking has started:
+//
+//	{"status": "attended"} or {"status": "no_show"}
+//
+// A mark can be corrected by sending the other status.
+func MarkAttendance(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, bookingID := ps.ByName("placeid"), ps.ByName("bookingid")
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	ctx := r.Context()
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Status != StatusAttended && req.Status != StatusNoShow) {
+		http.Error(w, "status must be attended or no_show", http.StatusBadRequest)
+		return
+	}
+
+	var b Booking
+	if err := db.BookingsCollection.FindOne(ctx, bson.M{"placeid": placeID, "bookingid": bookingID}).Decode(&b); err != nil {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if b.Status == StatusCancelled {
+		http.Error(w, "This booking was cancelled", http.StatusConflict)
+		return
+	}
+	if b.Start.After(time.Now()) {
+		http.Error(w, "Attendance can be recorded once the booking has started", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	_, err := db.BookingsCollection.UpdateOne(ctx, bson.M{"bookingid": bookingID},
+		bson.M{"$set": bson.M{"status": req.Status, "marked_by": userID, "updated_at": now}})
+	if err != nil {
+		http.Error(w, "Failed to update booking", http.StatusInternalServerError)
+		return
+	}
+	b.Status, b.MarkedBy, b.UpdatedAt = req.Status, userID, now
+
+	utils.SendJSONResponse(w, http.StatusOK, b)
+}
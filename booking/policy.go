@@ -0,0 +1,165 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"naevis/db"
+	"naevis/utils"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Used when a place has not set a cancellation window
+	defaultCancelWindowHours = 2
+	// How far back no-shows count towards a deposit
+	noShowLookback = 365 * 24 * time.Hour
+)
+
+// Policy is a place's booking rules. Guests can cancel or reschedule until
+// CancelWindowHours before the slot starts. With NoShowLimit set, guests
+// with that many no-shows anywhere in the last year are asked for a
+// DepositAmount when they book.
+type Policy struct {
+	PlaceID           string    `json:"placeid" bson:"placeid"`
+	CancelWindowHours int       `json:"cancel_window_hours" bson:"cancel_window_hours"`
+	NoShowLimit       int       `json:"no_show_limit" bson:"no_show_limit"` // 0 never asks for a deposit
+	DepositAmount     float64   `json:"deposit_amount" bson:"deposit_amount"`
+	UpdatedAt         time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// policyFor returns the place's policy, or the defaults if it has none
+func policyFor(ctx context.Context, placeID string) (Policy, error) {
+	policy := Policy{PlaceID: placeID, CancelWindowHours: defaultCancelWindowHours}
+	err := db.BookingPoliciesCollection.FindOne(ctx, bson.M{"placeid": placeID}).Decode(&policy)
+	if err == mongo.ErrNoDocuments {
+		return policy, nil
+	}
+	return policy, err
+}
+
+// canChange reports whether a booking starting at start is still outside
+// the policy's cancellation window
+func (p Policy) canChange(start time.Time) bool {
+	return time.Until(start) >= time.Duration(p.CancelWindowHours)*time.Hour
+}
+
+// noShowCount counts the user's no-shows at any place within noShowLookback
+func noShowCount(ctx context.Context, userID string) (int, error) {
+	n, err := db.BookingsCollection.CountDocuments(ctx, bson.M{
+		"userid": userID,
+		"status": StatusNoShow,
+		"start":  bson.M{"$gte": time.Now().Add(-noShowLookback)},
+	})
+	return int(n), err
+}
+
+// GetBookingPolicy returns a place's booking policy so guests can see the
+// cancellation window before they book
+func GetBookingPolicy(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	if _, err := livePlace(r.Context(), placeID); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	policy, err := policyFor(r.Context(), placeID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, policy)
+}
+
+// SetBookingPolicy replaces a place's booking policy, e.g.
+//
+//	{"cancel_window_hours": 24, "no_show_limit": 2, "deposit_amount": 20}
+func SetBookingPolicy(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+
+	var policy Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if policy.CancelWindowHours < 0 || policy.CancelWindowHours > 24*14 {
+		http.Error(w, "cancel_window_hours must be between 0 and 336", http.StatusBadRequest)
+		return
+	}
+	if policy.NoShowLimit < 0 || policy.DepositAmount < 0 {
+		http.Error(w, "no_show_limit and deposit_amount cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if policy.NoShowLimit > 0 && policy.DepositAmount == 0 {
+		http.Error(w, "deposit_amount is required with a no_show_limit", http.StatusBadRequest)
+		return
+	}
+	policy.PlaceID = placeID
+	policy.UpdatedAt = time.Now().UTC()
+
+	_, err := db.BookingPoliciesCollection.ReplaceOne(r.Context(), bson.M{"placeid": placeID}, policy, options.Replace().SetUpsert(true))
+	if err != nil {
+		http.Error(w, "Failed to save policy", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, policy)
+}
+
+// GuestHistory is a guest's booking record as shown to a place's owner
+type GuestHistory struct {
+	UserID          string         `json:"userid"`
+	AtThisPlace     map[string]int `json:"at_this_place"` // Bookings by status
+	NoShows         int            `json:"no_shows"`      // At any place within the last year
+	DepositRequired bool           `json:"deposit_required"`
+}
+
+// GetGuestHistory shows owners and managers how often a guest who has booked
+// with them attended, cancelled or did not show, and whether the place's
+// policy would ask them for a deposit
+func GetGuestHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, guestID := ps.ByName("placeid"), ps.ByName("userid")
+	ctx := r.Context()
+
+	cursor, err := db.BookingsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"placeid": placeID, "userid": guestID}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"$ifNull": bson.A{"$status", StatusConfirmed}}, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	var rows []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	// Only guests who have booked here can be looked up
+	if len(rows) == 0 {
+		http.Error(w, "No bookings by this guest", http.StatusNotFound)
+		return
+	}
+
+	history := GuestHistory{UserID: guestID, AtThisPlace: map[string]int{}}
+	for _, row := range rows {
+		history.AtThisPlace[row.Status] = row.Count
+	}
+	if history.NoShows, err = noShowCount(ctx, guestID); err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	policy, err := policyFor(ctx, placeID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	history.DepositRequired = policy.NoShowLimit > 0 && history.NoShows >= policy.NoShowLimit
+
+	utils.SendJSONResponse(w, http.StatusOK, history)
+}
@@ -0,0 +1,194 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"naevis/db"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of bookable resources
+var ResourceKinds = []string{"table", "room", "court", "staff"}
+
+// Resource is something at a place that can be booked: a table, a room, a
+// court or a member of staff. Capacity is the number of seats (people) it
+// takes per slot, shared by every booking in that slot.
+type Resource struct {
+	ResourceID string    `json:"resourceid" bson:"resourceid"`
+	PlaceID    string    `json:"placeid" bson:"placeid"`
+	Name       string    `json:"name" bson:"name"`
+	Kind       string    `json:"kind" bson:"kind"`
+	Capacity   int       `json:"capacity" bson:"capacity"`
+	MinParty   int       `json:"min_party" bson:"min_party"`
+	MaxParty   int       `json:"max_party" bson:"max_party"`
+	Active     bool      `json:"active" bson:"active"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// validate fills party-size defaults and checks the resource's fields
+func (res *Resource) validate() error {
+	if res.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !slices.Contains(ResourceKinds, res.Kind) {
+		return fmt.Errorf("kind must be one of %v", ResourceKinds)
+	}
+	if res.Capacity < 1 {
+		return fmt.Errorf("capacity must be a positive integer")
+	}
+	if res.MinParty == 0 {
+		res.MinParty = 1
+	}
+	if res.MaxParty == 0 {
+		res.MaxParty = res.Capacity
+	}
+	if res.MinParty < 1 || res.MaxParty < res.MinParty || res.MaxParty > res.Capacity {
+		return fmt.Errorf("party sizes must satisfy 1 <= min_party <= max_party <= capacity")
+	}
+	return nil
+}
+
+// livePlace loads a place that is not in the trash
+func livePlace(ctx context.Context, placeID string) (structs.Place, error) {
+	var place structs.Place
+	err := db.PlacesCollection.FindOne(ctx, trash.Live(bson.M{"placeid": placeID})).Decode(&place)
+	return place, err
+}
+
+func findResource(ctx context.Context, placeID, resourceID string) (Resource, error) {
+	var res Resource
+	err := db.BookingResourcesCollection.FindOne(ctx, bson.M{"placeid": placeID, "resourceid": resourceID}).Decode(&res)
+	return res, err
+}
+
+// CreateResource adds a bookable resource to a place. The body is a
+// Resource; min_party defaults to 1 and max_party to the capacity.
+func CreateResource(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+
+	var res Resource
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if err := res.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	res.ResourceID = utils.GenerateID(12)
+	res.PlaceID = placeID
+	res.Active = true
+	res.CreatedAt, res.UpdatedAt = now, now
+
+	if _, err := db.BookingResourcesCollection.InsertOne(r.Context(), res); err != nil {
+		http.Error(w, "Failed to create resource", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusCreated, res)
+}
+
+// GetResources lists a place's active resources; ?all=true also shows
+// inactive ones
+func GetResources(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	if _, err := livePlace(r.Context(), placeID); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+
+	filter := bson.M{"placeid": placeID}
+	if r.URL.Query().Get("all") != "true" {
+		filter["active"] = true
+	}
+	cursor, err := db.BookingResourcesCollection.Find(r.Context(), filter,
+		options.Find().SetSort(bson.D{{Key: "kind", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		http.Error(w, "Failed to fetch resources", http.StatusInternalServerError)
+		return
+	}
+	resources := []Resource{}
+	if err := cursor.All(r.Context(), &resources); err != nil {
+		http.Error(w, "Failed to fetch resources", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, resources)
+}
+
+// UpdateResource replaces a resource's name, kind, capacity, party sizes and
+// active flag. Slots already generated keep their old capacity until they
+// are regenerated.
+func UpdateResource(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, resourceID := ps.ByName("placeid"), ps.ByName("resourceid")
+
+	existing, err := findResource(r.Context(), placeID, resourceID)
+	if err != nil {
+		http.Error(w, "Resource not found", http.StatusNotFound)
+		return
+	}
+
+	var res Resource
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if err := res.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.ResourceID, res.PlaceID, res.CreatedAt = existing.ResourceID, placeID, existing.CreatedAt
+	res.UpdatedAt = time.Now().UTC()
+
+	if _, err := db.BookingResourcesCollection.ReplaceOne(r.Context(), bson.M{"placeid": placeID, "resourceid": resourceID}, res); err != nil {
+		http.Error(w, "Failed to update resource", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, res)
+}
+
+// DeleteResource removes a resource with its templates and open future
+// slots. A resource with upcoming bookings cannot be deleted; deactivate it
+// instead.
+func DeleteResource(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, resourceID := ps.ByName("placeid"), ps.ByName("resourceid")
+	ctx := r.Context()
+
+	if _, err := findResource(ctx, placeID, resourceID); err != nil {
+		http.Error(w, "Resource not found", http.StatusNotFound)
+		return
+	}
+
+	upcoming, err := db.BookingsCollection.CountDocuments(ctx, activeOnly(bson.M{
+		"resourceid": resourceID,
+		"date":       bson.M{"$gte": time.Now().UTC().AddDate(0, 0, -1).Format(dateLayout)},
+	}))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if upcoming > 0 {
+		http.Error(w, "This resource has upcoming bookings; set it inactive instead", http.StatusConflict)
+		return
+	}
+
+	for _, coll := range []*mongo.Collection{db.SlotCollection, db.SlotTemplatesCollection, db.BookingResourcesCollection} {
+		if _, err := coll.DeleteMany(ctx, bson.M{"placeid": placeID, "resourceid": resourceID}); err != nil {
+			http.Error(w, "Failed to delete resource", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,297 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// bookedSeats sums the seats booked in each of the slots
+func bookedSeats(ctx context.Context, slotIDs []string) (map[string]int, error) {
+	cursor, err := db.BookingsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: activeOnly(bson.M{"slotid": bson.M{"$in": slotIDs}})}},
+		{{Key: "$group", Value: bson.M{"_id": "$slotid", "seats": bson.M{"$sum": "$seats"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		SlotID string `bson:"_id"`
+		Seats  int    `bson:"seats"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	booked := make(map[string]int, len(rows))
+	for _, row := range rows {
+		booked[row.SlotID] = row.Seats
+	}
+	return booked, nil
+}
+
+// GetPlaceSlots lists a place's upcoming slots on ?date=YYYY-MM-DD with the
+// seats still available. ?resource narrows to one resource and ?party to
+// slots that take a party of that size and still have room for it.
+func GetPlaceSlots(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	if _, err := livePlace(ctx, placeID); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	date := q.Get("date")
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	party := 0
+	if v := q.Get("party"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "party must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		party = n
+	}
+
+	resourceIDs, err := db.BookingResourcesCollection.Distinct(ctx, "resourceid", bson.M{"placeid": placeID, "active": true})
+	if err != nil {
+		http.Error(w, "Failed to fetch slots", http.StatusInternalServerError)
+		return
+	}
+	filter := bson.M{
+		"placeid":    placeID,
+		"resourceid": bson.M{"$in": resourceIDs},
+		"date":       date,
+		"start":      bson.M{"$gt": time.Now().UTC()},
+	}
+	if res := q.Get("resource"); res != "" {
+		filter["$and"] = bson.A{bson.M{"resourceid": res}}
+	}
+	if party > 0 {
+		filter["min_party"] = bson.M{"$lte": party}
+		filter["max_party"] = bson.M{"$gte": party}
+	}
+
+	cursor, err := db.SlotCollection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "resourceid", Value: 1}}))
+	if err != nil {
+		http.Error(w, "Failed to fetch slots", http.StatusInternalServerError)
+		return
+	}
+	var slots []Slot
+	if err := cursor.All(ctx, &slots); err != nil {
+		http.Error(w, "Failed to fetch slots", http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]string, len(slots))
+	for i, s := range slots {
+		ids[i] = s.SlotID
+	}
+	booked, err := bookedSeats(ctx, ids)
+	if err != nil {
+		http.Error(w, "Failed to fetch slots", http.StatusInternalServerError)
+		return
+	}
+
+	open := []Slot{}
+	for _, s := range slots {
+		available := max(s.Capacity-booked[s.SlotID], 0)
+		if available == 0 || available < party {
+			continue
+		}
+		s.Available = &available
+		open = append(open, s)
+	}
+	utils.SendJSONResponse(w, http.StatusOK, open)
+}
+
+// DeletePlaceSlot removes one slot, e.g. to block a table for a private
+// event. Slots with bookings cannot be removed.
+func DeletePlaceSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, slotID := ps.ByName("placeid"), ps.ByName("slotid")
+	ctx := r.Context()
+
+	filter := bson.M{"placeid": placeID, "slotid": slotID}
+	deleted, err := deleteEmptySlot(ctx, filter)
+	if err != nil {
+		http.Error(w, "Failed to delete slot", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		if n, _ := db.SlotCollection.CountDocuments(ctx, filter); n > 0 {
+			http.Error(w, "This slot has bookings", http.StatusConflict)
+		} else {
+			http.Error(w, "Slot not found", http.StatusNotFound)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkSlot checks that a party of seats may take the slot: it has not
+// started, its place and resource take bookings and the party size fits.
+// Whether there is room is up to reserveSeats. On failure it returns the
+// HTTP status to respond with.
+func checkSlot(ctx context.Context, slot Slot, seats int) (int, error) {
+	if !slot.Start.After(time.Now()) {
+		return http.StatusConflict, fmt.Errorf("This slot has already started")
+	}
+	if _, err := livePlace(ctx, slot.PlaceID); err != nil {
+		return http.StatusNotFound, fmt.Errorf("Place not found")
+	}
+	res, err := findResource(ctx, slot.PlaceID, slot.ResourceID)
+	if err != nil || !res.Active {
+		return http.StatusConflict, fmt.Errorf("This resource is not taking bookings")
+	}
+	if seats < slot.MinParty || (slot.MaxParty > 0 && seats > slot.MaxParty) {
+		return http.StatusBadRequest, fmt.Errorf("Party size must be between %d and %d", slot.MinParty, slot.MaxParty)
+	}
+	return http.StatusOK, nil
+}
+
+// BookSlot books seats in a place's slot for the user. A deposit is asked
+// for when the place's policy says so for the user's no-show record. On
+// failure it returns the HTTP status to respond with.
+func BookSlot(ctx context.Context, slotID, userID, name string, seats int) (Booking, int, error) {
+	if userID == "" {
+		return Booking{}, http.StatusUnauthorized, fmt.Errorf("Invalid user")
+	}
+	if name == "" || seats < 1 {
+		return Booking{}, http.StatusBadRequest, fmt.Errorf("Missing or invalid fields")
+	}
+
+	var slot Slot
+	if err := db.SlotCollection.FindOne(ctx, bson.M{"slotid": slotID}).Decode(&slot); err != nil {
+		return Booking{}, http.StatusNotFound, fmt.Errorf("Slot not found")
+	}
+	if status, err := checkSlot(ctx, slot, seats); err != nil {
+		return Booking{}, status, err
+	}
+
+	now := time.Now().UTC()
+	booking := Booking{
+		BookingID:  utils.GenerateID(14),
+		PlaceID:    slot.PlaceID,
+		ResourceID: slot.ResourceID,
+		SlotID:     slotID,
+		UserID:     userID,
+		Date:       slot.Date,
+		Time:       slot.Time,
+		Start:      slot.Start,
+		Name:       name,
+		Seats:      seats,
+		Status:     StatusConfirmed,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	policy, err := policyFor(ctx, slot.PlaceID)
+	if err != nil {
+		return Booking{}, http.StatusInternalServerError, fmt.Errorf("DB error")
+	}
+	if policy.NoShowLimit > 0 {
+		noShows, err := noShowCount(ctx, userID)
+		if err != nil {
+			return Booking{}, http.StatusInternalServerError, fmt.Errorf("DB error")
+		}
+		if noShows >= policy.NoShowLimit {
+			booking.DepositRequired, booking.DepositAmount = true, policy.DepositAmount
+		}
+	}
+
+	ok, err := reserveSeats(ctx, slotFilter(booking), seats)
+	if err != nil {
+		return Booking{}, http.StatusInternalServerError, fmt.Errorf("DB error")
+	}
+	if !ok {
+		return Booking{}, http.StatusConflict, fmt.Errorf("Not enough seats available")
+	}
+	if _, err := db.BookingsCollection.InsertOne(ctx, booking); err != nil {
+		giveBack(ctx, slotFilter(booking), seats, booking.BookingID)
+		return Booking{}, http.StatusInternalServerError, fmt.Errorf("Could not book")
+	}
+	return booking, http.StatusCreated, nil
+}
+
+// BookPlaceSlot books a slot at the place. The body is
+// {"slotid": "...", "name": "...", "seats": 4}.
+func BookPlaceSlot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req Booking
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+
+	if err := db.SlotCollection.FindOne(r.Context(), bson.M{"placeid": ps.ByName("placeid"), "slotid": req.SlotID}).Err(); err != nil {
+		http.Error(w, "Slot not found", http.StatusNotFound)
+		return
+	}
+
+	booking, status, err := BookSlot(r.Context(), req.SlotID, userID, req.Name, req.Seats)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	utils.SendJSONResponse(w, status, booking)
+}
+
+// GetPlaceBookings lists a place's bookings on ?date=YYYY-MM-DD for its
+// owner and managers, optionally for one ?resource
+func GetPlaceBookings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q := r.URL.Query()
+	date := q.Get("date")
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{"placeid": ps.ByName("placeid"), "date": date}
+	if res := q.Get("resource"); res != "" {
+		filter["resourceid"] = res
+	}
+	cursor, err := db.BookingsCollection.Find(r.Context(), filter,
+		options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "resourceid", Value: 1}}))
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	bookings := []Booking{}
+	if err := cursor.All(r.Context(), &bookings); err != nil {
+		http.Error(w, "Parse error", http.StatusInternalServerError)
+		return
+	}
+
+	// Show each guest's no-show record so the door knows who to chase
+	noShows := map[string]int{}
+	for i, b := range bookings {
+		if b.UserID == "" {
+			continue
+		}
+		n, seen := noShows[b.UserID]
+		if !seen {
+			if n, err = noShowCount(r.Context(), b.UserID); err != nil {
+				http.Error(w, "DB error", http.StatusInternalServerError)
+				return
+			}
+			noShows[b.UserID] = n
+		}
+		bookings[i].NoShows = &n
+	}
+	utils.SendJSONResponse(w, http.StatusOK, bookings)
+}
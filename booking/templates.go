@@ -0,0 +1,333 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"naevis/db"
+	"naevis/structs"
+	"naevis/utils"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	dateLayout  = "2006-01-02"
+	clockLayout = "15:04"
+
+	// Slots are generated this far ahead when a template is saved
+	defaultGenerateDays = 28
+	// The most GenerateSlots will create in one request
+	maxGenerateDays = 90
+)
+
+// SlotTemplate is a weekly availability pattern for a resource: on each of
+// Days, a slot of Duration minutes starts every Interval minutes from Start
+// until the last one that ends by End. Times are in the place's zone.
+type SlotTemplate struct {
+	TemplateID string    `json:"templateid" bson:"templateid"`
+	PlaceID    string    `json:"placeid" bson:"placeid"`
+	ResourceID string    `json:"resourceid" bson:"resourceid"`
+	Days       []string  `json:"days" bson:"days"`   // Names from structs.Weekdays
+	Start      string    `json:"start" bson:"start"` // "HH:MM"
+	End        string    `json:"end" bson:"end"`     // "HH:MM"
+	Interval   int       `json:"interval" bson:"interval"`
+	Duration   int       `json:"duration" bson:"duration"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+func clockMinutes(s string) (int, error) {
+	t, err := time.Parse(clockLayout, s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (t *SlotTemplate) validate() error {
+	if len(t.Days) == 0 {
+		return fmt.Errorf("days is required")
+	}
+	for _, d := range t.Days {
+		if !slices.Contains(structs.Weekdays, d) {
+			return fmt.Errorf("unknown day %q; use one of %v", d, structs.Weekdays)
+		}
+	}
+	start, err := clockMinutes(t.Start)
+	if err != nil {
+		return err
+	}
+	end, err := clockMinutes(t.End)
+	if err != nil {
+		return err
+	}
+	if t.Duration < 5 || t.Duration > 24*60 {
+		return fmt.Errorf("duration must be between 5 and 1440 minutes")
+	}
+	if t.Interval == 0 {
+		t.Interval = t.Duration
+	}
+	if t.Interval < 5 {
+		return fmt.Errorf("interval must be at least 5 minutes")
+	}
+	if end-start < t.Duration {
+		return fmt.Errorf("end must be at least one duration after start")
+	}
+	return nil
+}
+
+// closedOn reports whether the place's hours close it all day on date
+func closedOn(place structs.Place, date string) bool {
+	if place.OperatingHours == nil {
+		return false
+	}
+	for _, ex := range place.OperatingHours.Exceptions {
+		if ex.Date == date && ex.Closed && len(ex.Shifts) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// generateSlots creates the template's slots for the days in [from, to),
+// skipping days the place is closed and slots that already exist or have
+// started. It returns how many were created.
+func generateSlots(ctx context.Context, place structs.Place, res Resource, tmpl SlotTemplate, from, to time.Time) (int, error) {
+	loc := structs.LoadZone(place.TimeZone)
+	start, _ := clockMinutes(tmpl.Start)
+	end, _ := clockMinutes(tmpl.End)
+	now := time.Now()
+
+	var slots []any
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		if !slices.Contains(tmpl.Days, structs.Weekdays[day.Weekday()]) || closedOn(place, date) {
+			continue
+		}
+		for m := start; m+tmpl.Duration <= end; m += tmpl.Interval {
+			at := time.Date(day.Year(), day.Month(), day.Day(), m/60, m%60, 0, 0, loc)
+			if at.Before(now) {
+				continue
+			}
+			slots = append(slots, Slot{
+				SlotID:     utils.GenerateID(14),
+				PlaceID:    place.PlaceID,
+				ResourceID: res.ResourceID,
+				TemplateID: tmpl.TemplateID,
+				Date:       date,
+				Time:       fmt.Sprintf("%02d:%02d", m/60, m%60),
+				Start:      at.UTC(),
+				Duration:   tmpl.Duration,
+				Capacity:   res.Capacity,
+				MinParty:   res.MinParty,
+				MaxParty:   res.MaxParty,
+			})
+		}
+	}
+	if len(slots) == 0 {
+		return 0, nil
+	}
+
+	// The unique resource/date/time index skips slots that already exist
+	_, err := db.SlotCollection.InsertMany(ctx, slots, options.InsertMany().SetOrdered(false))
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && mongo.IsDuplicateKeyError(err) {
+		return len(slots) - len(bwe.WriteErrors), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(slots), nil
+}
+
+// today is the current date in the place's zone, at midnight
+func today(place structs.Place) time.Time {
+	now := time.Now().In(structs.LoadZone(place.TimeZone))
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// CreateSlotTemplate adds a weekly template to a resource and generates its
+// slots for the next four weeks, e.g.
+//
+//	{"days": ["fri", "sat"], "start": "18:00", "end": "23:00", "interval": 30, "duration": 90}
+//
+// interval defaults to duration.
+func CreateSlotTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, resourceID := ps.ByName("placeid"), ps.ByName("resourceid")
+	ctx := r.Context()
+
+	place, err := livePlace(ctx, placeID)
+	if err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	res, err := findResource(ctx, placeID, resourceID)
+	if err != nil {
+		http.Error(w, "Resource not found", http.StatusNotFound)
+		return
+	}
+
+	var tmpl SlotTemplate
+	if err := json.NewDecoder(r.Body).Decode(&tmpl); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if err := tmpl.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmpl.TemplateID = utils.GenerateID(12)
+	tmpl.PlaceID, tmpl.ResourceID = placeID, resourceID
+	tmpl.CreatedAt = time.Now().UTC()
+
+	if _, err := db.SlotTemplatesCollection.InsertOne(ctx, tmpl); err != nil {
+		http.Error(w, "Failed to save template", http.StatusInternalServerError)
+		return
+	}
+
+	created := 0
+	if res.Active {
+		from := today(place)
+		created, err = generateSlots(ctx, place, res, tmpl, from, from.AddDate(0, 0, defaultGenerateDays))
+		if err != nil {
+			http.Error(w, "Template saved but slots could not be generated", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, map[string]any{
+		"template":        tmpl,
+		"slots_generated": created,
+	})
+}
+
+// GetSlotTemplates lists a resource's templates
+func GetSlotTemplates(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	cursor, err := db.SlotTemplatesCollection.Find(r.Context(), bson.M{
+		"placeid":    ps.ByName("placeid"),
+		"resourceid": ps.ByName("resourceid"),
+	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		http.Error(w, "Failed to fetch templates", http.StatusInternalServerError)
+		return
+	}
+	templates := []SlotTemplate{}
+	if err := cursor.All(r.Context(), &templates); err != nil {
+		http.Error(w, "Failed to fetch templates", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, templates)
+}
+
+// DeleteSlotTemplate removes a template and the future slots it made that
+// have no bookings
+func DeleteSlotTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, resourceID, templateID := ps.ByName("placeid"), ps.ByName("resourceid"), ps.ByName("templateid")
+	ctx := r.Context()
+
+	result, err := db.SlotTemplatesCollection.DeleteOne(ctx, bson.M{"placeid": placeID, "resourceid": resourceID, "templateid": templateID})
+	if err != nil {
+		http.Error(w, "Failed to delete template", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	booked, err := db.BookingsCollection.Distinct(ctx, "slotid", activeOnly(bson.M{"placeid": placeID, "resourceid": resourceID}))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	removed, err := db.SlotCollection.DeleteMany(ctx, bson.M{
+		"templateid": templateID,
+		"start":      bson.M{"$gt": time.Now().UTC()},
+		"slotid":     bson.M{"$nin": booked},
+	})
+	if err != nil {
+		http.Error(w, "Failed to remove slots", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"message":       "Template deleted",
+		"slots_removed": removed.DeletedCount,
+	})
+}
+
+// GenerateSlots (re)generates slots from all templates of a place's active
+// resources for ?from=YYYY-MM-DD (default today) over ?days (default 28,
+// at most 90). Existing slots are left as they are.
+func GenerateSlots(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	place, err := livePlace(ctx, placeID)
+	if err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+
+	from := today(place)
+	if v := q.Get("from"); v != "" {
+		d, err := time.Parse(dateLayout, v)
+		if err != nil {
+			http.Error(w, "from must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = d
+	}
+	days := defaultGenerateDays
+	if v := q.Get("days"); v != "" {
+		if _, err := fmt.Sscanf(v, "%d", &days); err != nil || days < 1 || days > maxGenerateDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxGenerateDays), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var resources []Resource
+	cursor, err := db.BookingResourcesCollection.Find(ctx, bson.M{"placeid": placeID, "active": true})
+	if err == nil {
+		err = cursor.All(ctx, &resources)
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch resources", http.StatusInternalServerError)
+		return
+	}
+
+	created := 0
+	for _, res := range resources {
+		var templates []SlotTemplate
+		cursor, err := db.SlotTemplatesCollection.Find(ctx, bson.M{"placeid": placeID, "resourceid": res.ResourceID})
+		if err == nil {
+			err = cursor.All(ctx, &templates)
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch templates", http.StatusInternalServerError)
+			return
+		}
+		for _, tmpl := range templates {
+			n, err := generateSlots(ctx, place, res, tmpl, from, from.AddDate(0, 0, days))
+			if err != nil {
+				http.Error(w, "Failed to generate slots", http.StatusInternalServerError)
+				return
+			}
+			created += n
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"from":            from.Format(dateLayout),
+		"days":            days,
+		"slots_generated": created,
+	})
+}
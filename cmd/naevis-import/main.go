@@ -0,0 +1,118 @@
+// Command naevis-import bulk imports events or places from a CSV or iCal file
+// on behalf of a user. It uses the same validation and upsert rules as
+// POST /api/import/:kind.
+//
+//	naevis-import -kind event -creator <userid> -file listings.csv -mapping '{"title":"Name"}' -dry-run
+//
+// The JSON report goes to stdout, or to the file given with -report; all
+// other output goes to stderr.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"naevis/db"
+	"naevis/importer"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	kind := flag.String("kind", importer.KindEvent, "what to import: event or place")
+	path := flag.String("file", "", "CSV or iCal file to import")
+	format := flag.String("format", "", "csv or ics (default: from the file extension)")
+	mapping := flag.String("mapping", "", "JSON object of field -> CSV column, or @file containing it")
+	creator := flag.String("creator", "", "user ID that will own the imported records")
+	tz := flag.String("tz", "", "IANA time zone for times without an offset")
+	dryRun := flag.Bool("dry-run", false, "validate and report without writing")
+	reportPath := flag.String("report", "", "write the JSON report to this file instead of stdout")
+	flag.Parse()
+
+	// mq and other shared packages print progress with fmt.Println; send it
+	// to stderr so stdout carries only the report
+	reportOut := os.Stdout
+	os.Stdout = os.Stderr
+
+	if *path == "" || *creator == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := importer.Options{
+		Kind:      *kind,
+		Format:    *format,
+		DryRun:    *dryRun,
+		CreatorID: *creator,
+		TimeZone:  *tz,
+	}
+	if opts.Format == "" {
+		opts.Format = importer.FormatFromFilename(*path)
+	}
+	if *mapping != "" {
+		raw := []byte(*mapping)
+		if strings.HasPrefix(*mapping, "@") {
+			b, err := os.ReadFile(strings.TrimPrefix(*mapping, "@"))
+			if err != nil {
+				log.Fatalf("reading mapping: %v", err)
+			}
+			raw = b
+		}
+		if err := json.Unmarshal(raw, &opts.Mapping); err != nil {
+			log.Fatalf("mapping must be a JSON object: %v", err)
+		}
+	}
+
+	mongoURI := os.Getenv("MONGODB_URI")
+	if mongoURI == "" {
+		log.Fatalf("MONGODB_URI environment variable is not set")
+	}
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		log.Fatalf("connecting to MongoDB: %v", err)
+	}
+	defer client.Disconnect(context.TODO())
+
+	database := client.Database("eventdb")
+	db.Client = client
+	db.EventsCollection = database.Collection("events")
+	db.PlacesCollection = database.Collection("places")
+	db.PlaceVersionsCollection = database.Collection("placeversions") // Place updates are versioned; see places.RecordPlaceVersion
+	db.UserCollection = database.Collection("users")
+	db.UserDataCollection = database.Collection("userdata")
+
+	if err := db.UserCollection.FindOne(context.TODO(), bson.M{"userid": opts.CreatorID}).Err(); err != nil {
+		log.Fatalf("creator %q not found: %v", opts.CreatorID, err)
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		log.Fatalf("opening %s: %v", *path, err)
+	}
+	defer f.Close()
+
+	report, err := importer.Run(f, opts)
+	if err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+
+	if *reportPath != "" {
+		if reportOut, err = os.Create(*reportPath); err != nil {
+			log.Fatalf("creating report: %v", err)
+		}
+		defer reportOut.Close()
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Fprintln(reportOut, string(out))
+	fmt.Fprintf(os.Stderr, "%d rows: %d created, %d updated, %d failed (dry run: %v)\n",
+		report.Total, report.Created, report.Updated, report.Failed, report.DryRun)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
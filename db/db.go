@@ -33,6 +33,23 @@ var (
 	CartoonsCollection         *mongo.Collection
 	ChatsCollection            *mongo.Collection
 	MessagesCollection         *mongo.Collection
+	CalendarFeedsCollection    *mongo.Collection
+	NotificationsCollection    *mongo.Collection
+	EventTemplatesCollection   *mongo.Collection
+	EventMembersCollection     *mongo.Collection
+	EventQuestionsCollection   *mongo.Collection
+	StagesCollection           *mongo.Collection
+	SessionsCollection         *mongo.Collection
+	ScheduleStarsCollection    *mongo.Collection
+	EventAnalyticsCollection   *mongo.Collection
+	PlaceVersionsCollection    *mongo.Collection
+	CheckInsCollection         *mongo.Collection
+	PlaceClaimsCollection      *mongo.Collection
+	BookingResourcesCollection *mongo.Collection
+	SlotTemplatesCollection    *mongo.Collection
+	BookingPoliciesCollection  *mongo.Collection
+	MenuCategoriesCollection   *mongo.Collection
+	OrdersCollection           *mongo.Collection
 	Client                     *mongo.Client
 	CTX                        = context.Background()
 )
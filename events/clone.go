@@ -0,0 +1,424 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/structs"
+	"naevis/tickets"
+	"naevis/trash"
+	"naevis/userdata"
+	"naevis/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upload locations of files owned by merch and media documents
+var (
+	merchUploadPath = "./static/merchpic"
+	mediaUploadPath = "./static/uploads"
+)
+
+// eventSnapshot is an event together with the documents that hang off it
+type eventSnapshot struct {
+	Event   structs.Event
+	Tickets []structs.Ticket
+	Merch   []structs.Merch
+	Media   []structs.Media
+}
+
+type cloneRequest struct {
+	Title         string     `json:"title,omitempty"`
+	StartDateTime *time.Time `json:"start_date_time"`
+	EndDateTime   *time.Time `json:"end_date_time,omitempty"`
+}
+
+func loadEventSnapshot(eventID string) (eventSnapshot, error) {
+	ctx := context.TODO()
+	var snap eventSnapshot
+
+	if err := db.EventsCollection.FindOne(ctx, trash.Live(bson.M{"eventid": eventID})).Decode(&snap.Event); err != nil {
+		return snap, err
+	}
+
+	cursor, err := db.TicketsCollection.Find(ctx, bson.M{"eventid": eventID})
+	if err != nil {
+		return snap, err
+	}
+	if err := cursor.All(ctx, &snap.Tickets); err != nil {
+		return snap, err
+	}
+
+	cursor, err = db.MerchCollection.Find(ctx, bson.M{"entity_id": eventID, "entity_type": "event"})
+	if err != nil {
+		return snap, err
+	}
+	if err := cursor.All(ctx, &snap.Merch); err != nil {
+		return snap, err
+	}
+
+	cursor, err = db.MediaCollection.Find(ctx, bson.M{"entityid": eventID, "entitytype": "event"})
+	if err != nil {
+		return snap, err
+	}
+	if err := cursor.All(ctx, &snap.Media); err != nil {
+		return snap, err
+	}
+
+	return snap, nil
+}
+
+// instantiateSnapshot creates a new draft event from a snapshot. Tickets, merch
+// and media are deep-copied under fresh IDs, including their uploaded files.
+func instantiateSnapshot(snap eventSnapshot, creatorID string, req cloneRequest) (structs.Event, error) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	src := snap.Event
+
+	event := src
+	event.EventID = utils.GenerateID(14)
+	event.CreatorID = creatorID
+	event.Status = structs.EventStatusDraft
+	event.PublishAt = nil
+	event.PostponedFrom = nil
+	event.StatusReason = ""
+	event.StatusChangedAt = &now
+	event.Recurrence = nil
+	event.SeriesID = ""
+	event.Detached = false
+	event.RecurrenceID = nil
+	event.ExternalID = "" // Belongs to the imported original; unique per creator
+	event.Tickets = nil
+	event.Merch = nil
+	event.MinPrice, event.MaxPrice = nil, nil
+	event.TicketsSold = 0
+	event.CreatedAt = now
+	event.UpdatedAt = now
+	if req.Title != "" {
+		event.Title = req.Title
+	}
+	if event.FAQs == nil {
+		event.FAQs = []structs.FAQ{}
+	}
+
+	start := req.StartDateTime.UTC()
+	end := start.Add(src.EndDateTime.Sub(src.StartDateTime))
+	if req.EndDateTime != nil {
+		end = req.EndDateTime.UTC()
+	}
+	if end.Before(start) {
+		end = start
+	}
+	event.Date = start
+	event.StartDateTime = start
+	event.EndDateTime = end
+
+	if src.BannerImage != "" {
+		banner := event.EventID + ".jpg"
+		event.BannerImage = cloneUpload(filepath.Join(eventpicUploadPath, "banner"), src.BannerImage, banner)
+		if event.BannerImage == banner {
+			copyUpload(filepath.Join(eventpicUploadPath, "banner", "thumb"), src.EventID+".jpg", banner)
+		}
+	}
+	if src.SeatingPlanImage != "" {
+		event.SeatingPlanImage = cloneUpload(filepath.Join(eventpicUploadPath, "seating"), src.SeatingPlanImage, event.EventID+"seating.jpg")
+	}
+
+	if _, err := db.EventsCollection.InsertOne(ctx, event); err != nil {
+		return event, fmt.Errorf("saving event: %w", err)
+	}
+	userdata.SetUserData("event", event.EventID, creatorID)
+
+	if err := copyTicketInventory(snap.Tickets, event.EventID); err != nil {
+		return event, fmt.Errorf("copying tickets: %w", err)
+	}
+	tickets.RefreshEventPriceRange(event.EventID)
+
+	if len(snap.Merch) > 0 {
+		docs := make([]any, 0, len(snap.Merch))
+		for _, m := range snap.Merch {
+			oldID := m.MerchID
+			m.ID = primitive.NilObjectID
+			m.MerchID = utils.GenerateID(14)
+			m.EntityID = event.EventID
+			m.EntityType = "event"
+			m.CreatedAt, m.UpdatedAt = now, now
+			if m.MerchPhoto != "" {
+				m.MerchPhoto = cloneUpload(merchUploadPath, m.MerchPhoto, m.MerchID+filepath.Ext(m.MerchPhoto))
+				copyUpload(filepath.Join(merchUploadPath, "thumb"), oldID+".jpg", m.MerchID+".jpg")
+			}
+			docs = append(docs, m)
+		}
+		if _, err := db.MerchCollection.InsertMany(ctx, docs); err != nil {
+			return event, fmt.Errorf("copying merch: %w", err)
+		}
+	}
+
+	if len(snap.Media) > 0 {
+		docs := make([]any, 0, len(snap.Media))
+		for _, m := range snap.Media {
+			oldID := m.ID
+			m.ID = "e" + utils.GenerateID(16)
+			m.EntityID = event.EventID
+			m.EntityType = "event"
+			m.CreatorID = creatorID
+			m.LikesCount, m.CommentsCount = 0, 0
+			m.CreatedAt, m.UpdatedAt = now, now
+			if m.URL != "" {
+				m.URL = cloneUpload(mediaUploadPath, m.URL, m.ID+filepath.Ext(m.URL))
+			}
+			// Poster frame and thumbnail are keyed by media ID
+			copyUpload(mediaUploadPath, oldID+".jpg", m.ID+".jpg")
+			copyUpload(filepath.Join(mediaUploadPath, "thumb"), oldID+".jpg", m.ID+".jpg")
+			docs = append(docs, m)
+			userdata.SetUserData("media", m.ID, creatorID)
+		}
+		if _, err := db.MediaCollection.InsertMany(ctx, docs); err != nil {
+			return event, fmt.Errorf("copying media: %w", err)
+		}
+	}
+
+	return event, nil
+}
+
+// cloneUpload copies the upload a document field names and returns the
+// value the copy's field should hold: the new name, the old value if it is a
+// link rather than a file in dir, or "" if the copy failed
+func cloneUpload(dir, from, to string) string {
+	if strings.ContainsAny(from, `/\`) {
+		return from
+	}
+	if !copyUpload(dir, from, to) {
+		return ""
+	}
+	return to
+}
+
+// copyUpload duplicates an uploaded file within dir and reports whether it
+// did. Missing files are skipped, since not every document has every
+// derived image.
+func copyUpload(dir, from, to string) bool {
+	if from == "" || from == to || strings.ContainsAny(from, `/\`) {
+		return false
+	}
+	in, err := os.Open(filepath.Join(dir, from))
+	if err != nil {
+		return false
+	}
+	defer in.Close()
+
+	out, err := os.Create(filepath.Join(dir, to))
+	if err != nil {
+		log.Printf("Error copying %s: %v", from, err)
+		return false
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		log.Printf("Error copying %s: %v", from, err)
+		os.Remove(filepath.Join(dir, to))
+		return false
+	}
+	return true
+}
+
+func decodeCloneRequest(r *http.Request) (cloneRequest, error) {
+	var req cloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid request body")
+	}
+	if req.StartDateTime == nil || req.StartDateTime.IsZero() {
+		return req, fmt.Errorf("start_date_time is required")
+	}
+	if req.EndDateTime != nil && req.EndDateTime.Before(*req.StartDateTime) {
+		return req, fmt.Errorf("end_date_time must be after start_date_time")
+	}
+	return req, nil
+}
+
+// CloneEvent duplicates an event into a new draft with new dates
+func CloneEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	req, err := decodeCloneRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := loadEventSnapshot(eventID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Event not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to load event", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	event, err := instantiateSnapshot(snap, requestingUserID, req)
+	if err != nil {
+		log.Printf("Error cloning event %s: %v", eventID, err)
+		http.Error(w, "Failed to clone event", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, event)
+}
+
+// SaveEventTemplate stores an event and its related documents as a template
+func SaveEventTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	snap, err := loadEventSnapshot(eventID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Event not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to load event", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = snap.Event.Title
+	}
+
+	tmpl := structs.EventTemplate{
+		TemplateID: utils.GenerateID(12),
+		Name:       name,
+		CreatorID:  requestingUserID,
+		Event:      snap.Event,
+		Tickets:    snap.Tickets,
+		Merch:      snap.Merch,
+		Media:      snap.Media,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	if _, err := db.EventTemplatesCollection.InsertOne(context.TODO(), tmpl); err != nil {
+		http.Error(w, "Failed to save template", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, tmpl)
+}
+
+// GetEventTemplates lists the caller's templates, newest first
+func GetEventTemplates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := db.EventTemplatesCollection.Find(context.TODO(), bson.M{"creatorid": requestingUserID}, opts)
+	if err != nil {
+		http.Error(w, "Failed to fetch templates", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	templates := []structs.EventTemplate{}
+	if err := cursor.All(context.TODO(), &templates); err != nil {
+		http.Error(w, "Failed to decode templates", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, templates)
+}
+
+// CreateEventFromTemplate creates a new draft event from one of the caller's templates
+func CreateEventFromTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	templateID := ps.ByName("templateid")
+
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	req, err := decodeCloneRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var tmpl structs.EventTemplate
+	err = db.EventTemplatesCollection.FindOne(context.TODO(),
+		bson.M{"templateid": templateID, "creatorid": requestingUserID}).Decode(&tmpl)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to load template", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	snap := eventSnapshot{Event: tmpl.Event, Tickets: tmpl.Tickets, Merch: tmpl.Merch, Media: tmpl.Media}
+	event, err := instantiateSnapshot(snap, requestingUserID, req)
+	if err != nil {
+		log.Printf("Error creating event from template %s: %v", templateID, err)
+		http.Error(w, "Failed to create event", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, event)
+}
+
+// DeleteEventTemplate removes one of the caller's templates
+func DeleteEventTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.EventTemplatesCollection.DeleteOne(context.TODO(),
+		bson.M{"templateid": ps.ByName("templateid"), "creatorid": requestingUserID})
+	if err != nil {
+		http.Error(w, "Failed to delete template", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Template deleted"})
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"naevis/analytics"
 	"naevis/db"
+	"naevis/settings"
 	"naevis/structs"
+	"naevis/trash"
 	"naevis/utils"
 	"net/http"
-	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,67 +18,63 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// GetEventsCount returns how many events match the same filters as GetEvents
 func GetEventsCount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	var ciount int = 3
-	utils.SendJSONResponse(w, http.StatusOK, ciount)
+	query, err := parseEventListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := db.EventsCollection.CountDocuments(context.TODO(), query.Filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, count)
 }
 
+// GetEvents lists public events. See parseEventListQuery for the supported
+// filters. When more results exist, the cursor for the next page is returned
+// in the X-Next-Cursor header.
 func GetEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Set the response header to indicate JSON content type
 	w.Header().Set("Content-Type", "application/json")
 
-	// Parse pagination query parameters (page and limit)
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-
-	// Default values for pagination
-	page := 1
-	limit := 10
-
-	// Parse page and limit, using defaults if invalid
-	if pageStr != "" {
-		if parsedPage, err := strconv.Atoi(pageStr); err == nil {
-			page = parsedPage
-		}
-	}
-
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil {
-			limit = parsedLimit
-		}
+	query, err := parseEventListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Calculate skip value based on page and limit
-	skip := (page - 1) * limit
-
-	// Convert limit and skip to int64
-	int64Limit := int64(limit)
-	int64Skip := int64(skip)
-
-	// Get the collection
-	// collection := client.Database("eventdb").Collection("events")
-
-	// Create the sort order (descending by createdAt)
-	sortOrder := bson.D{{Key: "created_at", Value: -1}}
+	// Fetch one extra event to know whether another page exists
+	opts := options.Find().
+		SetSort(query.Sort.mongoSort()).
+		SetSkip(int64(query.Skip)).
+		SetLimit(int64(query.Limit + 1))
 
-	// Find events with pagination and sorting
-	cursor, err := db.EventsCollection.Find(context.TODO(), bson.M{}, &options.FindOptions{
-		Skip:  &int64Skip,
-		Limit: &int64Limit,
-		Sort:  sortOrder,
-	})
+	cursor, err := db.EventsCollection.Find(context.TODO(), query.Filter, opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer cursor.Close(context.TODO())
 
-	var events []structs.Event
+	events := []structs.Event{}
 	if err = cursor.All(context.TODO(), &events); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	//add eventcount logic here
+
+	if len(events) > query.Limit {
+		events = events[:query.Limit]
+		w.Header().Set("X-Next-Cursor", encodeEventCursor(query.SortName, events[len(events)-1]))
+	}
+
+	displayTZ := settings.DisplayTimeZone(r)
+	for i := range events {
+		events[i].Localize(displayTZ)
+	}
 
 	// Encode the list of events as JSON and write to the response
 	if err := json.NewEncoder(w).Encode(events); err != nil {
@@ -191,6 +189,7 @@ func GetEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Aggregation pipeline to fetch event along with related tickets, media, and merch
 	pipeline := mongo.Pipeline{
 		bson.D{{Key: "$match", Value: bson.D{{Key: "eventid", Value: id}}}},
+		trash.LiveStage(),
 		bson.D{{Key: "$lookup", Value: bson.D{
 			{Key: "from", Value: "ticks"},
 			{Key: "localField", Value: "eventid"},
@@ -257,6 +256,14 @@ func GetEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	if isEventHidden(event.Status) && !canViewHiddenEvent(r, event) {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	analytics.TrackView(w, r, id)
+	event.Localize(settings.DisplayTimeZone(r))
+
 	// Encode the event as JSON and write to response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(event); err != nil {
@@ -56,9 +56,45 @@ func CreateEvent(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	event.CreatorID = requestingUserID
 	event.CreatedAt = time.Now().UTC() // ✅ Ensure UTC timestamp
 	event.Date = event.Date.UTC()      // ✅ Force UTC before saving
-	event.Status = "active"
 	event.FAQs = []structs.FAQ{}
 
+	// New events may start as drafts or be scheduled for later; default is published
+	switch event.Status {
+	case "", structs.EventStatusLegacy, structs.EventStatusPublished:
+		event.Status = structs.EventStatusPublished
+		event.PublishAt = nil
+	case structs.EventStatusDraft:
+		event.PublishAt = nil
+	case structs.EventStatusScheduled:
+		if event.PublishAt == nil || !event.PublishAt.After(event.CreatedAt) {
+			http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		t := event.PublishAt.UTC()
+		event.PublishAt = &t
+	default:
+		http.Error(w, "Invalid initial status", http.StatusBadRequest)
+		return
+	}
+	event.StatusChangedAt = &event.CreatedAt
+
+	// Events default to their venue's zone; times are always stored in UTC
+	if event.TimeZone == "" {
+		event.TimeZone = placeTimeZone(event.PlaceID)
+	}
+	if event.TimeZone == "" {
+		event.TimeZone = "UTC"
+	}
+	if !structs.ValidTimeZone(event.TimeZone) {
+		http.Error(w, "timezone must be an IANA time zone such as Europe/Berlin", http.StatusBadRequest)
+		return
+	}
+	event.StartDateTime = event.StartDateTime.UTC()
+	event.EndDateTime = event.EndDateTime.UTC()
+
+	event.Geo = placeGeo(event.PlaceID)
+	event.MinPrice, event.MaxPrice, event.TicketsSold = nil, nil, 0
+
 	// Generate a unique EventID
 	event.EventID = utils.GenerateID(14)
 
@@ -188,10 +224,13 @@ func CreateEvent(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	userdata.SetUserData("event", event.EventID, requestingUserID)
 
-	// ✅ Emit event for messaging queue (if needed)
-	go mq.Emit("event-created", mq.Index{
-		EntityType: "event", EntityId: event.EventID, Method: "POST",
-	})
+	// ✅ Emit event for messaging queue (if needed). Drafts and scheduled
+	// events are indexed once they are published.
+	if event.Status == structs.EventStatusPublished {
+		go mq.Emit("event-created", mq.Index{
+			EntityType: "event", EntityId: event.EventID, Method: "POST",
+		})
+	}
 
 	// ✅ Respond with created event
 	w.WriteHeader(http.StatusCreated)
@@ -5,9 +5,9 @@ import (
 	"io"
 	"log"
 	"naevis/db"
-	"naevis/globals"
 	"naevis/mq"
 	"naevis/structs"
+	"naevis/trash"
 	"naevis/userdata"
 	"naevis/utils"
 	"net/http"
@@ -18,6 +18,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func EditEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -42,6 +43,12 @@ func EditEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	if placeID, ok := updateFields["placeid"].(string); ok {
+		if geo := placeGeo(placeID); geo != nil {
+			updateFields["geo"] = geo
+		}
+	}
+
 	// Handle the banner image upload (if present)
 	bannerFile, _, err := r.FormFile("event-banner")
 	if err != nil && err != http.ErrMissingFile {
@@ -188,51 +195,51 @@ func EditEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	utils.SendJSONResponse(w, http.StatusOK, updatedEvent)
 }
 
-// Handle deleting event
+// DeleteEvent moves an event to the trash. A series master takes its
+// occurrences with it. Tickets, media and the rest are kept until the purge
+// job so the event can be restored; see PurgeDeletedEvents.
 func DeleteEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	eventID := ps.ByName("eventid")
 
-	// Get the ID of the requesting user from the context
-	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
-	if !ok {
-		http.Error(w, "Invalid user", http.StatusBadRequest)
-		return
-	}
-
-	// Get the event details to verify the creator
-	// collection := client.Database("eventdb").Collection("events")
+	// Get the event details; the route only lets owners through
 	var event structs.Event
-	err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID}).Decode(&event)
+	err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": eventID})).Decode(&event)
 	if err != nil {
 		http.Error(w, "Event not found", http.StatusNotFound)
 		return
 	}
 
-	// Check if the requesting user is the creator of the event
-	if event.CreatorID != requestingUserID {
-		log.Printf("User %s attempted to delete an event they did not create. structs.EventID: %s", requestingUserID, eventID)
-		http.Error(w, "Unauthorized to delete this event", http.StatusForbidden)
-		return
+	now := time.Now().UTC()
+	filter := bson.M{"eventid": eventID}
+	if event.Recurrence != nil {
+		filter = bson.M{"$or": bson.A{bson.M{"eventid": eventID}, bson.M{"seriesid": eventID}}}
 	}
-
-	// Delete the event from MongoDB
-	_, err = db.EventsCollection.DeleteOne(context.TODO(), bson.M{"eventid": eventID})
+	cursor, err := db.EventsCollection.Find(context.TODO(), trash.Live(filter), options.Find().SetProjection(bson.M{"eventid": 1}))
 	if err != nil {
 		http.Error(w, "error deleting event", http.StatusInternalServerError)
 		return
 	}
+	var trashed []structs.Event
+	if err := cursor.All(context.TODO(), &trashed); err != nil {
+		http.Error(w, "error deleting event", http.StatusInternalServerError)
+		return
+	}
 
-	// Delete related data (tickets, media, merch)
-	if err := deleteRelatedData(eventID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := db.EventsCollection.UpdateMany(context.TODO(), trash.Live(filter), bson.M{"$set": bson.M{trash.Field: now}}); err != nil {
+		http.Error(w, "error deleting event", http.StatusInternalServerError)
 		return
 	}
 
-	userdata.DelUserData("event", event.EventID, requestingUserID)
+	userdata.DelUserData("event", event.EventID, event.CreatorID)
 
-	m := mq.Index{EntityType: "event", EntityId: eventID, Method: "DELETE"}
-	go mq.Emit("event-deleted", m)
+	// Drop them from search now; restoring adds them back
+	for _, e := range trashed {
+		go mq.Emit("event-deleted", mq.Index{EntityType: "event", EntityId: e.EventID, Method: "DELETE"})
+	}
 
 	// Send success response
-	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Event deleted successfully"})
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"message":  "Event moved to trash",
+		"purge_at": now.Add(trash.Retention),
+	})
 }
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"context"
+	"naevis/db"
+	"naevis/ical"
+	"naevis/structs"
+	"naevis/trash"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetEventICS exports a single event as an .ics file. Drafts and scheduled
+// events are only exported for their team, as with GetEvent.
+func GetEventICS(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": eventID})).Decode(&event); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if isEventHidden(event.Status) && !canViewHiddenEvent(r, event) {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	cal := ical.Calendar{Name: event.Title, Events: []ical.Event{ical.FromEvent(event)}}
+	cal.Serve(w, event.EventID+".ics")
+}
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"naevis/db"
+	"naevis/structs"
 	"net/http"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func updateEventFields(r *http.Request) (bson.M, error) {
@@ -34,6 +36,7 @@ func updateEventFields(r *http.Request) (bson.M, error) {
 		PlaceId     string `json:"placeid"`
 		PlaceName   string `json:"placename"`
 		Description string `json:"description"`
+		TimeZone    string `json:"timezone"`
 	}
 
 	// Decode the JSON
@@ -67,6 +70,12 @@ func updateEventFields(r *http.Request) (bson.M, error) {
 	if eventData.Description != "" {
 		updateFields["description"] = eventData.Description
 	}
+	if eventData.TimeZone != "" {
+		if !structs.ValidTimeZone(eventData.TimeZone) {
+			return nil, fmt.Errorf("timezone must be an IANA time zone such as Europe/Berlin")
+		}
+		updateFields["timezone"] = eventData.TimeZone
+	}
 
 	return updateFields, nil
 }
@@ -193,5 +202,16 @@ func deleteRelatedData(eventID string) error {
 		return fmt.Errorf("error deleting related merch")
 	}
 
+	_, err = db.EventQuestionsCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID})
+	if err != nil {
+		return fmt.Errorf("error deleting related questions")
+	}
+
+	for _, coll := range []*mongo.Collection{db.StagesCollection, db.SessionsCollection, db.ScheduleStarsCollection} {
+		if _, err := coll.DeleteMany(context.TODO(), bson.M{"eventid": eventID}); err != nil {
+			return fmt.Errorf("error deleting related schedule")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+	"naevis/structs"
+	"naevis/tickets"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureEventIndexes creates the indexes backing event listing, filtering and
+// sorting, then fills listing fields on events created before they existed.
+func EnsureEventIndexes() {
+	ctx := context.TODO()
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "eventid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// One per sort order, led by status since every listing filters on it
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}, {Key: "eventid", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "date", Value: 1}, {Key: "eventid", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "tickets_sold", Value: -1}, {Key: "eventid", Value: -1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "artists", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "min_price", Value: 1}, {Key: "max_price", Value: 1}}},
+		{Keys: bson.D{{Key: "seriesid", Value: 1}, {Key: "start_date_time", Value: 1}}},
+		{Keys: bson.D{{Key: "geo", Value: "2dsphere"}}},
+	}
+	if _, err := db.EventsCollection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Printf("Error creating event indexes: %v", err)
+	}
+
+	if _, err := db.TicketsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "eventid", Value: 1}, {Key: "ticketid", Value: 1}},
+	}); err != nil {
+		log.Printf("Error creating ticket indexes: %v", err)
+	}
+
+	if _, err := db.EventQuestionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "eventid", Value: 1}, {Key: "upvotes", Value: -1}, {Key: "created_at", Value: -1}},
+	}); err != nil {
+		log.Printf("Error creating question indexes: %v", err)
+	}
+
+	if _, err := db.SessionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "eventid", Value: 1}, {Key: "start", Value: 1}}},
+		{Keys: bson.D{{Key: "eventid", Value: 1}, {Key: "stageid", Value: 1}, {Key: "start", Value: 1}}},
+		{Keys: bson.D{{Key: "artists", Value: 1}, {Key: "end", Value: 1}}},
+	}); err != nil {
+		log.Printf("Error creating session indexes: %v", err)
+	}
+	if _, err := db.ScheduleStarsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userid", Value: 1}, {Key: "eventid", Value: 1}, {Key: "sessionid", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		log.Printf("Error creating schedule star indexes: %v", err)
+	}
+
+	backfillEventListingFields()
+}
+
+// backfillEventListingFields sets tickets_sold, geo and the price range on
+// events that predate them. Later changes keep the fields current.
+func backfillEventListingFields() {
+	ctx := context.TODO()
+
+	cursor, err := db.EventsCollection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"tickets_sold": bson.M{"$exists": false}},
+		bson.M{"geo": bson.M{"$exists": false}, "placeid": bson.M{"$nin": bson.A{"", nil}}},
+	}})
+	if err != nil {
+		log.Printf("Error finding events to backfill: %v", err)
+		return
+	}
+	var pending []structs.Event
+	if err := cursor.All(ctx, &pending); err != nil {
+		log.Printf("Error decoding events to backfill: %v", err)
+		return
+	}
+
+	for _, e := range pending {
+		set := bson.M{}
+		sold, err := db.PurchasedTicketsCollection.CountDocuments(ctx, bson.M{"eventid": e.EventID})
+		if err == nil {
+			set["tickets_sold"] = sold
+		}
+		if e.Geo == nil {
+			if geo := placeGeo(e.PlaceID); geo != nil {
+				set["geo"] = geo
+			}
+		}
+		if _, err := db.EventsCollection.UpdateOne(ctx, bson.M{"eventid": e.EventID}, bson.M{"$set": set}); err != nil {
+			log.Printf("Error backfilling event %s: %v", e.EventID, err)
+		}
+	}
+
+	withTickets, err := db.TicketsCollection.Distinct(ctx, "eventid", bson.M{})
+	if err != nil {
+		return
+	}
+	unpriced, err := db.EventsCollection.Distinct(ctx, "eventid", bson.M{
+		"eventid":   bson.M{"$in": withTickets},
+		"min_price": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return
+	}
+	for _, id := range unpriced {
+		if eventID, ok := id.(string); ok {
+			tickets.RefreshEventPriceRange(eventID)
+		}
+	}
+}
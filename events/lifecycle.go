@@ -0,0 +1,341 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"naevis/db"
+	"naevis/middleware"
+	"naevis/mq"
+	"naevis/notifications"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// eventTransitions lists the states reachable from each state. Cancelled and
+// completed are terminal.
+var eventTransitions = map[string][]string{
+	structs.EventStatusDraft:     {structs.EventStatusScheduled, structs.EventStatusPublished, structs.EventStatusCancelled},
+	structs.EventStatusScheduled: {structs.EventStatusDraft, structs.EventStatusPublished, structs.EventStatusCancelled},
+	structs.EventStatusPublished: {structs.EventStatusPostponed, structs.EventStatusCancelled, structs.EventStatusCompleted},
+	structs.EventStatusPostponed: {structs.EventStatusPublished, structs.EventStatusPostponed, structs.EventStatusCancelled, structs.EventStatusCompleted},
+}
+
+// hiddenEventStatuses are never shown in listings or search
+var hiddenEventStatuses = bson.A{structs.EventStatusDraft, structs.EventStatusScheduled}
+
+// normalizeEventStatus maps legacy and empty statuses onto the lifecycle
+func normalizeEventStatus(status string) string {
+	if status == "" || status == structs.EventStatusLegacy {
+		return structs.EventStatusPublished
+	}
+	return status
+}
+
+func canTransition(from, to string) bool {
+	for _, s := range eventTransitions[normalizeEventStatus(from)] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isEventHidden reports whether only the creator may see the event
+func isEventHidden(status string) bool {
+	return status == structs.EventStatusDraft || status == structs.EventStatusScheduled
+}
+
+// canViewHiddenEvent checks the optional bearer token against the event team
+func canViewHiddenEvent(r *http.Request, event structs.Event) bool {
+	claims, err := middleware.ValidateJWT(r.Header.Get("Authorization"))
+	return err == nil && middleware.HasEventPermission(event.EventID, claims.UserID, middleware.PermEventView)
+}
+
+type statusChangeRequest struct {
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	NewStart  *time.Time `json:"new_start,omitempty"`
+	NewEnd    *time.Time `json:"new_end,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// ChangeEventStatus moves an event through its lifecycle
+func ChangeEventStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	var req statusChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID}).Decode(&event); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Event not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	from := normalizeEventStatus(event.Status)
+	if !canTransition(from, req.Status) {
+		http.Error(w, fmt.Sprintf("Cannot change status from %s to %s", from, req.Status), http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	set := bson.M{
+		"status":            req.Status,
+		"status_changed_at": now,
+		"updated_at":        now,
+	}
+	unset := bson.M{}
+	if req.Reason != "" {
+		set["status_reason"] = req.Reason
+	} else {
+		unset["status_reason"] = ""
+	}
+
+	switch req.Status {
+	case structs.EventStatusScheduled:
+		if req.PublishAt == nil || !req.PublishAt.After(now) {
+			http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		set["publish_at"] = req.PublishAt.UTC()
+
+	case structs.EventStatusDraft, structs.EventStatusPublished:
+		unset["publish_at"] = ""
+
+	case structs.EventStatusPostponed:
+		if req.NewStart == nil || !req.NewStart.After(now) {
+			http.Error(w, "new_start must be in the future", http.StatusBadRequest)
+			return
+		}
+		newEnd := req.NewStart.Add(event.EndDateTime.Sub(event.StartDateTime))
+		if req.NewEnd != nil {
+			newEnd = *req.NewEnd
+		}
+		if newEnd.Before(*req.NewStart) {
+			http.Error(w, "new_end must be after new_start", http.StatusBadRequest)
+			return
+		}
+		set["date"] = req.NewStart.UTC()
+		set["start_date_time"] = req.NewStart.UTC()
+		set["end_date_time"] = newEnd.UTC()
+		// Keep the very first start date across repeated postponements
+		if event.PostponedFrom == nil {
+			set["postponed_from"] = event.StartDateTime
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// Guard on the previous status so a concurrent change (e.g. the scheduler) wins cleanly
+	result, err := db.EventsCollection.UpdateOne(context.TODO(),
+		bson.M{"eventid": eventID, "status": event.Status}, update)
+	if err != nil {
+		http.Error(w, "Failed to update event status", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Event status changed concurrently, retry", http.StatusConflict)
+		return
+	}
+
+	afterTransition(event, from, req.Status, req.Reason)
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"eventid": eventID,
+		"from":    from,
+		"status":  req.Status,
+	})
+}
+
+// afterTransition runs the side effects of a status change: search indexing,
+// mq events and notifying ticket holders.
+func afterTransition(event structs.Event, from, to, reason string) {
+	method := "PUT"
+	if isEventHidden(from) && to == structs.EventStatusPublished {
+		// First time the event becomes public, so index it
+		method = "POST"
+	}
+	go mq.Emit("event-"+to, mq.Index{EntityType: "event", EntityId: event.EventID, Method: method, ItemType: from})
+
+	switch to {
+	case structs.EventStatusCancelled:
+		if event.Recurrence != nil {
+			cancelSeriesOccurrences(event.EventID, reason)
+		}
+		refundEventTickets(event, reason)
+	case structs.EventStatusPostponed:
+		notifyTicketHolders(event, "event-postponed", "\""+event.Title+"\" has been postponed", reason)
+	}
+}
+
+// refundEventTickets flags every purchased ticket for refund and tells the holders
+func refundEventTickets(event structs.Event, reason string) {
+	ctx := context.TODO()
+	result, err := db.PurchasedTicketsCollection.UpdateMany(ctx,
+		bson.M{"eventid": event.EventID, "status": bson.M{"$ne": "refund_pending"}},
+		bson.M{"$set": bson.M{"status": "refund_pending"}},
+	)
+	if err != nil {
+		log.Printf("Error flagging refunds for event %s: %v", event.EventID, err)
+		return
+	}
+
+	if result.ModifiedCount > 0 {
+		go mq.Emit("ticket-refund-requested", mq.Index{EntityType: "event", EntityId: event.EventID, Method: "PUT", ItemType: "ticket"})
+	}
+
+	// Stop further sales
+	if _, err := db.TicketsCollection.UpdateMany(ctx, bson.M{"eventid": event.EventID}, bson.M{"$set": bson.M{"quantity": 0}}); err != nil {
+		log.Printf("Error closing ticket sales for event %s: %v", event.EventID, err)
+	}
+
+	notifyTicketHolders(event, "event-cancelled", "\""+event.Title+"\" has been cancelled", reason)
+}
+
+// cancelSeriesOccurrences cancels the upcoming occurrences of a cancelled series
+func cancelSeriesOccurrences(masterID, reason string) {
+	ctx := context.TODO()
+	cursor, err := db.EventsCollection.Find(ctx, bson.M{
+		"seriesid":        masterID,
+		"start_date_time": bson.M{"$gte": time.Now().UTC()},
+		"status":          bson.M{"$nin": bson.A{structs.EventStatusCancelled, structs.EventStatusCompleted}},
+	})
+	if err != nil {
+		log.Printf("Error fetching occurrences of %s: %v", masterID, err)
+		return
+	}
+	var occurrences []structs.Event
+	if err := cursor.All(ctx, &occurrences); err != nil {
+		log.Printf("Error decoding occurrences of %s: %v", masterID, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, occ := range occurrences {
+		_, err := db.EventsCollection.UpdateOne(ctx,
+			bson.M{"eventid": occ.EventID, "status": occ.Status},
+			bson.M{"$set": bson.M{"status": structs.EventStatusCancelled, "status_reason": reason, "status_changed_at": now, "updated_at": now}},
+		)
+		if err != nil {
+			log.Printf("Error cancelling occurrence %s: %v", occ.EventID, err)
+			continue
+		}
+		go mq.Emit("event-cancelled", mq.Index{EntityType: "event", EntityId: occ.EventID, Method: "PUT", ItemType: "series", ItemId: masterID})
+		refundEventTickets(occ, reason)
+	}
+}
+
+func notifyTicketHolders(event structs.Event, notifType, title, body string) {
+	holders, err := db.PurchasedTicketsCollection.Distinct(context.TODO(), "userid", bson.M{"eventid": event.EventID})
+	if err != nil {
+		log.Printf("Error fetching ticket holders for event %s: %v", event.EventID, err)
+		return
+	}
+
+	userIDs := make([]string, 0, len(holders))
+	for _, h := range holders {
+		if id, ok := h.(string); ok {
+			userIDs = append(userIDs, id)
+		}
+	}
+	notifications.SendMany(userIDs, notifType, title, body, "event", event.EventID)
+}
+
+// RunEventScheduler periodically publishes scheduled events whose publish_at
+// has passed and completes events that have ended. It never returns.
+func RunEventScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		publishDueEvents()
+		completeEndedEvents()
+		<-ticker.C
+	}
+}
+
+func publishDueEvents() {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+
+	cursor, err := db.EventsCollection.Find(ctx, trash.Live(bson.M{
+		"status":     structs.EventStatusScheduled,
+		"publish_at": bson.M{"$lte": now},
+	}))
+	if err != nil {
+		log.Printf("Scheduler: error fetching due events: %v", err)
+		return
+	}
+	var due []structs.Event
+	if err := cursor.All(ctx, &due); err != nil {
+		log.Printf("Scheduler: error decoding due events: %v", err)
+		return
+	}
+
+	for _, event := range due {
+		result, err := db.EventsCollection.UpdateOne(ctx,
+			bson.M{"eventid": event.EventID, "status": structs.EventStatusScheduled},
+			bson.M{
+				"$set":   bson.M{"status": structs.EventStatusPublished, "status_changed_at": now, "updated_at": now},
+				"$unset": bson.M{"publish_at": ""},
+			},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+		afterTransition(event, structs.EventStatusScheduled, structs.EventStatusPublished, "")
+	}
+}
+
+func completeEndedEvents() {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+
+	// Events without an end time are stored with the zero time, so skip those.
+	// Series masters stay open while they have occurrences.
+	filter := bson.M{
+		"recurrence":    bson.M{"$exists": false},
+		"status":        bson.M{"$in": bson.A{structs.EventStatusPublished, structs.EventStatusPostponed, structs.EventStatusLegacy}},
+		"end_date_time": bson.M{"$lt": now, "$gt": time.Unix(0, 0)},
+	}
+	cursor, err := db.EventsCollection.Find(ctx, trash.Live(filter))
+	if err != nil {
+		log.Printf("Scheduler: error fetching ended events: %v", err)
+		return
+	}
+	var ended []structs.Event
+	if err := cursor.All(ctx, &ended); err != nil {
+		log.Printf("Scheduler: error decoding ended events: %v", err)
+		return
+	}
+
+	for _, event := range ended {
+		result, err := db.EventsCollection.UpdateOne(ctx,
+			bson.M{"eventid": event.EventID, "status": event.Status},
+			bson.M{"$set": bson.M{"status": structs.EventStatusCompleted, "status_changed_at": now, "updated_at": now}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+		go mq.Emit("event-completed", mq.Index{EntityType: "event", EntityId: event.EventID, Method: "PUT", ItemType: normalizeEventStatus(event.Status)})
+	}
+}
@@ -0,0 +1,331 @@
+package events
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"naevis/db"
+	"naevis/structs"
+	"naevis/trash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultEventsLimit = 10
+	maxEventsLimit     = 50
+	earthRadiusKm      = 6378.1
+)
+
+// eventSort is a listing order; eventid breaks ties so cursors are stable
+type eventSort struct {
+	Field string
+	Dir   int
+}
+
+var eventSorts = map[string]eventSort{
+	"newest":  {Field: "created_at", Dir: -1},
+	"soonest": {Field: "date", Dir: 1},
+	"popular": {Field: "tickets_sold", Dir: -1},
+}
+
+func (s eventSort) mongoSort() bson.D {
+	return bson.D{{Key: s.Field, Value: s.Dir}, {Key: "eventid", Value: s.Dir}}
+}
+
+// eventCursor is the position after the last event of a page. It is handed
+// to clients base64-encoded so they treat it as opaque.
+type eventCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeEventCursor(sortName string, e structs.Event) string {
+	c := eventCursor{Sort: sortName, ID: e.EventID}
+	switch sortName {
+	case "soonest":
+		c.Value = e.Date.UTC().Format(time.RFC3339Nano)
+	case "popular":
+		c.Value = strconv.Itoa(e.TicketsSold)
+	default:
+		c.Value = e.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cursorClause matches events strictly after the cursor in the given order
+func cursorClause(raw, sortName string, sort eventSort) (bson.M, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c eventCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Sort != sortName {
+		return nil, fmt.Errorf("cursor does not match sort %q", sortName)
+	}
+
+	var value any
+	if sortName == "popular" {
+		n, err := strconv.Atoi(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		value = n
+	} else {
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		value = t
+	}
+
+	op := "$gt"
+	if sort.Dir < 0 {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{sort.Field: bson.M{op: value}},
+		bson.M{sort.Field: value, "eventid": bson.M{op: c.ID}},
+	}}, nil
+}
+
+// eventListQuery is a parsed GetEvents / GetEventsCount request
+type eventListQuery struct {
+	Filter   bson.M
+	SortName string
+	Sort     eventSort
+	Limit    int
+	Skip     int
+}
+
+// parseEventListQuery turns listing query parameters into a Mongo filter:
+//
+//	category, tags (comma separated, any match), placeid, artist,
+//	when (today, tomorrow, this_weekend, next_7_days, this_month), from, to,
+//	min_price, max_price, free, lat, lng, radius (km),
+//	sort (newest, soonest, popular), limit, cursor or page, tz
+func parseEventListQuery(q url.Values) (eventListQuery, error) {
+	out := eventListQuery{Limit: defaultEventsLimit}
+
+	// Series masters are hidden; their upcoming occurrences are listed instead.
+	// Drafts and scheduled events are only visible to their creator.
+	and := bson.A{
+		trash.Live(bson.M{}),
+		bson.M{"recurrence": bson.M{"$exists": false}},
+		bson.M{"status": bson.M{"$nin": hiddenEventStatuses}},
+		bson.M{"$or": bson.A{
+			bson.M{"seriesid": bson.M{"$exists": false}},
+			bson.M{"start_date_time": bson.M{"$gte": time.Now().UTC()}},
+		}},
+	}
+
+	if v := q.Get("category"); v != "" {
+		and = append(and, bson.M{"category": v})
+	}
+	if v := q.Get("tags"); v != "" {
+		and = append(and, bson.M{"tags": bson.M{"$in": splitList(v)}})
+	}
+	if v := q.Get("placeid"); v != "" {
+		and = append(and, bson.M{"placeid": v})
+	}
+	if v := q.Get("artist"); v != "" {
+		and = append(and, bson.M{"artists": v})
+	}
+
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return out, fmt.Errorf("invalid tz %q", tz)
+		}
+		loc = l
+	}
+	from, to, err := parseDateRange(q, time.Now().In(loc))
+	if err != nil {
+		return out, err
+	}
+
+	out.SortName = q.Get("sort")
+	if out.SortName == "" {
+		out.SortName = "newest"
+	}
+	sort, ok := eventSorts[out.SortName]
+	if !ok {
+		return out, fmt.Errorf("invalid sort %q", out.SortName)
+	}
+	out.Sort = sort
+
+	// "Soonest" only makes sense for events that have not happened yet
+	if out.SortName == "soonest" && from.IsZero() {
+		from = time.Now().UTC()
+	}
+	if !from.IsZero() || !to.IsZero() {
+		rng := bson.M{}
+		if !from.IsZero() {
+			rng["$gte"] = from.UTC()
+		}
+		if !to.IsZero() {
+			rng["$lt"] = to.UTC()
+		}
+		and = append(and, bson.M{"date": rng})
+	}
+
+	if q.Get("free") == "true" {
+		and = append(and, structs.FreeEventFilter())
+	}
+	if v := q.Get("min_price"); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p < 0 {
+			return out, fmt.Errorf("invalid min_price")
+		}
+		and = append(and, bson.M{"max_price": bson.M{"$gte": p}})
+	}
+	if v := q.Get("max_price"); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p < 0 {
+			return out, fmt.Errorf("invalid max_price")
+		}
+		and = append(and, bson.M{"min_price": bson.M{"$lte": p}})
+	}
+
+	if q.Get("lat") != "" || q.Get("lng") != "" {
+		lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+		lng, errLng := strconv.ParseFloat(q.Get("lng"), 64)
+		radius, errRadius := strconv.ParseFloat(q.Get("radius"), 64)
+		if errLat != nil || errLng != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			return out, fmt.Errorf("invalid lat/lng")
+		}
+		if errRadius != nil || radius <= 0 {
+			radius = 10
+		}
+		and = append(and, bson.M{"geo": bson.M{"$geoWithin": bson.M{
+			"$centerSphere": bson.A{bson.A{lng, lat}, radius / earthRadiusKm},
+		}}})
+	}
+
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			out.Limit = min(n, maxEventsLimit)
+		}
+	}
+
+	if raw := q.Get("cursor"); raw != "" {
+		clause, err := cursorClause(raw, out.SortName, out.Sort)
+		if err != nil {
+			return out, err
+		}
+		and = append(and, clause)
+	} else if v := q.Get("page"); v != "" {
+		// Offset paging is kept for older clients
+		if page, err := strconv.Atoi(v); err == nil && page > 1 {
+			out.Skip = (page - 1) * out.Limit
+		}
+	}
+
+	out.Filter = bson.M{"$and": and}
+	return out, nil
+}
+
+// parseDateRange resolves "when" presets or explicit from/to bounds in loc
+func parseDateRange(q url.Values, now time.Time) (from, to time.Time, err error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch q.Get("when") {
+	case "":
+	case "today":
+		return now, today.AddDate(0, 0, 1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), today.AddDate(0, 0, 2), nil
+	case "this_weekend":
+		// Saturday 00:00 to Monday 00:00; during the weekend, from now
+		daysToSat := (int(time.Saturday) - int(now.Weekday()) + 7) % 7
+		if now.Weekday() == time.Sunday {
+			daysToSat = -1
+		}
+		sat := today.AddDate(0, 0, daysToSat)
+		from = sat
+		if now.After(sat) {
+			from = now
+		}
+		return from, sat.AddDate(0, 0, 2), nil
+	case "next_7_days":
+		return now, today.AddDate(0, 0, 8), nil
+	case "this_month":
+		return now, time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, loc), nil
+	default:
+		return from, to, fmt.Errorf("invalid when %q", q.Get("when"))
+	}
+
+	if v := q.Get("from"); v != "" {
+		if from, err = parseDateParam(v, loc); err != nil {
+			return from, to, fmt.Errorf("invalid from")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parseDateParam(v, loc); err != nil {
+			return from, to, fmt.Errorf("invalid to")
+		}
+		if len(v) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1) // a bare date includes the whole day
+		}
+	}
+	return from, to, nil
+}
+
+func parseDateParam(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, loc)
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// placeGeo looks up the coordinates of a place so events can be found by radius
+func placeGeo(placeID string) *structs.GeoPoint {
+	if placeID == "" {
+		return nil
+	}
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		return nil
+	}
+	if place.Geo != nil {
+		return place.Geo
+	}
+	if place.Location.Latitude == 0 && place.Location.Longitude == 0 {
+		return nil
+	}
+	return structs.NewGeoPoint(place.Location.Latitude, place.Location.Longitude)
+}
+
+// placeTimeZone returns the zone of the event's venue, so events default to it
+func placeTimeZone(placeID string) string {
+	if placeID == "" {
+		return ""
+	}
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		return ""
+	}
+	return place.TimeZone
+}
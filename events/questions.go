@@ -0,0 +1,294 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/middleware"
+	"naevis/mq"
+	"naevis/notifications"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxQuestionLength = 1000
+
+// GetEventQuestions lists an event's questions, most upvoted first by default
+// (?sort=new for newest). Hidden questions are only shown to the event team.
+func GetEventQuestions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	var viewerID string
+	if claims, err := middleware.ValidateJWT(r.Header.Get("Authorization")); err == nil {
+		viewerID = claims.UserID
+	}
+
+	filter := bson.M{"eventid": eventID}
+	if viewerID == "" || !middleware.HasEventPermission(eventID, viewerID, middleware.PermEventEdit) {
+		filter["status"] = "visible"
+	}
+	if r.URL.Query().Get("unanswered") == "true" {
+		filter["answer"] = bson.M{"$exists": false}
+	}
+
+	sort := bson.D{{Key: "upvotes", Value: -1}, {Key: "created_at", Value: -1}}
+	if r.URL.Query().Get("sort") == "new" {
+		sort = bson.D{{Key: "created_at", Value: -1}}
+	}
+
+	cursor, err := db.EventQuestionsCollection.Find(context.TODO(), filter, options.Find().SetSort(sort).SetLimit(200))
+	if err != nil {
+		http.Error(w, "Failed to fetch questions", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	questions := []structs.EventQuestion{}
+	if err := cursor.All(context.TODO(), &questions); err != nil {
+		http.Error(w, "Failed to decode questions", http.StatusInternalServerError)
+		return
+	}
+	for i := range questions {
+		for _, u := range questions[i].Upvoters {
+			if u == viewerID {
+				questions[i].Upvoted = true
+				break
+			}
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, questions)
+}
+
+// AskEventQuestion posts a new question on an event
+func AskEventQuestion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	body.Text = strings.TrimSpace(body.Text)
+	if body.Text == "" || len(body.Text) > maxQuestionLength {
+		http.Error(w, "Question must be between 1 and 1000 characters", http.StatusBadRequest)
+		return
+	}
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": eventID})).Decode(&event); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if isEventHidden(event.Status) {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	q := structs.EventQuestion{
+		QuestionID: utils.GenerateID(12),
+		EventID:    eventID,
+		UserID:     requestingUserID,
+		Text:       body.Text,
+		Upvoters:   []string{},
+		Status:     "visible",
+		CreatedAt:  time.Now().UTC(),
+	}
+	if _, err := db.EventQuestionsCollection.InsertOne(context.TODO(), q); err != nil {
+		http.Error(w, "Failed to save question", http.StatusInternalServerError)
+		return
+	}
+
+	mq.Notify("question-asked", mq.Index{EntityType: "event", EntityId: eventID, ItemType: "question", ItemId: q.QuestionID})
+
+	utils.SendJSONResponse(w, http.StatusCreated, q)
+}
+
+// UpvoteEventQuestion adds (POST) or removes (DELETE) the caller's upvote
+func UpvoteEventQuestion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{"eventid": ps.ByName("eventid"), "questionid": ps.ByName("questionid"), "status": "visible"}
+	var update bson.M
+	if r.Method == http.MethodDelete {
+		filter["upvoters"] = requestingUserID
+		update = bson.M{"$pull": bson.M{"upvoters": requestingUserID}, "$inc": bson.M{"upvotes": -1}}
+	} else {
+		filter["upvoters"] = bson.M{"$ne": requestingUserID}
+		update = bson.M{"$addToSet": bson.M{"upvoters": requestingUserID}, "$inc": bson.M{"upvotes": 1}}
+	}
+
+	// The upvoter condition in the filter makes repeated votes a no-op
+	var q structs.EventQuestion
+	err := db.EventQuestionsCollection.FindOneAndUpdate(context.TODO(), filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&q)
+	if err != nil && err != mongo.ErrNoDocuments {
+		http.Error(w, "Failed to record vote", http.StatusInternalServerError)
+		return
+	}
+	if err == mongo.ErrNoDocuments {
+		delete(filter, "upvoters")
+		if err := db.EventQuestionsCollection.FindOne(context.TODO(), filter).Decode(&q); err != nil {
+			http.Error(w, "Question not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"questionid": q.QuestionID,
+		"upvotes":    q.Upvotes,
+		"upvoted":    r.Method != http.MethodDelete,
+	})
+}
+
+// AnswerEventQuestion records an organizer's answer and notifies the asker
+func AnswerEventQuestion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	questionID := ps.ByName("questionid")
+	requestingUserID, _ := r.Context().Value(globals.UserIDKey).(string)
+
+	var body struct {
+		Answer string `json:"answer"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Answer) == "" {
+		http.Error(w, "Answer is required", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	var q structs.EventQuestion
+	err := db.EventQuestionsCollection.FindOneAndUpdate(context.TODO(),
+		bson.M{"eventid": eventID, "questionid": questionID},
+		bson.M{"$set": bson.M{"answer": strings.TrimSpace(body.Answer), "answeredby": requestingUserID, "answered_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&q)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Question not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to save answer", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if q.UserID != requestingUserID {
+		notifications.Send(q.UserID, "question-answered", "Your question was answered", q.Answer, "event", eventID)
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, q)
+}
+
+// PromoteEventQuestion copies an answered question into the event's FAQs
+func PromoteEventQuestion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	questionID := ps.ByName("questionid")
+
+	var q structs.EventQuestion
+	err := db.EventQuestionsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "questionid": questionID}).Decode(&q)
+	if err != nil {
+		http.Error(w, "Question not found", http.StatusNotFound)
+		return
+	}
+	if q.Answer == "" {
+		http.Error(w, "Only answered questions can be added to the FAQ", http.StatusBadRequest)
+		return
+	}
+	if q.InFAQ {
+		http.Error(w, "Question is already in the FAQ", http.StatusConflict)
+		return
+	}
+
+	faq := structs.FAQ{Title: q.Text, Content: q.Answer}
+	if _, err := db.EventsCollection.UpdateOne(context.TODO(), bson.M{"eventid": eventID}, bson.M{"$push": bson.M{"faqs": faq}}); err != nil {
+		http.Error(w, "Failed to update FAQs", http.StatusInternalServerError)
+		return
+	}
+	if _, err := db.EventQuestionsCollection.UpdateOne(context.TODO(),
+		bson.M{"questionid": questionID}, bson.M{"$set": bson.M{"in_faq": true}}); err != nil {
+		http.Error(w, "Failed to update question", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, faq)
+}
+
+// ModerateEventQuestion hides or restores a question
+func ModerateEventQuestion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Status != "visible" && body.Status != "hidden") {
+		http.Error(w, "status must be visible or hidden", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.EventQuestionsCollection.UpdateOne(context.TODO(),
+		bson.M{"eventid": ps.ByName("eventid"), "questionid": ps.ByName("questionid")},
+		bson.M{"$set": bson.M{"status": body.Status}},
+	)
+	if err != nil {
+		http.Error(w, "Failed to update question", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Question not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"questionid": ps.ByName("questionid"), "status": body.Status})
+}
+
+// DeleteEventQuestion lets the asker withdraw an unanswered question, or the
+// event team remove any question
+func DeleteEventQuestion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	questionID := ps.ByName("questionid")
+
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	var q structs.EventQuestion
+	err := db.EventQuestionsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "questionid": questionID}).Decode(&q)
+	if err != nil {
+		http.Error(w, "Question not found", http.StatusNotFound)
+		return
+	}
+
+	isModerator := middleware.HasEventPermission(eventID, requestingUserID, middleware.PermEventEdit)
+	if !isModerator && (q.UserID != requestingUserID || q.Answer != "") {
+		http.Error(w, "You cannot delete this question", http.StatusForbidden)
+		return
+	}
+
+	if _, err := db.EventQuestionsCollection.DeleteOne(context.TODO(), bson.M{"questionid": questionID}); err != nil {
+		http.Error(w, "Failed to delete question", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Question deleted"})
+}
@@ -0,0 +1,613 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"naevis/db"
+	"naevis/mq"
+	"naevis/settings"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetEventRecurrence attaches a recurrence rule to an event and materializes its occurrences
+func SetEventRecurrence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	var body structs.Recurrence
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := ParseRRule(body.RRule)
+	if err != nil {
+		http.Error(w, "Invalid rrule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var master structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID}).Decode(&master); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	if master.SeriesID != "" {
+		http.Error(w, "Occurrences cannot carry their own recurrence", http.StatusBadRequest)
+		return
+	}
+	if master.StartDateTime.IsZero() {
+		http.Error(w, "Event needs a start_date_time before it can recur", http.StatusBadRequest)
+		return
+	}
+
+	for i := range body.ExDates {
+		body.ExDates[i] = body.ExDates[i].UTC()
+	}
+	master.Recurrence = &body
+
+	_, err = db.EventsCollection.UpdateOne(context.TODO(),
+		bson.M{"eventid": eventID},
+		bson.M{"$set": bson.M{"recurrence": master.Recurrence, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Error saving recurrence for event %s: %v", eventID, err)
+		http.Error(w, "Error updating event", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := syncOccurrences(master, rule)
+	if err != nil {
+		log.Printf("Error materializing occurrences for event %s: %v", eventID, err)
+		http.Error(w, "Error materializing occurrences", http.StatusInternalServerError)
+		return
+	}
+
+	go mq.Emit("event-updated", mq.Index{EntityType: "event", EntityId: eventID, Method: "PUT"})
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"success":    true,
+		"recurrence": master.Recurrence,
+		"created":    created,
+	})
+}
+
+// syncOccurrences brings the stored occurrences of a series in line with its rule.
+// Detached occurrences and occurrences with sold tickets are never removed.
+func syncOccurrences(master structs.Event, rule RRule) (int, error) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+
+	wanted := make(map[int64]time.Time)
+	// Expand in the event's zone so a 19:00 weekly event stays at 19:00 across DST changes
+	for _, start := range rule.Expand(master.StartDateTime.In(master.Zone()), master.Recurrence.ExDates) {
+		if start.After(now) {
+			wanted[start.Unix()] = start.UTC()
+		}
+	}
+
+	cursor, err := db.EventsCollection.Find(ctx, bson.M{
+		"seriesid": master.EventID,
+		"$or": bson.A{
+			bson.M{"start_date_time": bson.M{"$gt": now}},
+			bson.M{"recurrence_id": bson.M{"$gt": now}},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var existing []structs.Event
+	if err := cursor.All(ctx, &existing); err != nil {
+		return 0, err
+	}
+
+	// Occurrences fill the slot they were made for even when moved, so a
+	// detached one stands in for its slot
+	for _, occ := range existing {
+		key := occurrenceSlot(occ).Unix()
+		if _, keep := wanted[key]; keep || occ.Detached {
+			delete(wanted, key)
+			continue
+		}
+		sold, err := db.PurchasedTicketsCollection.CountDocuments(ctx, bson.M{"eventid": occ.EventID})
+		if err != nil {
+			return 0, err
+		}
+		if sold > 0 {
+			continue
+		}
+		if _, err := db.EventsCollection.DeleteOne(ctx, bson.M{"eventid": occ.EventID}); err != nil {
+			return 0, err
+		}
+		if err := deleteRelatedData(occ.EventID); err != nil {
+			return 0, err
+		}
+		go mq.Emit("event-deleted", mq.Index{EntityType: "event", EntityId: occ.EventID, Method: "DELETE"})
+	}
+
+	var templates []structs.Ticket
+	tcur, err := db.TicketsCollection.Find(ctx, bson.M{"eventid": master.EventID})
+	if err != nil {
+		return 0, err
+	}
+	if err := tcur.All(ctx, &templates); err != nil {
+		return 0, err
+	}
+
+	duration := master.EndDateTime.Sub(master.StartDateTime)
+	if duration < 0 {
+		duration = 0
+	}
+
+	created := 0
+	for _, start := range wanted {
+		occ := newOccurrence(master, start, duration)
+		if _, err := db.EventsCollection.InsertOne(ctx, occ); err != nil {
+			return created, err
+		}
+		if err := copyTicketInventory(templates, occ.EventID); err != nil {
+			return created, err
+		}
+		created++
+		go mq.Emit("event-created", mq.Index{EntityType: "event", EntityId: occ.EventID, Method: "POST", ItemType: "series", ItemId: master.EventID})
+	}
+
+	return created, nil
+}
+
+func newOccurrence(master structs.Event, start time.Time, duration time.Duration) structs.Event {
+	occ := master
+	occ.EventID = utils.GenerateID(14)
+	occ.SeriesID = master.EventID
+	occ.Recurrence = nil
+	occ.Detached = false
+	occ.RecurrenceID = &start
+	occ.ExternalID = ""
+	occ.Date = start
+	occ.StartDateTime = start
+	occ.EndDateTime = start.Add(duration)
+	occ.Tickets = nil
+	occ.Merch = nil
+	occ.TicketsSold = 0
+	occ.CreatedAt = time.Now().UTC()
+	occ.UpdatedAt = occ.CreatedAt
+	if occ.FAQs == nil {
+		occ.FAQs = []structs.FAQ{}
+	}
+	return occ
+}
+
+// occurrenceSlot is the start the series rule gave an occurrence. Occurrences
+// made before recurrence_id was stored fall back to their start.
+func occurrenceSlot(occ structs.Event) time.Time {
+	if occ.RecurrenceID != nil {
+		return occ.RecurrenceID.UTC()
+	}
+	return occ.StartDateTime
+}
+
+// copyTicketInventory gives an occurrence its own fresh stock of each ticket type
+func copyTicketInventory(templates []structs.Ticket, eventID string) error {
+	if len(templates) == 0 {
+		return nil
+	}
+	var docs []any
+	now := time.Now()
+	for _, t := range templates {
+		if t.Total == 0 {
+			t.Total = t.Quantity
+		}
+		t.ID = primitive.NilObjectID
+		t.TicketID = utils.GenerateID(12)
+		t.EventID = eventID
+		t.EntityID = eventID
+		t.Quantity = t.Total
+		t.Available = t.Total
+		t.Sold = 0
+		t.CreatedAt = now
+		t.UpdatedAt = now
+		docs = append(docs, t)
+	}
+	_, err := db.TicketsCollection.InsertMany(context.TODO(), docs)
+	return err
+}
+
+// GetEventOccurrences lists the upcoming occurrences of a recurring event
+func GetEventOccurrences(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	from := time.Now().UTC()
+	if f := r.URL.Query().Get("from"); f != "" {
+		parsed, err := time.Parse(time.RFC3339, f)
+		if err != nil {
+			http.Error(w, "invalid from, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		from = parsed.UTC()
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date_time", Value: 1}}).SetLimit(maxOccurrences)
+	cursor, err := db.EventsCollection.Find(context.TODO(), trash.Live(bson.M{
+		"seriesid":        eventID,
+		"start_date_time": bson.M{"$gte": from},
+		"status":          bson.M{"$nin": hiddenEventStatuses},
+	}), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var occurrences []structs.Event
+	if err := cursor.All(context.TODO(), &occurrences); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if occurrences == nil {
+		occurrences = []structs.Event{}
+	}
+	displayTZ := settings.DisplayTimeZone(r)
+	for i := range occurrences {
+		occurrences[i].Localize(displayTZ)
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, occurrences)
+}
+
+// occurrenceEdit is the part of an occurrence EditEventOccurrence can change.
+// Empty fields are left as they are.
+type occurrenceEdit struct {
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	Category      string    `json:"category"`
+	Location      string    `json:"location"`
+	PlaceID       string    `json:"placeid"`
+	PlaceName     string    `json:"placename"`
+	StartDateTime time.Time `json:"start_date_time"`
+	EndDateTime   time.Time `json:"end_date_time"`
+}
+
+// fields returns the edited text fields by their bson keys
+func (e occurrenceEdit) fields() bson.M {
+	set := bson.M{}
+	for key, value := range map[string]string{
+		"title":       e.Title,
+		"description": e.Description,
+		"category":    e.Category,
+		"location":    e.Location,
+		"placeid":     e.PlaceID,
+		"placename":   e.PlaceName,
+	} {
+		if value != "" {
+			set[key] = value
+		}
+	}
+	return set
+}
+
+// apply makes the text edits to an event in memory
+func (e occurrenceEdit) apply(ev *structs.Event) {
+	for _, f := range []struct {
+		to   *string
+		from string
+	}{
+		{&ev.Title, e.Title},
+		{&ev.Description, e.Description},
+		{&ev.Category, e.Category},
+		{&ev.Location, e.Location},
+		{&ev.PlaceID, e.PlaceID},
+		{&ev.PlaceName, e.PlaceName},
+	} {
+		if f.from != "" {
+			*f.to = f.from
+		}
+	}
+}
+
+// shiftTimes moves the start (and date) and end of every matched event by
+// the given shifts, so each keeps its own date. Their recurrence_id moves by
+// slotShift, which is zero unless the series rule moves with them.
+func shiftTimes(filter, set bson.M, startShift, endShift, slotShift time.Duration) (int64, error) {
+	for k, v := range set {
+		// Text such as a title starting with "$" is not a field path here
+		if text, ok := v.(string); ok {
+			set[k] = bson.M{"$literal": text}
+		}
+	}
+	set["recurrence_id"] = bson.M{"$ifNull": bson.A{"$recurrence_id", "$start_date_time"}}
+	update := mongo.Pipeline{
+		bson.D{{Key: "$set", Value: set}},
+		bson.D{{Key: "$set", Value: bson.M{
+			"start_date_time": bson.M{"$add": bson.A{"$start_date_time", startShift.Milliseconds()}},
+			"date":            bson.M{"$add": bson.A{"$start_date_time", startShift.Milliseconds()}},
+			"end_date_time":   bson.M{"$add": bson.A{"$end_date_time", endShift.Milliseconds()}},
+			"recurrence_id":   bson.M{"$add": bson.A{"$recurrence_id", slotShift.Milliseconds()}},
+		}}},
+	}
+	result, err := db.EventsCollection.UpdateMany(context.TODO(), filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// EditEventOccurrence updates one occurrence (?scope=this) or it and every later one (?scope=following)
+func EditEventOccurrence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	occurrenceID := ps.ByName("occurrenceid")
+
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = "this"
+	}
+	if scope != "this" && scope != "following" {
+		http.Error(w, "scope must be 'this' or 'following'", http.StatusBadRequest)
+		return
+	}
+
+	var body occurrenceEdit
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var occ structs.Event
+	err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": occurrenceID, "seriesid": eventID})).Decode(&occ)
+	if err != nil {
+		http.Error(w, "Occurrence not found", http.StatusNotFound)
+		return
+	}
+
+	// Time changes are applied as shifts so "following" keeps each occurrence's own date
+	var startShift, endShift time.Duration
+	if !body.StartDateTime.IsZero() {
+		startShift = body.StartDateTime.UTC().Sub(occ.StartDateTime)
+	}
+	if !body.EndDateTime.IsZero() {
+		endShift = body.EndDateTime.UTC().Sub(occ.EndDateTime)
+	} else {
+		endShift = startShift
+	}
+
+	if scope == "this" {
+		set := body.fields()
+		set["detached"] = true
+		set["updated_at"] = time.Now()
+		updated, err := shiftTimes(bson.M{"eventid": occurrenceID}, set, startShift, endShift, 0)
+		if err != nil {
+			log.Printf("Error updating occurrence %s: %v", occurrenceID, err)
+			http.Error(w, "Error updating event", http.StatusInternalServerError)
+			return
+		}
+
+		go mq.Emit("event-updated", mq.Index{EntityType: "event", EntityId: occurrenceID, Method: "PUT", ItemType: "series", ItemId: eventID})
+
+		utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+			"success": true,
+			"scope":   scope,
+			"updated": updated,
+		})
+		return
+	}
+
+	var master structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": eventID})).Decode(&master); err != nil || master.Recurrence == nil {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return
+	}
+	series, updated, err := editFollowing(master, occ, body, startShift, endShift)
+	if err != nil {
+		log.Printf("Error updating occurrences of %s: %v", eventID, err)
+		http.Error(w, "Error updating event", http.StatusInternalServerError)
+		return
+	}
+
+	go mq.Emit("event-updated", mq.Index{EntityType: "event", EntityId: occurrenceID, Method: "PUT", ItemType: "series", ItemId: series.EventID})
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"scope":    scope,
+		"updated":  updated,
+		"seriesid": series.EventID,
+	})
+}
+
+// editFollowing applies an edit to occ and every later occurrence by
+// splitting the series: the master's rule is ended just before occ, and a
+// new master carries the rule on from occ with the edit applied. Later
+// syncs of either series then agree with the occurrences already stored.
+// Editing from the first occurrence changes the whole series in place. It
+// returns the master the occurrences now belong to.
+func editFollowing(master, occ structs.Event, edit occurrenceEdit, startShift, endShift time.Duration) (structs.Event, int64, error) {
+	ctx := context.TODO()
+	rule, err := ParseRRule(master.Recurrence.RRule)
+	if err != nil {
+		return master, 0, err
+	}
+	// A detached occ may have been moved; the series splits at its slot
+	slot := occurrenceSlot(occ)
+	split := slot.After(master.StartDateTime)
+
+	// The rule from occ on, with COUNT reduced by the occurrences before it
+	tail := rule
+	if split && rule.Count > 0 {
+		for _, start := range rule.Expand(master.StartDateTime.In(master.Zone()), nil) {
+			if start.Before(slot) {
+				tail.Count--
+			}
+		}
+		if tail.Count < 1 {
+			tail.Count = 1
+		}
+	}
+	if !tail.Until.IsZero() {
+		tail.Until = tail.Until.Add(startShift)
+	}
+
+	now := time.Now().UTC()
+	next := master
+	edit.apply(&next)
+	if split {
+		next.StartDateTime = slot.Add(startShift)
+		next.EndDateTime = next.StartDateTime.Add(occ.EndDateTime.Add(endShift).Sub(occ.StartDateTime.Add(startShift)))
+	} else {
+		next.StartDateTime = master.StartDateTime.Add(startShift)
+		next.EndDateTime = master.EndDateTime.Add(endShift)
+	}
+	next.Date = next.StartDateTime
+	next.UpdatedAt = now
+	next.Recurrence = &structs.Recurrence{RRule: tail.String()}
+	for _, ex := range master.Recurrence.ExDates {
+		if !ex.Before(slot) || !split {
+			next.Recurrence.ExDates = append(next.Recurrence.ExDates, ex.Add(startShift))
+		}
+	}
+
+	if split {
+		next.EventID = utils.GenerateID(14)
+		next.ExternalID = ""
+		next.CreatedAt = now
+		next.TicketsSold = 0
+		if _, err := db.EventsCollection.InsertOne(ctx, next); err != nil {
+			return master, 0, err
+		}
+		if err := copySeriesSetup(master.EventID, next.EventID); err != nil {
+			return master, 0, err
+		}
+
+		head := rule
+		head.Count, head.Until = 0, slot.Add(-time.Second)
+		if _, err := db.EventsCollection.UpdateOne(ctx,
+			bson.M{"eventid": master.EventID},
+			bson.M{"$set": bson.M{"recurrence.rrule": head.String(), "updated_at": now}},
+		); err != nil {
+			return master, 0, err
+		}
+		go mq.Emit("event-created", mq.Index{EntityType: "event", EntityId: next.EventID, Method: "POST"})
+	} else {
+		set := edit.fields()
+		set["start_date_time"], set["date"], set["end_date_time"] = next.StartDateTime, next.Date, next.EndDateTime
+		set["recurrence"], set["updated_at"] = next.Recurrence, now
+		if _, err := db.EventsCollection.UpdateOne(ctx, bson.M{"eventid": master.EventID}, bson.M{"$set": set}); err != nil {
+			return master, 0, err
+		}
+	}
+
+	// Occurrences from occ's slot on move to the new rule. Detached ones keep
+	// their own times and edits and only follow the slot they stand in for.
+	following := bson.M{"seriesid": master.EventID, "$or": bson.A{
+		bson.M{"recurrence_id": bson.M{"$gte": slot}},
+		bson.M{"recurrence_id": bson.M{"$exists": false}, "start_date_time": bson.M{"$gte": slot}},
+	}}
+	set := edit.fields()
+	set["seriesid"], set["updated_at"] = next.EventID, now
+	updated, err := shiftTimes(bson.M{"$and": bson.A{following, bson.M{"$or": bson.A{
+		bson.M{"detached": bson.M{"$ne": true}},
+		bson.M{"eventid": occ.EventID},
+	}}}}, set, startShift, endShift, startShift)
+	if err != nil {
+		return next, 0, err
+	}
+	if _, err := shiftTimes(bson.M{"$and": bson.A{following, bson.M{"detached": true, "eventid": bson.M{"$ne": occ.EventID}}}},
+		bson.M{"seriesid": next.EventID}, 0, 0, startShift); err != nil {
+		return next, updated, err
+	}
+
+	if _, err := syncOccurrences(next, tail); err != nil {
+		return next, updated, err
+	}
+	return next, updated, nil
+}
+
+// copySeriesSetup gives a new series master the ticket types and team of
+// the series it was split from
+func copySeriesSetup(fromID, toID string) error {
+	ctx := context.TODO()
+
+	var templates []structs.Ticket
+	cursor, err := db.TicketsCollection.Find(ctx, bson.M{"eventid": fromID})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return err
+	}
+	if err := copyTicketInventory(templates, toID); err != nil {
+		return err
+	}
+
+	var members []structs.EventMember
+	cursor, err = db.EventMembersCollection.Find(ctx, bson.M{"eventid": fromID})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &members); err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	docs := make([]any, len(members))
+	for i, m := range members {
+		m.MemberID = utils.GenerateID(12)
+		m.EventID = toID
+		docs[i] = m
+	}
+	_, err = db.EventMembersCollection.InsertMany(ctx, docs)
+	return err
+}
+
+// CancelEventOccurrence removes one occurrence and records it as an exception date on the series
+func CancelEventOccurrence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	occurrenceID := ps.ByName("occurrenceid")
+
+	var occ structs.Event
+	err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": occurrenceID, "seriesid": eventID})).Decode(&occ)
+	if err != nil {
+		http.Error(w, "Occurrence not found", http.StatusNotFound)
+		return
+	}
+
+	sold, err := db.PurchasedTicketsCollection.CountDocuments(context.TODO(), bson.M{"eventid": occurrenceID})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if sold > 0 {
+		http.Error(w, "Occurrence has sold tickets and cannot be removed", http.StatusConflict)
+		return
+	}
+
+	_, err = db.EventsCollection.UpdateOne(context.TODO(),
+		bson.M{"eventid": eventID},
+		bson.M{"$addToSet": bson.M{"recurrence.exdates": occurrenceSlot(occ)}},
+	)
+	if err != nil {
+		http.Error(w, "Error updating event", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := db.EventsCollection.DeleteOne(context.TODO(), bson.M{"eventid": occurrenceID}); err != nil {
+		http.Error(w, "error deleting event", http.StatusInternalServerError)
+		return
+	}
+	if err := deleteRelatedData(occurrenceID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	go mq.Emit("event-deleted", mq.Index{EntityType: "event", EntityId: occurrenceID, Method: "DELETE", ItemType: "series", ItemId: eventID})
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Occurrence cancelled"})
+}
@@ -0,0 +1,248 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bounds for expanding rules without COUNT or UNTIL
+const (
+	maxOccurrences    = 104
+	occurrenceHorizon = 365 * 24 * time.Hour
+)
+
+// RRule is the supported subset of an RFC 5545 recurrence rule
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []time.Weekday
+	ByMonthDay []int
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// ParseRRule parses strings such as "FREQ=WEEKLY;INTERVAL=1;BYDAY=TU,TH;COUNT=10"
+func ParseRRule(s string) (RRule, error) {
+	rule := RRule{Interval: 1}
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return rule, fmt.Errorf("empty rrule")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return rule, fmt.Errorf("invalid rrule part %q", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				rule.Freq = value
+			default:
+				return rule, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid COUNT %q", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseRRuleTime(value)
+			if err != nil {
+				return rule, fmt.Errorf("invalid UNTIL %q", value)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := rruleWeekdays[d]
+				if !ok {
+					return rule, fmt.Errorf("unsupported BYDAY value %q", d)
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n < 1 || n > 31 {
+					return rule, fmt.Errorf("invalid BYMONTHDAY value %q", d)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "WKST":
+			// Weeks always start on Monday here
+		default:
+			return rule, fmt.Errorf("unsupported rrule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, fmt.Errorf("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return rule, fmt.Errorf("COUNT and UNTIL are mutually exclusive")
+	}
+	return rule, nil
+}
+
+// String formats the rule back into RRULE syntax, with UNTIL in UTC
+func (rule RRule) String() string {
+	parts := []string{"FREQ=" + rule.Freq}
+	if rule.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.Interval))
+	}
+	if rule.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.Count))
+	}
+	if !rule.Until.IsZero() {
+		parts = append(parts, "UNTIL="+rule.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(rule.ByDay) > 0 {
+		var days []string
+		for _, wd := range rule.ByDay {
+			for code, d := range rruleWeekdays {
+				if d == wd {
+					days = append(days, code)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(rule.ByMonthDay) > 0 {
+		var days []string
+		for _, d := range rule.ByMonthDay {
+			days = append(days, strconv.Itoa(d))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", value)
+}
+
+// Expand returns the occurrence start times of the rule beginning at start.
+// Exception dates are dropped after COUNT is applied, as in RFC 5545.
+func (rule RRule) Expand(start time.Time, exdates []time.Time) []time.Time {
+	until := rule.Until
+	if until.IsZero() && rule.Count == 0 {
+		until = start.Add(occurrenceHorizon)
+	}
+
+	excluded := make(map[int64]bool, len(exdates))
+	for _, ex := range exdates {
+		excluded[ex.Unix()] = true
+	}
+
+	var out []time.Time
+	produced := 0
+
+	// Each iteration handles one FREQ period; the guard stops runaway rules.
+	for period := 0; period < maxOccurrences*31; period++ {
+		candidates := rule.periodCandidates(start, period)
+		for _, c := range candidates {
+			if c.Before(start) {
+				continue
+			}
+			if !until.IsZero() && c.After(until) {
+				return out
+			}
+			produced++
+			if !excluded[c.Unix()] {
+				out = append(out, c)
+			}
+			if (rule.Count > 0 && produced >= rule.Count) || len(out) >= maxOccurrences {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// periodCandidates lists the sorted occurrence candidates within the nth period
+func (rule RRule) periodCandidates(start time.Time, n int) []time.Time {
+	step := n * rule.Interval
+	h, m, s := start.Clock()
+	loc := start.Location()
+	at := func(y int, mo time.Month, d int) time.Time {
+		return time.Date(y, mo, d, h, m, s, 0, loc)
+	}
+
+	var out []time.Time
+	switch rule.Freq {
+	case "DAILY":
+		out = append(out, start.AddDate(0, 0, step))
+
+	case "WEEKLY":
+		days := rule.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		// Monday of the start week, shifted by whole weeks
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := at(start.Year(), start.Month(), start.Day()-offset+7*step)
+		for _, wd := range days {
+			out = append(out, monday.AddDate(0, 0, (int(wd)+6)%7))
+		}
+
+	case "MONTHLY":
+		first := at(start.Year(), start.Month()+time.Month(step), 1)
+		days := rule.ByMonthDay
+		if len(days) == 0 && len(rule.ByDay) == 0 {
+			days = []int{start.Day()}
+		}
+		for _, d := range days {
+			c := at(first.Year(), first.Month(), d)
+			if c.Month() == first.Month() { // skip e.g. the 31st in shorter months
+				out = append(out, c)
+			}
+		}
+		if len(rule.ByDay) > 0 && len(rule.ByMonthDay) == 0 {
+			for c := first; c.Month() == first.Month(); c = c.AddDate(0, 0, 1) {
+				for _, wd := range rule.ByDay {
+					if c.Weekday() == wd {
+						out = append(out, c)
+					}
+				}
+			}
+		}
+
+	case "YEARLY":
+		c := at(start.Year()+step, start.Month(), start.Day())
+		if c.Month() == start.Month() {
+			out = append(out, c)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
@@ -0,0 +1,448 @@
+package events
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/ical"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Timetable is an event's stages with their sessions in start order
+type Timetable struct {
+	EventID  string            `json:"eventid"`
+	Stages   []structs.Stage   `json:"stages"`
+	Sessions []structs.Session `json:"sessions"`
+}
+
+// ScheduleConflict is a pair of starred sessions that overlap in time
+type ScheduleConflict struct {
+	SessionA string `json:"session_a"`
+	SessionB string `json:"session_b"`
+}
+
+func loadTimetable(eventID string) (Timetable, error) {
+	ctx := context.TODO()
+	tt := Timetable{EventID: eventID, Stages: []structs.Stage{}, Sessions: []structs.Session{}}
+
+	cursor, err := db.StagesCollection.Find(ctx, bson.M{"eventid": eventID},
+		options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		return tt, err
+	}
+	if err := cursor.All(ctx, &tt.Stages); err != nil {
+		return tt, err
+	}
+
+	cursor, err = db.SessionsCollection.Find(ctx, bson.M{"eventid": eventID},
+		options.Find().SetSort(bson.D{{Key: "start", Value: 1}}))
+	if err != nil {
+		return tt, err
+	}
+	if err := cursor.All(ctx, &tt.Sessions); err != nil {
+		return tt, err
+	}
+	return tt, nil
+}
+
+// findConflicts returns every overlapping pair among the sessions
+func findConflicts(sessions []structs.Session) []ScheduleConflict {
+	sorted := append([]structs.Session(nil), sessions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	conflicts := []ScheduleConflict{}
+	for i := range sorted {
+		for j := i + 1; j < len(sorted) && sorted[j].Start.Before(sorted[i].End); j++ {
+			conflicts = append(conflicts, ScheduleConflict{SessionA: sorted[i].SessionID, SessionB: sorted[j].SessionID})
+		}
+	}
+	return conflicts
+}
+
+// GetEventSchedule returns the event's timetable
+func GetEventSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": eventID})).Decode(&event); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if isEventHidden(event.Status) && !canViewHiddenEvent(r, event) {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	tt, err := loadTimetable(eventID)
+	if err != nil {
+		http.Error(w, "Failed to load schedule", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, tt)
+}
+
+// CreateStage adds a stage or room to the event
+func CreateStage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var stage structs.Stage
+	if err := json.NewDecoder(r.Body).Decode(&stage); err != nil || strings.TrimSpace(stage.Name) == "" {
+		http.Error(w, "Stage name is required", http.StatusBadRequest)
+		return
+	}
+	stage.StageID = utils.GenerateID(10)
+	stage.EventID = ps.ByName("eventid")
+
+	if _, err := db.StagesCollection.InsertOne(context.TODO(), stage); err != nil {
+		http.Error(w, "Failed to create stage", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, stage)
+}
+
+// EditStage renames or reorders a stage
+func EditStage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var body struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Order       *int    `json:"order"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	set := bson.M{}
+	if body.Name != nil && strings.TrimSpace(*body.Name) != "" {
+		set["name"] = strings.TrimSpace(*body.Name)
+	}
+	if body.Description != nil {
+		set["description"] = *body.Description
+	}
+	if body.Order != nil {
+		set["order"] = *body.Order
+	}
+	if len(set) == 0 {
+		http.Error(w, "No changes", http.StatusBadRequest)
+		return
+	}
+
+	var stage structs.Stage
+	err := db.StagesCollection.FindOneAndUpdate(context.TODO(),
+		bson.M{"eventid": ps.ByName("eventid"), "stageid": ps.ByName("stageid")},
+		bson.M{"$set": set}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&stage)
+	if err != nil {
+		http.Error(w, "Stage not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, stage)
+}
+
+// DeleteStage removes a stage; it must have no sessions left
+func DeleteStage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID, stageID := ps.ByName("eventid"), ps.ByName("stageid")
+
+	n, err := db.SessionsCollection.CountDocuments(context.TODO(), bson.M{"eventid": eventID, "stageid": stageID})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n > 0 {
+		http.Error(w, "Move or delete the stage's sessions first", http.StatusConflict)
+		return
+	}
+
+	result, err := db.StagesCollection.DeleteOne(context.TODO(), bson.M{"eventid": eventID, "stageid": stageID})
+	if err != nil {
+		http.Error(w, "Failed to delete stage", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Stage not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Stage deleted"})
+}
+
+// validateSession checks the stage exists and the slot is free on that stage
+func validateSession(s structs.Session) (int, error) {
+	if strings.TrimSpace(s.Title) == "" || s.StageID == "" {
+		return http.StatusBadRequest, fmt.Errorf("title and stageid are required")
+	}
+	if s.Start.IsZero() || !s.End.After(s.Start) {
+		return http.StatusBadRequest, fmt.Errorf("end must be after start")
+	}
+
+	ctx := context.TODO()
+	if err := db.StagesCollection.FindOne(ctx, bson.M{"eventid": s.EventID, "stageid": s.StageID}).Err(); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("unknown stage")
+	}
+
+	overlap := bson.M{
+		"eventid":   s.EventID,
+		"stageid":   s.StageID,
+		"sessionid": bson.M{"$ne": s.SessionID},
+		"start":     bson.M{"$lt": s.End},
+		"end":       bson.M{"$gt": s.Start},
+	}
+	if err := db.SessionsCollection.FindOne(ctx, overlap).Err(); err == nil {
+		return http.StatusConflict, fmt.Errorf("another session is already on this stage at that time")
+	} else if err != mongo.ErrNoDocuments {
+		return http.StatusInternalServerError, fmt.Errorf("database error")
+	}
+	return http.StatusOK, nil
+}
+
+// addEventArtists keeps Event.Artists in step with the lineup
+func addEventArtists(eventID string, artistIDs []string) {
+	if len(artistIDs) == 0 {
+		return
+	}
+	db.EventsCollection.UpdateOne(context.TODO(), bson.M{"eventid": eventID},
+		bson.M{"$addToSet": bson.M{"artists": bson.M{"$each": artistIDs}}})
+}
+
+// CreateSession adds a session to the timetable
+func CreateSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var s structs.Session
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	now := time.Now().UTC()
+	s.SessionID = utils.GenerateID(12)
+	s.EventID = ps.ByName("eventid")
+	s.Start, s.End = s.Start.UTC(), s.End.UTC()
+	s.CreatedAt, s.UpdatedAt = now, now
+	if s.ArtistIDs == nil {
+		s.ArtistIDs = []string{}
+	}
+
+	if code, err := validateSession(s); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if _, err := db.SessionsCollection.InsertOne(context.TODO(), s); err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	addEventArtists(s.EventID, s.ArtistIDs)
+
+	utils.SendJSONResponse(w, http.StatusCreated, s)
+}
+
+// EditSession replaces a session's details
+func EditSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID, sessionID := ps.ByName("eventid"), ps.ByName("sessionid")
+
+	var existing structs.Session
+	if err := db.SessionsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "sessionid": sessionID}).Decode(&existing); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	s := existing
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	s.SessionID, s.EventID, s.CreatedAt = existing.SessionID, existing.EventID, existing.CreatedAt
+	s.Start, s.End = s.Start.UTC(), s.End.UTC()
+	s.UpdatedAt = time.Now().UTC()
+	if s.ArtistIDs == nil {
+		s.ArtistIDs = []string{}
+	}
+
+	if code, err := validateSession(s); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if _, err := db.SessionsCollection.ReplaceOne(context.TODO(), bson.M{"eventid": eventID, "sessionid": sessionID}, s); err != nil {
+		http.Error(w, "Failed to update session", http.StatusInternalServerError)
+		return
+	}
+	addEventArtists(eventID, s.ArtistIDs)
+
+	utils.SendJSONResponse(w, http.StatusOK, s)
+}
+
+// DeleteSession removes a session and any stars on it
+func DeleteSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID, sessionID := ps.ByName("eventid"), ps.ByName("sessionid")
+
+	result, err := db.SessionsCollection.DeleteOne(context.TODO(), bson.M{"eventid": eventID, "sessionid": sessionID})
+	if err != nil {
+		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	db.ScheduleStarsCollection.DeleteMany(context.TODO(), bson.M{"sessionid": sessionID})
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Session deleted"})
+}
+
+// loadMySchedule returns the caller's starred sessions for an event in start order
+func loadMySchedule(eventID, userID string) ([]structs.Session, error) {
+	ctx := context.TODO()
+	ids, err := db.ScheduleStarsCollection.Distinct(ctx, "sessionid", bson.M{"eventid": eventID, "userid": userID})
+	if err != nil {
+		return nil, err
+	}
+	sessions := []structs.Session{}
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+	cursor, err := db.SessionsCollection.Find(ctx, bson.M{"sessionid": bson.M{"$in": ids}},
+		options.Find().SetSort(bson.D{{Key: "start", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &sessions)
+	return sessions, err
+}
+
+// StarSession adds (POST) or removes (DELETE) a session from the caller's
+// schedule. The response carries any time conflicts in the resulting schedule.
+func StarSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID, sessionID := ps.ByName("eventid"), ps.ByName("sessionid")
+
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	key := bson.M{"userid": requestingUserID, "eventid": eventID, "sessionid": sessionID}
+	if r.Method == http.MethodDelete {
+		if _, err := db.ScheduleStarsCollection.DeleteOne(context.TODO(), key); err != nil {
+			http.Error(w, "Failed to update schedule", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		if err := db.SessionsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "sessionid": sessionID}).Err(); err != nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		star := structs.ScheduleStar{UserID: requestingUserID, EventID: eventID, SessionID: sessionID, CreatedAt: time.Now().UTC()}
+		if _, err := db.ScheduleStarsCollection.ReplaceOne(context.TODO(), key, star, options.Replace().SetUpsert(true)); err != nil {
+			http.Error(w, "Failed to update schedule", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sessions, err := loadMySchedule(eventID, requestingUserID)
+	if err != nil {
+		http.Error(w, "Failed to load schedule", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"sessions":  sessions,
+		"conflicts": findConflicts(sessions),
+	})
+}
+
+// GetMySchedule returns the caller's starred sessions with conflict warnings
+func GetMySchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := loadMySchedule(ps.ByName("eventid"), requestingUserID)
+	if err != nil {
+		http.Error(w, "Failed to load schedule", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"sessions":  sessions,
+		"conflicts": findConflicts(sessions),
+	})
+}
+
+// ExportSchedule downloads the timetable as iCalendar (default) or CSV (?format=csv)
+func ExportSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": eventID})).Decode(&event); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if isEventHidden(event.Status) && !canViewHiddenEvent(r, event) {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	tt, err := loadTimetable(eventID)
+	if err != nil {
+		http.Error(w, "Failed to load schedule", http.StatusInternalServerError)
+		return
+	}
+
+	stageNames := make(map[string]string, len(tt.Stages))
+	for _, st := range tt.Stages {
+		stageNames[st.StageID] = st.Name
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", eventID+"-timetable.csv"))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"stage", "title", "start", "end", "artists", "description"})
+		for _, s := range tt.Sessions {
+			cw.Write([]string{
+				stageNames[s.StageID], s.Title,
+				s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339),
+				strings.Join(s.ArtistIDs, ";"), s.Description,
+			})
+		}
+		cw.Flush()
+		return
+	}
+
+	cal := ical.Calendar{Name: event.Title + " timetable"}
+	for _, s := range tt.Sessions {
+		location := stageNames[s.StageID]
+		if event.PlaceName != "" {
+			if location != "" {
+				location += ", "
+			}
+			location += event.PlaceName
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         s.SessionID + "@naevis",
+			Summary:     s.Title,
+			Description: s.Description,
+			Location:    location,
+			Start:       s.Start,
+			End:         s.End,
+			Updated:     s.UpdatedAt,
+			Status:      "CONFIRMED",
+		})
+	}
+	cal.Serve(w, eventID+"-timetable.ics")
+}
@@ -0,0 +1,284 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/middleware"
+	"naevis/notifications"
+	"naevis/structs"
+	"naevis/utils"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var validTeamRoles = map[string]bool{
+	structs.EventRoleOwner:     true,
+	structs.EventRoleManager:   true,
+	structs.EventRoleBoxOffice: true,
+	structs.EventRoleScanner:   true,
+	structs.EventRoleViewer:    true,
+}
+
+// canAssignRole reports whether a team member with role may grant target.
+// Only owners can hand out owner and manager roles.
+func canAssignRole(role, target string) bool {
+	if role == structs.EventRoleOwner {
+		return true
+	}
+	return role == structs.EventRoleManager &&
+		target != structs.EventRoleOwner && target != structs.EventRoleManager
+}
+
+// GetEventTeam lists the event's members and pending invitations
+func GetEventTeam(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID}).Decode(&event); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	cursor, err := db.EventMembersCollection.Find(context.TODO(), bson.M{"eventid": eventID})
+	if err != nil {
+		http.Error(w, "Failed to fetch team", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	members := []structs.EventMember{}
+	if err := cursor.All(context.TODO(), &members); err != nil {
+		http.Error(w, "Failed to decode team", http.StatusInternalServerError)
+		return
+	}
+
+	// The creator is listed first as the implicit owner
+	team := append([]structs.EventMember{{
+		EventID:   eventID,
+		UserID:    event.CreatorID,
+		Role:      structs.EventRoleOwner,
+		Status:    "accepted",
+		CreatedAt: event.CreatedAt,
+	}}, members...)
+
+	utils.SendJSONResponse(w, http.StatusOK, team)
+}
+
+// InviteEventMember invites another user to the event team
+func InviteEventMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	requestingUserID, _ := r.Context().Value(globals.UserIDKey).(string)
+
+	var body struct {
+		UserID string `json:"userid"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserID == "" {
+		http.Error(w, "userid and role are required", http.StatusBadRequest)
+		return
+	}
+	if !validTeamRoles[body.Role] {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	callerRole, err := middleware.EventRole(eventID, requestingUserID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !canAssignRole(callerRole, body.Role) {
+		http.Error(w, "You cannot grant this role", http.StatusForbidden)
+		return
+	}
+
+	if existing, _ := middleware.EventRole(eventID, body.UserID); existing != "" {
+		http.Error(w, "User is already on the team", http.StatusConflict)
+		return
+	}
+	if err := db.UserCollection.FindOne(context.TODO(), bson.M{"userid": body.UserID}).Err(); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID}).Decode(&event); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	invite := structs.EventMember{
+		MemberID:  utils.GenerateID(12),
+		EventID:   eventID,
+		UserID:    body.UserID,
+		Role:      body.Role,
+		Status:    "pending",
+		InvitedBy: requestingUserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// Re-inviting replaces an earlier pending invitation
+	_, err = db.EventMembersCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID, "userid": body.UserID, "status": "pending"})
+	if err == nil {
+		_, err = db.EventMembersCollection.InsertOne(context.TODO(), invite)
+	}
+	if err != nil {
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	notifications.Send(body.UserID, "event-team-invite",
+		"You've been invited to join the team for \""+event.Title+"\"", "Role: "+body.Role, "event", eventID)
+
+	utils.SendJSONResponse(w, http.StatusCreated, invite)
+}
+
+// GetMyEventInvites lists the caller's pending team invitations
+func GetMyEventInvites(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := db.EventMembersCollection.Find(context.TODO(), bson.M{"userid": requestingUserID, "status": "pending"})
+	if err != nil {
+		http.Error(w, "Failed to fetch invitations", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	invites := []structs.EventMember{}
+	if err := cursor.All(context.TODO(), &invites); err != nil {
+		http.Error(w, "Failed to decode invitations", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, invites)
+}
+
+// RespondEventInvite accepts or declines one of the caller's invitations
+func RespondEventInvite(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Accept bool `json:"accept"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{"memberid": ps.ByName("inviteid"), "userid": requestingUserID, "status": "pending"}
+
+	var invite structs.EventMember
+	if err := db.EventMembersCollection.FindOne(context.TODO(), filter).Decode(&invite); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var err error
+	if body.Accept {
+		_, err = db.EventMembersCollection.UpdateOne(context.TODO(), filter,
+			bson.M{"$set": bson.M{"status": "accepted", "updated_at": time.Now().UTC()}})
+	} else {
+		_, err = db.EventMembersCollection.DeleteOne(context.TODO(), filter)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update invitation", http.StatusInternalServerError)
+		return
+	}
+
+	if body.Accept {
+		notifications.Send(invite.InvitedBy, "event-team-joined", "Your team invitation was accepted", "", "event", invite.EventID)
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{"eventid": invite.EventID, "accepted": body.Accept})
+}
+
+// UpdateEventMember changes a team member's role
+func UpdateEventMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	targetID := ps.ByName("userid")
+	requestingUserID, _ := r.Context().Value(globals.UserIDKey).(string)
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !validTeamRoles[body.Role] {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	callerRole, _ := middleware.EventRole(eventID, requestingUserID)
+	var member structs.EventMember
+	err := db.EventMembersCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "userid": targetID}).Decode(&member)
+	if err != nil {
+		http.Error(w, "Team member not found", http.StatusNotFound)
+		return
+	}
+	// Changing a role requires being allowed to grant both the old and new role
+	if !canAssignRole(callerRole, member.Role) || !canAssignRole(callerRole, body.Role) {
+		http.Error(w, "You cannot change this member's role", http.StatusForbidden)
+		return
+	}
+
+	_, err = db.EventMembersCollection.UpdateOne(context.TODO(),
+		bson.M{"eventid": eventID, "userid": targetID},
+		bson.M{"$set": bson.M{"role": body.Role, "updated_at": time.Now().UTC()}})
+	if err != nil {
+		http.Error(w, "Failed to update member", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"userid": targetID, "role": body.Role})
+}
+
+// RemoveEventMember removes a member or invitation. Members may always remove themselves.
+func RemoveEventMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	targetID := ps.ByName("userid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	var member structs.EventMember
+	err := db.EventMembersCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "userid": targetID}).Decode(&member)
+	if err != nil {
+		http.Error(w, "Team member not found", http.StatusNotFound)
+		return
+	}
+
+	if targetID != requestingUserID {
+		callerRole, _ := middleware.EventRole(eventID, requestingUserID)
+		if !middleware.RoleHasPermission(callerRole, middleware.PermTeamManage) || !canAssignRole(callerRole, member.Role) {
+			http.Error(w, "You cannot remove this member", http.StatusForbidden)
+			return
+		}
+	}
+
+	if _, err := db.EventMembersCollection.DeleteMany(context.TODO(), bson.M{"eventid": eventID, "userid": targetID}); err != nil {
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Member removed"})
+}
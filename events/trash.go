@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/mq"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/userdata"
+	"naevis/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RestoreEvent brings an event (and a series' occurrences trashed with it)
+// back from the trash. Only the creator can restore, within trash.Retention.
+func RestoreEvent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	eventID := ps.ByName("eventid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	var event structs.Event
+	if err := db.EventsCollection.FindOne(context.TODO(), trash.Deleted(bson.M{"eventid": eventID})).Decode(&event); err != nil {
+		http.Error(w, "Event not found in trash", http.StatusNotFound)
+		return
+	}
+	if event.CreatorID != requestingUserID {
+		http.Error(w, "Only the event's creator can restore it", http.StatusForbidden)
+		return
+	}
+	if trash.Expired(*event.DeletedAt) {
+		http.Error(w, "This event is past the restore window", http.StatusGone)
+		return
+	}
+
+	// Occurrences deleted on their own earlier stay in the trash
+	filter := bson.M{"$or": bson.A{
+		bson.M{"eventid": eventID},
+		bson.M{"seriesid": eventID, trash.Field: event.DeletedAt},
+	}}
+	var restored []structs.Event
+	cursor, err := db.EventsCollection.Find(context.TODO(), filter)
+	if err == nil {
+		err = cursor.All(context.TODO(), &restored)
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore event", http.StatusInternalServerError)
+		return
+	}
+	if _, err := db.EventsCollection.UpdateMany(context.TODO(), filter, bson.M{"$unset": bson.M{trash.Field: ""}}); err != nil {
+		http.Error(w, "Failed to restore event", http.StatusInternalServerError)
+		return
+	}
+
+	userdata.SetUserData("event", event.EventID, event.CreatorID)
+	for _, e := range restored {
+		if !isEventHidden(e.Status) {
+			go mq.Emit("event-created", mq.Index{EntityType: "event", EntityId: e.EventID, Method: "POST"})
+		}
+	}
+
+	event.DeletedAt = nil
+	utils.SendJSONResponse(w, http.StatusOK, event)
+}
+
+// PurgeDeletedEvents permanently removes events trashed before cutoff with
+// their tickets, media, merch, schedule, team, analytics and uploaded images.
+// Purchased tickets are kept as order records.
+func PurgeDeletedEvents(cutoff time.Time) (int, error) {
+	cursor, err := db.EventsCollection.Find(context.TODO(), bson.M{trash.Field: bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	var expired []structs.Event
+	if err := cursor.All(context.TODO(), &expired); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, event := range expired {
+		if err := deleteRelatedData(event.EventID); err != nil {
+			log.Printf("Trash: error purging data of event %s: %v", event.EventID, err)
+			continue
+		}
+		db.EventMembersCollection.DeleteMany(context.TODO(), bson.M{"eventid": event.EventID})
+		db.EventAnalyticsCollection.DeleteMany(context.TODO(), bson.M{"eventid": event.EventID})
+
+		if event.BannerImage != "" {
+			os.Remove(filepath.Join(eventpicUploadPath, "banner", filepath.Base(event.BannerImage)))
+			os.Remove(filepath.Join(eventpicUploadPath, "banner", "thumb", event.EventID+".jpg"))
+		}
+		if event.SeatingPlanImage != "" {
+			os.Remove(filepath.Join(eventpicUploadPath, "seating", filepath.Base(event.SeatingPlanImage)))
+		}
+
+		if _, err := db.EventsCollection.DeleteOne(context.TODO(), bson.M{"eventid": event.EventID}); err != nil {
+			log.Printf("Trash: error purging event %s: %v", event.EventID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
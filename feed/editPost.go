@@ -8,6 +8,7 @@ import (
 	"naevis/middleware"
 	"naevis/mq"
 	"naevis/structs"
+	"naevis/trash"
 	"naevis/userdata"
 	"net/http"
 	"time"
@@ -59,7 +60,7 @@ func EditPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Check ownership of the post
 	// db.PostsCollection := client.Database("eventdb").Collection("posts")
 	var existingPost structs.Post
-	err := db.PostsCollection.FindOne(context.TODO(), bson.M{"postid": postID}).Decode(&existingPost)
+	err := db.PostsCollection.FindOne(context.TODO(), trash.Live(bson.M{"postid": postID})).Decode(&existingPost)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			http.Error(w, "Post not found", http.StatusNotFound)
@@ -147,22 +148,26 @@ func DeletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// 	return
 	// }
 
-	// Delete the post from MongoDB
-	// db.PostsCollection := client.Database("eventdb").Collection("posts")
-	result, err := db.PostsCollection.DeleteOne(context.TODO(), bson.M{"postid": postID})
+	var post structs.Post
+	err := db.PostsCollection.FindOne(context.TODO(), trash.Live(bson.M{"postid": postID})).Decode(&post)
 	if err != nil {
-		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Post not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error fetching post", http.StatusInternalServerError)
+		}
+		return
+	}
+	if post.UserID != requestingUserID {
+		http.Error(w, "Unauthorized: You can only delete your own posts", http.StatusForbidden)
 		return
 	}
 
-	// Check if the file exists
-	var existingFile FileMetadata
-	db.FilesCollection.FindOne(context.TODO(), bson.M{"postid": postID}).Decode(&existingFile)
-
-	RemoveUserFile(requestingUserID, postID, existingFile.Hash)
-
-	if result.DeletedCount == 0 {
-		http.Error(w, "Post not found", http.StatusNotFound)
+	// Move the post to the trash; its files are released by the purge job
+	// (see PurgeDeletedPosts)
+	now := time.Now().UTC()
+	if _, err := db.PostsCollection.UpdateOne(context.TODO(), bson.M{"postid": postID}, bson.M{"$set": bson.M{trash.Field: now}}); err != nil {
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 		return
 	}
 
@@ -175,7 +180,8 @@ func DeletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]any{
-		"ok":      true,
-		"message": "Post deleted successfully",
+		"ok":       true,
+		"message":  "Post moved to trash",
+		"purge_at": now.Add(trash.Retention),
 	})
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"naevis/db"
 	"naevis/structs"
+	"naevis/trash"
 	"net/http"
 	"time"
 
@@ -22,7 +23,7 @@ func GetPosts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var posts []structs.Post
 
 	// Filter to fetch all posts (can be adjusted if you need specific filtering)
-	filter := bson.M{} // Empty filter for fetching all posts
+	filter := trash.Live(bson.M{}) // All posts that are not in the trash
 
 	// Create the sort order (descending by timestamp)
 	sortOrder := bson.D{{Key: "timestamp", Value: -1}}
@@ -77,6 +78,7 @@ func GetPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Aggregation pipeline to fetch post along with related tickets, media, and merch
 	pipeline := mongo.Pipeline{
 		bson.D{{Key: "$match", Value: bson.D{{Key: "postid", Value: id}}}},
+		trash.LiveStage(),
 	}
 
 	// Execute the aggregation query
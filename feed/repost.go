@@ -8,6 +8,7 @@ import (
 
 	"naevis/db"
 	"naevis/profile"
+	"naevis/trash"
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
@@ -96,7 +97,7 @@ func Repost(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 func GetFeed(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	collection := db.PostsCollection
-	cursor, err := collection.Find(r.Context(), bson.M{})
+	cursor, err := collection.Find(r.Context(), trash.Live(bson.M{}))
 	if err != nil {
 		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
 		return
@@ -111,7 +112,7 @@ func GetFeed(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 			if post["repostOf"] != nil {
 				originalPostID := post["repostOf"].(string)
 				var originalPost bson.M
-				err := collection.FindOne(r.Context(), bson.M{"postid": originalPostID}).Decode(&originalPost)
+				err := collection.FindOne(r.Context(), trash.Live(bson.M{"postid": originalPostID})).Decode(&originalPost)
 				if err == nil {
 					post["originalPost"] = originalPost
 				}
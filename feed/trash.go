@@ -0,0 +1,98 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/mq"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/userdata"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RestorePost brings a post back from the trash. Only its author can
+// restore it, within trash.Retention.
+func RestorePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	postID := ps.ByName("postid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	var post structs.Post
+	if err := db.PostsCollection.FindOne(context.TODO(), trash.Deleted(bson.M{"postid": postID})).Decode(&post); err != nil {
+		http.Error(w, "Post not found in trash", http.StatusNotFound)
+		return
+	}
+	if post.UserID != requestingUserID {
+		http.Error(w, "Unauthorized: You can only restore your own posts", http.StatusForbidden)
+		return
+	}
+	if trash.Expired(*post.DeletedAt) {
+		http.Error(w, "This post is past the restore window", http.StatusGone)
+		return
+	}
+
+	if _, err := db.PostsCollection.UpdateOne(context.TODO(), bson.M{"postid": postID}, bson.M{"$unset": bson.M{trash.Field: ""}}); err != nil {
+		http.Error(w, "Failed to restore post", http.StatusInternalServerError)
+		return
+	}
+
+	userdata.SetUserData("feedpost", postID, requestingUserID)
+
+	m := mq.Index{EntityType: "feedpost", EntityId: postID, Method: "POST"}
+	go mq.Emit("post-created", m)
+
+	post.DeletedAt = nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok":      true,
+		"message": "Post restored",
+		"data":    post,
+	})
+}
+
+// PurgeDeletedPosts permanently removes posts trashed before cutoff and
+// releases their uploaded files
+func PurgeDeletedPosts(cutoff time.Time) (int, error) {
+	cursor, err := db.PostsCollection.Find(context.TODO(), bson.M{trash.Field: bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	var expired []structs.Post
+	if err := cursor.All(context.TODO(), &expired); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, post := range expired {
+		var files []FileMetadata
+		fc, err := db.FilesCollection.Find(context.TODO(), bson.M{"userPosts." + post.UserID: post.PostID})
+		if err == nil {
+			err = fc.All(context.TODO(), &files)
+		}
+		if err != nil {
+			log.Printf("Trash: error finding files of post %s: %v", post.PostID, err)
+			continue
+		}
+		for _, f := range files {
+			RemoveUserFile(post.UserID, post.PostID, f.Hash)
+		}
+
+		if _, err := db.PostsCollection.DeleteOne(context.TODO(), bson.M{"postid": post.PostID}); err != nil {
+			log.Printf("Trash: error purging post %s: %v", post.PostID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -1,6 +1,8 @@
 package globals
 
 import (
+	"os"
+	"strings"
 	"time"
 )
 
@@ -17,3 +19,10 @@ var (
 type ContextKey string
 
 const UserIDKey ContextKey = "userId"
+
+// FrontendURL is the base URL of the web frontend, without a trailing
+// slash, for links sent out in feeds, QR codes and notifications. It is read
+// when needed because .env is loaded after package variables are set.
+func FrontendURL() string {
+	return strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")
+}
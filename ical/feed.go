@@ -0,0 +1,163 @@
+package ical
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FeedToken maps a secret calendar feed token to its owner
+type FeedToken struct {
+	UserID    string    `json:"userid" bson:"userid"`
+	Token     string    `json:"token" bson:"token"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// FromEvent converts a stored event into a VEVENT
+func FromEvent(e structs.Event) Event {
+	start := e.StartDateTime
+	if start.IsZero() {
+		start = e.Date
+	}
+
+	location := e.PlaceName
+	if e.Location != "" {
+		if location != "" {
+			location += ", "
+		}
+		location += e.Location
+	}
+
+	ev := Event{
+		UID:         e.EventID + "@naevis",
+		Summary:     e.Title,
+		Description: e.Description,
+		Location:    location,
+		Start:       start,
+		End:         e.EndDateTime,
+		Updated:     e.UpdatedAt,
+		Status:      "CONFIRMED",
+	}
+	if e.Status == structs.EventStatusCancelled {
+		ev.Status = "CANCELLED"
+	}
+	if frontend := globals.FrontendURL(); frontend != "" {
+		ev.URL = frontend + "/event/" + e.EventID
+	}
+	return ev
+}
+
+func newFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateFeedToken issues (or rotates) the caller's personal calendar feed token.
+// Rotating invalidates any previously shared feed URL.
+func CreateFeedToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	token, err := newFeedToken()
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	feed := FeedToken{UserID: requestingUserID, Token: token, CreatedAt: time.Now()}
+	_, err = db.CalendarFeedsCollection.ReplaceOne(context.TODO(),
+		bson.M{"userid": requestingUserID}, feed, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("Error saving calendar token for %s: %v", requestingUserID, err)
+		http.Error(w, "Failed to save token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"token": token,
+		"url":   "/api/calendar/feed/" + token + ".ics",
+	})
+}
+
+// RevokeFeedToken disables the caller's personal calendar feed
+func RevokeFeedToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.CalendarFeedsCollection.DeleteOne(context.TODO(), bson.M{"userid": requestingUserID}); err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Calendar feed revoked"})
+}
+
+// GetUserFeed serves every event the token owner holds tickets for.
+// The token is the only credential, so calendar apps can subscribe without logging in.
+func GetUserFeed(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	token := strings.TrimSuffix(ps.ByName("token"), ".ics")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusNotFound)
+		return
+	}
+
+	var feed FeedToken
+	err := db.CalendarFeedsCollection.FindOne(context.TODO(), bson.M{"token": token}).Decode(&feed)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	eventIDs, err := db.PurchasedTicketsCollection.Distinct(context.TODO(), "eventid", bson.M{"userid": feed.UserID})
+	if err != nil {
+		http.Error(w, "Failed to fetch tickets", http.StatusInternalServerError)
+		return
+	}
+
+	cal := Calendar{Name: "My events"}
+	if len(eventIDs) > 0 {
+		cursor, err := db.EventsCollection.Find(context.TODO(), trash.Live(bson.M{"eventid": bson.M{"$in": eventIDs}}))
+		if err != nil {
+			http.Error(w, "Failed to fetch events", http.StatusInternalServerError)
+			return
+		}
+		var events []structs.Event
+		if err := cursor.All(context.TODO(), &events); err != nil {
+			http.Error(w, "Failed to decode events", http.StatusInternalServerError)
+			return
+		}
+		for _, e := range events {
+			cal.Events = append(cal.Events, FromEvent(e))
+		}
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	cal.Serve(w, "")
+}
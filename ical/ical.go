@@ -0,0 +1,126 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	prodID     = "-//naevis//events//EN"
+	utcLayout  = "20060102T150405Z"
+	lineLength = 75
+)
+
+// Event is a single VEVENT entry
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Status      string // TENTATIVE, CONFIRMED or CANCELLED
+	Start       time.Time
+	End         time.Time
+	Updated     time.Time
+}
+
+// Calendar is a VCALENDAR with its events
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write renders the calendar in RFC 5545 format. All times are emitted in UTC
+// so clients convert them to the viewer's zone without needing VTIMEZONE data.
+func (c Calendar) Write(w io.Writer) error {
+	b := &builder{w: w}
+	b.line("BEGIN:VCALENDAR")
+	b.line("VERSION:2.0")
+	b.line("PRODID:" + prodID)
+	b.line("CALSCALE:GREGORIAN")
+	b.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		b.line("X-WR-CALNAME:" + Escape(c.Name))
+	}
+
+	stamp := time.Now().UTC().Format(utcLayout)
+	for _, e := range c.Events {
+		b.line("BEGIN:VEVENT")
+		b.line("UID:" + Escape(e.UID))
+		b.line("DTSTAMP:" + stamp)
+		b.line("DTSTART:" + e.Start.UTC().Format(utcLayout))
+		if !e.End.IsZero() && e.End.After(e.Start) {
+			b.line("DTEND:" + e.End.UTC().Format(utcLayout))
+		}
+		if !e.Updated.IsZero() {
+			b.line("LAST-MODIFIED:" + e.Updated.UTC().Format(utcLayout))
+		}
+		b.line("SUMMARY:" + Escape(e.Summary))
+		if e.Description != "" {
+			b.line("DESCRIPTION:" + Escape(e.Description))
+		}
+		if e.Location != "" {
+			b.line("LOCATION:" + Escape(e.Location))
+		}
+		if e.URL != "" {
+			b.line("URL:" + e.URL)
+		}
+		if e.Status != "" {
+			b.line("STATUS:" + e.Status)
+		}
+		b.line("END:VEVENT")
+	}
+
+	b.line("END:VCALENDAR")
+	return b.err
+}
+
+// Serve writes the calendar as a downloadable text/calendar response
+func (c Calendar) Serve(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	w.WriteHeader(http.StatusOK)
+	c.Write(w)
+}
+
+// Escape escapes TEXT values as required by RFC 5545 section 3.3.11
+func Escape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return r.Replace(s)
+}
+
+type builder struct {
+	w   io.Writer
+	err error
+}
+
+// line writes a content line, folding it at 75 octets without splitting UTF-8 sequences
+func (b *builder) line(s string) {
+	if b.err != nil {
+		return
+	}
+	var sb strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > lineLength {
+			sb.WriteString("\r\n ")
+			width = 1
+		}
+		sb.WriteRune(r)
+		width += size
+	}
+	sb.WriteString("\r\n")
+	_, b.err = io.WriteString(b.w, sb.String())
+}
@@ -0,0 +1,137 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	localLayout = "20060102T150405"
+	dateLayout  = "20060102"
+)
+
+// Parse reads the VEVENTs of an RFC 5545 calendar. Times with a TZID are read
+// in that zone; floating times and all-day dates are read in defaultZone.
+func Parse(r io.Reader, defaultZone *time.Location) ([]Event, error) {
+	if defaultZone == nil {
+		defaultZone = time.UTC
+	}
+
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var cur *Event
+	for n, l := range lines {
+		name, params, value, ok := splitLine(l)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			cur = &Event{}
+			continue
+		case name == "END" && value == "VEVENT":
+			if cur != nil {
+				events = append(events, *cur)
+			}
+			cur = nil
+			continue
+		case cur == nil:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			cur.UID = value
+		case "SUMMARY":
+			cur.Summary = Unescape(value)
+		case "DESCRIPTION":
+			cur.Description = Unescape(value)
+		case "LOCATION":
+			cur.Location = Unescape(value)
+		case "URL":
+			cur.URL = value
+		case "STATUS":
+			cur.Status = strings.ToUpper(value)
+		case "DTSTART", "DTEND", "LAST-MODIFIED":
+			t, err := parseTime(value, params, defaultZone)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %v", n+1, name, err)
+			}
+			switch name {
+			case "DTSTART":
+				cur.Start = t
+			case "DTEND":
+				cur.End = t
+			default:
+				cur.Updated = t
+			}
+		}
+	}
+	return events, nil
+}
+
+// Unescape reverses Escape
+func Unescape(s string) string {
+	r := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return r.Replace(s)
+}
+
+// unfold joins continuation lines (those starting with a space or tab)
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if len(l) > 0 && (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, sc.Err()
+}
+
+// splitLine breaks "NAME;PARAM=x:value" into its parts
+func splitLine(l string) (name string, params map[string]string, value string, ok bool) {
+	colon := strings.IndexByte(l, ':')
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	head, value := l[:colon], l[colon+1:]
+
+	parts := strings.Split(head, ";")
+	params = make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if k, v, found := strings.Cut(p, "="); found {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+func parseTime(value string, params map[string]string, defaultZone *time.Location) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		return time.ParseInLocation(dateLayout, value, defaultZone)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(utcLayout, value)
+	}
+	loc := defaultZone
+	if tzid := params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q", tzid)
+		}
+		loc = l
+	}
+	return time.ParseInLocation(localLayout, value, loc)
+}
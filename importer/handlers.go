@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/utils"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FormatFromFilename guesses the format from a file extension
+func FormatFromFilename(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ics", ".ical":
+		return FormatICal
+	default:
+		return FormatCSV
+	}
+}
+
+// ImportListings handles POST /api/import/:kind with a multipart form:
+//
+//	file     CSV or iCal file (required)
+//	format   csv or ics (default: from the file extension)
+//	mapping  JSON object of target field -> CSV column header
+//	dry_run  "true" to validate only
+//	timezone zone for times without an offset
+//
+// Imported records belong to the caller and are matched on external_id.
+func ImportListings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseMultipartForm(20 << 20); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	opts := Options{
+		Kind:      ps.ByName("kind"),
+		Format:    r.FormValue("format"),
+		DryRun:    r.FormValue("dry_run") == "true",
+		CreatorID: requestingUserID,
+		TimeZone:  r.FormValue("timezone"),
+	}
+	if opts.Format == "" {
+		opts.Format = FormatFromFilename(header.Filename)
+	}
+	if m := r.FormValue("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &opts.Mapping); err != nil {
+			http.Error(w, "mapping must be a JSON object of field to column", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := Run(file, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, report)
+}
+
+// GetImportFields lists the fields a CSV can be mapped to for each kind
+func GetImportFields(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	utils.SendJSONResponse(w, http.StatusOK, map[string][]string{
+		KindEvent: Fields(KindEvent),
+		KindPlace: Fields(KindPlace),
+	})
+}
+
+// EnsureIndexes makes external IDs unique per owner so re-imports update
+// instead of duplicating
+func EnsureIndexes() {
+	partial := options.Index().SetUnique(true).
+		SetPartialFilterExpression(bson.M{"external_id": bson.M{"$type": "string"}})
+
+	if _, err := db.EventsCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "creatorid", Value: 1}, {Key: "external_id", Value: 1}},
+		Options: partial,
+	}); err != nil {
+		log.Printf("Error creating event import index: %v", err)
+	}
+	if _, err := db.PlacesCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdBy", Value: 1}, {Key: "external_id", Value: 1}},
+		Options: partial,
+	}); err != nil {
+		log.Printf("Error creating place import index: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"naevis/db"
+	"naevis/ical"
+	"naevis/structs"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Import kinds and formats
+const (
+	KindEvent = "event"
+	KindPlace = "place"
+
+	FormatCSV  = "csv"
+	FormatICal = "ics"
+)
+
+// maxRows bounds a single import so one request cannot tie up the database
+const maxRows = 5000
+
+// Row outcomes
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionInvalid = "invalid"
+)
+
+// Record is one input row keyed by target field name
+type Record map[string]string
+
+// Options control a single import run
+type Options struct {
+	Kind      string            // KindEvent or KindPlace
+	Format    string            // FormatCSV or FormatICal
+	Mapping   map[string]string // target field -> CSV column header; unmapped fields use their own name
+	DryRun    bool              // validate and report without writing
+	CreatorID string            // owner of the imported records; external IDs are unique per owner
+	TimeZone  string            // zone for times without an offset; defaults to the venue's zone, then UTC
+}
+
+// RowResult is the outcome of one input row
+type RowResult struct {
+	Row        int      `json:"row"` // 1-based, not counting the CSV header
+	ExternalID string   `json:"external_id"`
+	Action     string   `json:"action"`
+	ID         string   `json:"id,omitempty"` // eventid or placeid
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// Report summarises an import run
+type Report struct {
+	Kind    string      `json:"kind"`
+	Format  string      `json:"format"`
+	DryRun  bool        `json:"dry_run"`
+	Total   int         `json:"total"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Failed  int         `json:"failed"`
+	Rows    []RowResult `json:"rows"`
+}
+
+// Fields lists the target fields accepted for a kind
+func Fields(kind string) []string {
+	if kind == KindPlace {
+		return placeFields
+	}
+	return eventFields
+}
+
+// Run reads, validates and (unless DryRun) upserts every record in r. Rows
+// are independent: an invalid row is reported and the rest still import.
+func Run(r io.Reader, opts Options) (Report, error) {
+	report := Report{Kind: opts.Kind, Format: opts.Format, DryRun: opts.DryRun, Rows: []RowResult{}}
+
+	if opts.Kind != KindEvent && opts.Kind != KindPlace {
+		return report, fmt.Errorf("kind must be %q or %q", KindEvent, KindPlace)
+	}
+	if opts.CreatorID == "" {
+		return report, fmt.Errorf("a creator is required")
+	}
+	if opts.TimeZone != "" && !structs.ValidTimeZone(opts.TimeZone) {
+		return report, fmt.Errorf("invalid time zone %q", opts.TimeZone)
+	}
+
+	var records []Record
+	var err error
+	switch opts.Format {
+	case FormatCSV:
+		records, err = readCSV(r, opts.Mapping, Fields(opts.Kind))
+	case FormatICal:
+		if opts.Kind != KindEvent {
+			return report, fmt.Errorf("iCal files can only be imported as events")
+		}
+		records, err = readICal(r, structs.LoadZone(opts.TimeZone))
+	default:
+		return report, fmt.Errorf("format must be %q or %q", FormatCSV, FormatICal)
+	}
+	if err != nil {
+		return report, err
+	}
+	if len(records) > maxRows {
+		return report, fmt.Errorf("too many rows: %d (max %d)", len(records), maxRows)
+	}
+
+	seen := map[string]int{}
+	for i, rec := range records {
+		res := RowResult{Row: i + 1, ExternalID: rec["external_id"]}
+		if first, dup := seen[res.ExternalID]; dup && res.ExternalID != "" {
+			res.Action = ActionInvalid
+			res.Errors = []string{fmt.Sprintf("external_id repeats row %d", first)}
+		} else {
+			seen[res.ExternalID] = res.Row
+			if opts.Kind == KindEvent {
+				res = importEvent(res, rec, opts)
+			} else {
+				res = importPlace(res, rec, opts)
+			}
+		}
+
+		switch res.Action {
+		case ActionCreate:
+			report.Created++
+		case ActionUpdate:
+			report.Updated++
+		default:
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, res)
+	}
+	report.Total = len(records)
+	return report, nil
+}
+
+// readCSV turns a CSV with a header row into records. mapping renames target
+// fields to the file's column headers; header matching ignores case.
+func readCSV(r io.Reader, mapping map[string]string, fields []string) ([]Record, error) {
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f] = true
+	}
+	for f := range mapping {
+		if !known[f] {
+			return nil, fmt.Errorf("mapping targets unknown field %q", f)
+		}
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+
+	index := map[string]int{}
+	for _, f := range fields {
+		col := f
+		if m, ok := mapping[f]; ok {
+			col = m
+		}
+		i, ok := columns[strings.ToLower(col)]
+		if !ok {
+			if _, mapped := mapping[f]; mapped {
+				return nil, fmt.Errorf("mapped column %q for %q is not in the file", col, f)
+			}
+			continue
+		}
+		index[f] = i
+	}
+	if _, ok := index["external_id"]; !ok {
+		return nil, fmt.Errorf("the file needs an external_id column (or a mapping for it)")
+	}
+
+	var records []Record
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV: %v", err)
+		}
+		rec := Record{}
+		for f, i := range index {
+			if i < len(row) {
+				if v := strings.TrimSpace(row[i]); v != "" {
+					rec[f] = v
+				}
+			}
+		}
+		records = append(records, rec)
+		if len(records) > maxRows {
+			break
+		}
+	}
+	return records, nil
+}
+
+// readICal turns each VEVENT into an event record keyed by its UID
+func readICal(r io.Reader, zone *time.Location) ([]Record, error) {
+	events, err := ical.Parse(r, zone)
+	if err != nil {
+		return nil, fmt.Errorf("reading iCal: %v", err)
+	}
+
+	records := make([]Record, 0, len(events))
+	for _, e := range events {
+		rec := Record{
+			"external_id": e.UID,
+			"title":       e.Summary,
+			"description": e.Description,
+			"location":    e.Location,
+			"website_url": e.URL,
+		}
+		if !e.Start.IsZero() {
+			rec["start"] = e.Start.Format(time.RFC3339)
+		}
+		if !e.End.IsZero() {
+			rec["end"] = e.End.Format(time.RFC3339)
+		}
+		switch e.Status {
+		case "CANCELLED":
+			rec["status"] = structs.EventStatusCancelled
+		case "TENTATIVE":
+			rec["status"] = structs.EventStatusDraft
+		}
+		for k, v := range rec {
+			if v == "" {
+				delete(rec, k)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// findExisting returns the id of the record previously imported with this external ID
+func findExisting(coll *mongo.Collection, ownerField, idField, owner, externalID string) (string, error) {
+	var doc bson.M
+	err := coll.FindOne(context.TODO(), bson.M{ownerField: owner, "external_id": externalID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	id, _ := doc[idField].(string)
+	return id, nil
+}
+
+// loadPlace looks up a venue referenced by an imported event
+func loadPlace(placeID string) (structs.Place, bool) {
+	var place structs.Place
+	err := db.PlacesCollection.FindOne(context.TODO(), bson.M{"placeid": placeID}).Decode(&place)
+	return place, err == nil
+}
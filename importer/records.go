@@ -0,0 +1,332 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"naevis/autocom"
+	"naevis/db"
+	"naevis/mq"
+	"naevis/places"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/userdata"
+	"naevis/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var eventFields = []string{
+	"external_id", "title", "description", "category", "placeid", "placename", "location",
+	"start", "end", "timezone", "tags", "website_url", "organizer_name", "organizer_contact", "status",
+}
+
+var placeFields = []string{
+	"external_id", "name", "address", "description", "category", "capacity", "city", "country",
+	"zipcode", "phone", "website", "lat", "lng", "timezone", "tags", "amenities",
+}
+
+// Plain text fields copied as-is: import field -> bson key
+var (
+	eventTextFields = map[string]string{
+		"description": "description", "category": "category", "location": "location",
+		"website_url": "website_url", "organizer_name": "organizer_name", "organizer_contact": "organizer_contact",
+	}
+	placeTextFields = map[string]string{
+		"description": "description", "city": "city", "country": "country",
+		"zipcode": "zipCode", "phone": "phone", "website": "website",
+	}
+)
+
+// Accepted time layouts besides RFC3339; these are read in the row's zone
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func parseImportTime(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", v)
+}
+
+func splitTags(s string) []string {
+	tags := []string{}
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' }) {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func invalid(res RowResult, errs ...string) RowResult {
+	res.Action = ActionInvalid
+	res.Errors = errs
+	return res
+}
+
+// importEvent validates one event record and upserts it by external ID.
+// status only applies to new events; later changes go through the event
+// status endpoint so cancellations still refund and notify ticket holders.
+func importEvent(res RowResult, rec Record, opts Options) RowResult {
+	var errs []string
+	if rec["external_id"] == "" {
+		errs = append(errs, "external_id is required")
+	}
+	if rec["title"] == "" {
+		errs = append(errs, "title is required")
+	}
+
+	var place structs.Place
+	hasPlace := false
+	if id := rec["placeid"]; id != "" {
+		if place, hasPlace = loadPlace(id); !hasPlace {
+			errs = append(errs, "placeid: no such place")
+		}
+	}
+
+	tz := rec["timezone"]
+	if tz == "" && hasPlace {
+		tz = place.TimeZone
+	}
+	if tz == "" {
+		tz = opts.TimeZone
+	}
+	if tz == "" {
+		tz = "UTC"
+	}
+	if !structs.ValidTimeZone(tz) {
+		errs = append(errs, fmt.Sprintf("timezone: %q is not an IANA time zone", tz))
+	}
+	loc := structs.LoadZone(tz)
+
+	var start, end time.Time
+	var err error
+	if rec["start"] == "" {
+		errs = append(errs, "start is required")
+	} else if start, err = parseImportTime(rec["start"], loc); err != nil {
+		errs = append(errs, "start: "+err.Error())
+	}
+	if rec["end"] != "" {
+		if end, err = parseImportTime(rec["end"], loc); err != nil {
+			errs = append(errs, "end: "+err.Error())
+		} else if !start.IsZero() && end.Before(start) {
+			errs = append(errs, "end is before start")
+		}
+	}
+
+	status := rec["status"]
+	switch status {
+	case "", structs.EventStatusLegacy:
+		status = structs.EventStatusPublished
+	case structs.EventStatusPublished, structs.EventStatusDraft, structs.EventStatusCancelled:
+	default:
+		errs = append(errs, "status must be published, draft or cancelled")
+	}
+
+	if len(errs) > 0 {
+		return invalid(res, errs...)
+	}
+
+	now := time.Now().UTC()
+	set := bson.M{
+		"title":           rec["title"],
+		"timezone":        tz,
+		"date":            start,
+		"start_date_time": start,
+		"updated_at":      now,
+	}
+	for f, key := range eventTextFields {
+		if v, ok := rec[f]; ok {
+			set[key] = v
+		}
+	}
+	if !end.IsZero() {
+		set["end_date_time"] = end
+	}
+	if v, ok := rec["tags"]; ok {
+		set["tags"] = splitTags(v)
+	}
+	if hasPlace {
+		set["placeid"] = place.PlaceID
+		set["placename"] = place.Name
+		if place.Geo != nil {
+			set["geo"] = place.Geo
+		}
+	} else if v, ok := rec["placename"]; ok {
+		set["placename"] = v
+	}
+
+	existingID, err := findExisting(db.EventsCollection, "creatorid", "eventid", opts.CreatorID, rec["external_id"])
+	if err != nil {
+		return invalid(res, "database error")
+	}
+	res.ID = existingID
+	res.Action = ActionCreate
+	if existingID != "" {
+		res.Action = ActionUpdate
+	}
+	if opts.DryRun {
+		return res
+	}
+
+	if existingID != "" {
+		var current structs.Event
+		if err := db.EventsCollection.FindOneAndUpdate(context.TODO(), bson.M{"eventid": existingID}, bson.M{"$set": set}).Decode(&current); err != nil {
+			return invalid(res, "failed to update event")
+		}
+		if current.Status != structs.EventStatusDraft && current.Status != structs.EventStatusScheduled {
+			mq.Emit("event-updated", mq.Index{EntityType: "event", EntityId: existingID, Method: "PUT"})
+		}
+		return res
+	}
+
+	var event structs.Event
+	raw, _ := bson.Marshal(set)
+	if err := bson.Unmarshal(raw, &event); err != nil {
+		return invalid(res, "failed to build event")
+	}
+	event.EventID = utils.GenerateID(14)
+	event.ExternalID = rec["external_id"]
+	event.CreatorID = opts.CreatorID
+	event.Status = status
+	event.StatusChangedAt = &now
+	event.CreatedAt = now
+	event.FAQs = []structs.FAQ{}
+
+	if _, err := db.EventsCollection.InsertOne(context.TODO(), event); err != nil {
+		return invalid(res, "failed to create event")
+	}
+	res.ID = event.EventID
+
+	userdata.SetUserData("event", event.EventID, opts.CreatorID)
+	if event.Status != structs.EventStatusDraft {
+		mq.Emit("event-created", mq.Index{EntityType: "event", EntityId: event.EventID, Method: "POST"})
+	}
+	return res
+}
+
+// importPlace validates one place record and upserts it by external ID
+func importPlace(res RowResult, rec Record, opts Options) RowResult {
+	var errs []string
+	for _, f := range []string{"external_id", "name", "address", "category"} {
+		if rec[f] == "" {
+			errs = append(errs, f+" is required")
+		}
+	}
+
+	now := time.Now().UTC()
+	set := bson.M{"updated_at": now}
+	for _, f := range []string{"name", "address", "category"} {
+		if v := rec[f]; v != "" {
+			set[f] = v
+		}
+	}
+	for f, key := range placeTextFields {
+		if v, ok := rec[f]; ok {
+			set[key] = v
+		}
+	}
+	for _, f := range []string{"tags", "amenities"} {
+		if v, ok := rec[f]; ok {
+			set[f] = places.NormalizeTerms(splitTags(v))
+		}
+	}
+
+	if v, ok := rec["capacity"]; ok {
+		if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+			errs = append(errs, "capacity must be a positive integer")
+		} else {
+			set["capacity"] = n
+		}
+	}
+
+	_, hasLat := rec["lat"]
+	_, hasLng := rec["lng"]
+	if hasLat != hasLng {
+		errs = append(errs, "lat and lng must be given together")
+	} else if hasLat {
+		lat, errLat := strconv.ParseFloat(rec["lat"], 64)
+		lng, errLng := strconv.ParseFloat(rec["lng"], 64)
+		if errLat != nil || errLng != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			errs = append(errs, "lat/lng out of range")
+		} else {
+			set["location"] = structs.Coordinates{Latitude: lat, Longitude: lng}
+			set["geo"] = structs.NewGeoPoint(lat, lng)
+		}
+	}
+
+	if tz, ok := rec["timezone"]; ok {
+		if !structs.ValidTimeZone(tz) {
+			errs = append(errs, fmt.Sprintf("timezone: %q is not an IANA time zone", tz))
+		}
+		set["timezone"] = tz
+	}
+
+	if len(errs) > 0 {
+		return invalid(res, errs...)
+	}
+
+	existingID, err := findExisting(db.PlacesCollection, "createdBy", "placeid", opts.CreatorID, rec["external_id"])
+	if err != nil {
+		return invalid(res, "database error")
+	}
+	res.ID = existingID
+	res.Action = ActionCreate
+	if existingID != "" {
+		res.Action = ActionUpdate
+	}
+	if opts.DryRun {
+		return res
+	}
+
+	if existingID != "" {
+		set["updatedBy"] = opts.CreatorID
+		var before, after structs.Place
+		err := db.PlacesCollection.FindOneAndUpdate(context.TODO(), bson.M{"placeid": existingID}, bson.M{"$set": set}).Decode(&before)
+		if err != nil {
+			return invalid(res, "failed to update place")
+		}
+		if err := db.PlacesCollection.FindOne(context.TODO(), bson.M{"placeid": existingID}).Decode(&after); err == nil {
+			if _, err := places.RecordPlaceVersion(before, after, opts.CreatorID, 0); err != nil {
+				log.Printf("Error recording version of place %s: %v", existingID, err)
+			}
+		}
+		if _, err := rdx.RdxDel("place:" + existingID); err != nil {
+			log.Printf("Cache deletion failed for place ID: %s. Error: %v", existingID, err)
+		}
+		autocom.AddPlaceToAutocorrect(rdx.Conn, existingID, rec["name"])
+		mq.Emit("place-edited", mq.Index{EntityType: "place", EntityId: existingID, Method: "PUT"})
+		return res
+	}
+
+	var place structs.Place
+	raw, _ := bson.Marshal(set)
+	if err := bson.Unmarshal(raw, &place); err != nil {
+		return invalid(res, "failed to build place")
+	}
+	place.PlaceID = utils.GenerateID(14)
+	place.ExternalID = rec["external_id"]
+	place.CreatedBy = opts.CreatorID
+	place.CreatedAt = now
+	if place.TimeZone == "" {
+		place.TimeZone = "UTC"
+	}
+
+	if _, err := db.PlacesCollection.InsertOne(context.TODO(), place); err != nil {
+		return invalid(res, "failed to create place")
+	}
+	res.ID = place.PlaceID
+
+	autocom.AddPlaceToAutocorrect(rdx.Conn, place.PlaceID, place.Name)
+	userdata.SetUserData("place", place.PlaceID, opts.CreatorID)
+	mq.Emit("place-created", mq.Index{EntityType: "place", EntityId: place.PlaceID, Method: "POST"})
+	return res
+}
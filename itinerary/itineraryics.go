@@ -0,0 +1,82 @@
+package itinerary
+
+import (
+	"context"
+	"fmt"
+	"naevis/db"
+	"naevis/ical"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GET /api/itineraries/all/:id/ics?tz=Europe/Paris
+// Visit times are wall-clock times at the destination, so they are interpreted
+// in the given IANA zone (default UTC) and exported as absolute UTC instants.
+func ExportItineraryICS(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	itineraryID := ps.ByName("id")
+
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		http.Error(w, "Invalid time zone", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var itinerary Itinerary
+	filter := bson.M{"itineraryid": itineraryID, "deleted": bson.M{"$ne": true}}
+	if err := db.ItineraryCollection.FindOne(ctx, filter).Decode(&itinerary); err != nil {
+		http.Error(w, "Itinerary not found", http.StatusNotFound)
+		return
+	}
+
+	cal := ical.Calendar{Name: itinerary.Name}
+	for d, day := range itinerary.Days {
+		for v, visit := range day.Visits {
+			start, err := parseVisitTime(day.Date, visit.StartTime, loc)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Day %d visit %d: %v", d+1, v+1, err), http.StatusUnprocessableEntity)
+				return
+			}
+			end, err := parseVisitTime(day.Date, visit.EndTime, loc)
+			if err != nil || !end.After(start) {
+				end = start.Add(time.Hour)
+			}
+
+			desc := itinerary.Description
+			if visit.Transport != nil && *visit.Transport != "" {
+				desc = strings.TrimSpace("Transport: " + *visit.Transport + "\n" + desc)
+			}
+
+			cal.Events = append(cal.Events, ical.Event{
+				UID:         fmt.Sprintf("%s-%d-%d@naevis", itinerary.ItineraryID, d, v),
+				Summary:     visit.Location,
+				Description: desc,
+				Location:    visit.Location,
+				Start:       start,
+				End:         end,
+			})
+		}
+	}
+
+	cal.Serve(w, itinerary.ItineraryID+".ics")
+}
+
+// parseVisitTime combines a "2006-01-02" date with an "15:04" time in loc
+func parseVisitTime(date, clock string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, date+" "+clock, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date/time %q %q", date, clock)
+}
@@ -4,9 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"naevis/analytics"
+	"naevis/booking"
 	"naevis/db"
+	"naevis/events"
+	"naevis/feed"
+	"naevis/importer"
+	"naevis/menu"
+	"naevis/places"
 	"naevis/ratelim"
 	"naevis/routes"
+	"naevis/trash"
 	"net/http"
 	"os"
 	"os/signal"
@@ -83,6 +91,12 @@ func setupRouter(rateLimiter *ratelim.RateLimiter) http.Handler {
 	routes.AddAdsRoutes(router)
 	routes.AddHomeFeedRoutes(router)
 	routes.AddSearchRoutes(router)
+	routes.AddCalendarRoutes(router)
+	routes.AddNotificationRoutes(router)
+	routes.AddImportRoutes(router)
+	routes.AddTrashRoutes(router)
+	routes.AddBookingRoutes(router)
+	routes.AddWalkInRoutes(router)
 	routes.AddStaticRoutes(router)
 
 	// CORS setup (adjust AllowedOrigins in production)
@@ -90,6 +104,7 @@ func setupRouter(rateLimiter *ratelim.RateLimiter) http.Handler {
 		AllowedOrigins:   []string{"*"}, // Consider specific origins in production
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"X-Next-Cursor"},
 		AllowCredentials: true,
 	})
 
@@ -187,8 +202,43 @@ func main() {
 	db.CartoonsCollection = cartoonsCollection
 	searchCollection = client.Database("eventdb").Collection("cartoons")
 	db.SearchCollection = searchCollection
+	db.CalendarFeedsCollection = client.Database("eventdb").Collection("calendarfeeds")
+	db.NotificationsCollection = client.Database("eventdb").Collection("notifications")
+	db.EventTemplatesCollection = client.Database("eventdb").Collection("eventtemplates")
+	db.EventMembersCollection = client.Database("eventdb").Collection("eventmembers")
+	db.EventQuestionsCollection = client.Database("eventdb").Collection("eventquestions")
+	db.StagesCollection = client.Database("eventdb").Collection("stages")
+	db.SessionsCollection = client.Database("eventdb").Collection("sessions")
+	db.ScheduleStarsCollection = client.Database("eventdb").Collection("schedulestars")
+	db.EventAnalyticsCollection = client.Database("eventdb").Collection("eventanalytics")
+	db.PlaceVersionsCollection = client.Database("eventdb").Collection("placeversions")
+	db.CheckInsCollection = client.Database("eventdb").Collection("checkins")
+	db.PlaceClaimsCollection = client.Database("eventdb").Collection("placeclaims")
+	db.BookingResourcesCollection = client.Database("eventdb").Collection("bookingresources")
+	db.SlotTemplatesCollection = client.Database("eventdb").Collection("slottemplates")
+	db.BookingPoliciesCollection = client.Database("eventdb").Collection("bookingpolicies")
+	db.MenuCategoriesCollection = client.Database("eventdb").Collection("menucategories")
+	db.OrdersCollection = client.Database("eventdb").Collection("orders")
 	db.Client = client
 
+	go events.EnsureEventIndexes()
+	go analytics.EnsureIndexes()
+	go importer.EnsureIndexes()
+	go places.EnsurePlaceIndexes()
+	go trash.EnsureIndexes()
+	go booking.EnsureIndexes()
+	go menu.EnsureIndexes()
+
+	// Publishes scheduled events and completes ended ones
+	go events.RunEventScheduler(time.Minute)
+
+	// Purges places, events and posts that have been in the trash too long
+	go trash.RunPurger(time.Hour, map[string]trash.Purger{
+		"events": events.PurgeDeletedEvents,
+		"places": places.PurgeDeletedPlaces,
+		"posts":  feed.PurgeDeletedPosts,
+	})
+
 	router := httprouter.New()
 
 	rateLimiter := ratelim.NewRateLimiter()
@@ -0,0 +1,172 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"naevis/db"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Why an item cannot be ordered right now
+const (
+	ReasonEightySixed  = "eighty_sixed" // Taken off by staff until further notice
+	ReasonSoldOut      = "sold_out"     // Stock ran out; back once restocked
+	ReasonNotScheduled = "not_scheduled"
+)
+
+// Availability is worked out when an item is read, for the time asked
+// about, and is never stored
+type Availability struct {
+	Available   bool       `json:"available" bson:"-"`
+	Unavailable string     `json:"unavailable,omitempty" bson:"-"`
+	NextFrom    *time.Time `json:"available_from,omitempty" bson:"-"` // When a scheduled item is next served
+}
+
+// setAvailability works out whether the item can be ordered at t. A
+// schedule is read in the place's zone.
+func (it *Item) setAvailability(t time.Time, loc *time.Location) {
+	it.Availability = Availability{Available: true}
+	switch {
+	case it.EightySixed:
+		it.Availability = Availability{Unavailable: ReasonEightySixed}
+	case it.Stock <= 0:
+		it.Availability = Availability{Unavailable: ReasonSoldOut}
+	case it.Schedule != nil && !it.Schedule.IsOpenAt(t, loc):
+		it.Availability = Availability{Unavailable: ReasonNotScheduled}
+		if next, ok := it.Schedule.NextOpen(t, loc); ok {
+			it.NextFrom = &next
+		}
+	}
+}
+
+// unavailableError explains why an item cannot be ordered now, or is nil
+func (it *Item) unavailableError(ctx context.Context) error {
+	loc := time.UTC
+	if it.Schedule != nil {
+		loc = placeZone(ctx, it.PlaceID)
+	}
+	it.setAvailability(time.Now(), loc)
+	switch it.Unavailable {
+	case ReasonEightySixed:
+		return fmt.Errorf("%s is off the menu for now", it.Name)
+	case ReasonSoldOut:
+		return fmt.Errorf("%s is sold out", it.Name)
+	case ReasonNotScheduled:
+		return fmt.Errorf("%s is not served at this time", it.Name)
+	}
+	return nil
+}
+
+// placeZone is the zone a place's menu schedules are read in
+func placeZone(ctx context.Context, placeID string) *time.Location {
+	var place structs.Place
+	db.PlacesCollection.FindOne(ctx, trash.Live(bson.M{"placeid": placeID}),
+		options.FindOne().SetProjection(bson.M{"timezone": 1})).Decode(&place)
+	return structs.LoadZone(place.TimeZone)
+}
+
+// availableAt reads ?at= (RFC 3339), defaulting to now
+func availableAt(r *http.Request) (time.Time, error) {
+	at := r.URL.Query().Get("at")
+	if at == "" {
+		return time.Now(), nil
+	}
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return t, fmt.Errorf("at must be an RFC 3339 time such as 2025-06-01T08:30:00+02:00")
+	}
+	return t, nil
+}
+
+// menuChanged drops an item's cached copy and tells listeners it changed
+func menuChanged(placeID, menuID, event string) {
+	rdx.RdxDel(fmt.Sprintf("menu:%s:%s", placeID, menuID))
+	go mq.Emit(event, mq.Index{EntityType: "menu", EntityId: menuID, Method: "PUT", ItemType: "place", ItemId: placeID})
+}
+
+// SetMenuSchedule sets when an item is served, as weekly hours in the
+// place's zone with optional dated exceptions, e.g. breakfast:
+//
+//	{"schedule": {"weekly": {"mon": [{"open": "07:00", "close": "11:00"}], ...}}}
+//
+// A null schedule serves the item whenever it is in stock.
+func SetMenuSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, menuID := ps.ByName("placeid"), ps.ByName("menuid")
+
+	var req struct {
+		Schedule *structs.OperatingHours `json:"schedule"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	if req.Schedule != nil {
+		if err := req.Schedule.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		update["$set"].(bson.M)["schedule"] = req.Schedule
+	} else {
+		update["$unset"] = bson.M{"schedule": ""}
+	}
+
+	result, err := db.MenuCollection.UpdateOne(r.Context(), bson.M{"placeid": placeID, "menuid": menuID}, update)
+	if err != nil {
+		http.Error(w, "Failed to update menu", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Menu not found", http.StatusNotFound)
+		return
+	}
+	menuChanged(placeID, menuID, "menu-edited")
+
+	it, _ := findItem(r.Context(), placeID, menuID)
+	it.setAvailability(time.Now(), placeZone(r.Context(), placeID))
+	utils.SendJSONResponse(w, http.StatusOK, it)
+}
+
+// EightySix takes an item off the menu until staff bring it back with
+// UnEightySix, whatever its stock and schedule
+func EightySix(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setEightySixed(w, r, ps, true)
+}
+
+// UnEightySix puts an 86'd item back on the menu
+func UnEightySix(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setEightySixed(w, r, ps, false)
+}
+
+func setEightySixed(w http.ResponseWriter, r *http.Request, ps httprouter.Params, off bool) {
+	placeID, menuID := ps.ByName("placeid"), ps.ByName("menuid")
+
+	result, err := db.MenuCollection.UpdateOne(r.Context(),
+		bson.M{"placeid": placeID, "menuid": menuID},
+		bson.M{"$set": bson.M{"eighty_sixed": off, "updated_at": time.Now()}})
+	if err != nil {
+		http.Error(w, "Failed to update menu", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Menu not found", http.StatusNotFound)
+		return
+	}
+	menuChanged(placeID, menuID, "menu-edited")
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"menuid":       menuID,
+		"eighty_sixed": off,
+	})
+}
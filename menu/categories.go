@@ -0,0 +1,196 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"naevis/db"
+	"naevis/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Category groups a place's menu items, e.g. starters or mains. Categories
+// are listed by Position, then name.
+type Category struct {
+	CategoryID string    `json:"categoryid" bson:"categoryid"`
+	PlaceID    string    `json:"placeid" bson:"placeid"`
+	Name       string    `json:"name" bson:"name"`
+	Position   int       `json:"position" bson:"position"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Section is a category with its items, as shown on the menu
+type Section struct {
+	Category Category `json:"category"`
+	Items    []Item   `json:"items"`
+}
+
+func findCategory(ctx context.Context, placeID, categoryID string) (Category, error) {
+	var c Category
+	err := db.MenuCategoriesCollection.FindOne(ctx, bson.M{"placeid": placeID, "categoryid": categoryID}).Decode(&c)
+	return c, err
+}
+
+func placeCategories(ctx context.Context, placeID string) ([]Category, error) {
+	cursor, err := db.MenuCategoriesCollection.Find(ctx, bson.M{"placeid": placeID},
+		options.Find().SetSort(bson.D{{Key: "position", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	categories := []Category{}
+	err = cursor.All(ctx, &categories)
+	return categories, err
+}
+
+func decodeCategory(r *http.Request) (Category, error) {
+	var c Category
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		return c, fmt.Errorf("Invalid input")
+	}
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" || len(c.Name) > 60 {
+		return c, fmt.Errorf("Name must be between 1 and 60 characters.")
+	}
+	return c, nil
+}
+
+// CreateCategory adds a category to a place's menu:
+//
+//	{"name": "Starters", "position": 1}
+func CreateCategory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, err := decodeCategory(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now().UTC()
+	c.CategoryID = utils.GenerateID(10)
+	c.PlaceID = ps.ByName("placeid")
+	c.CreatedAt, c.UpdatedAt = now, now
+
+	if _, err := db.MenuCategoriesCollection.InsertOne(r.Context(), c); err != nil {
+		http.Error(w, "Failed to create category", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusCreated, c)
+}
+
+// GetCategories lists a place's menu categories in order
+func GetCategories(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	categories, err := placeCategories(r.Context(), ps.ByName("placeid"))
+	if err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, categories)
+}
+
+// UpdateCategory renames or moves a category
+func UpdateCategory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, err := decodeCategory(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	placeID, categoryID := ps.ByName("placeid"), ps.ByName("categoryid")
+
+	result, err := db.MenuCategoriesCollection.UpdateOne(r.Context(),
+		bson.M{"placeid": placeID, "categoryid": categoryID},
+		bson.M{"$set": bson.M{"name": c.Name, "position": c.Position, "updated_at": time.Now().UTC()}})
+	if err != nil {
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	c, _ = findCategory(r.Context(), placeID, categoryID)
+	utils.SendJSONResponse(w, http.StatusOK, c)
+}
+
+// DeleteCategory removes a category; its items stay on the menu,
+// uncategorized
+func DeleteCategory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, categoryID := ps.ByName("placeid"), ps.ByName("categoryid")
+
+	result, err := db.MenuCategoriesCollection.DeleteOne(r.Context(), bson.M{"placeid": placeID, "categoryid": categoryID})
+	if err != nil {
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if _, err := db.MenuCollection.UpdateMany(r.Context(),
+		bson.M{"placeid": placeID, "categoryid": categoryID},
+		bson.M{"$unset": bson.M{"categoryid": ""}}); err != nil {
+		http.Error(w, "Failed to update menu items", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPlaceMenu returns a place's whole menu grouped into its categories, in
+// order, followed by the items without a category. Like GetMenus it takes
+// ?at= and ?available=true.
+func GetPlaceMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	ctx := r.Context()
+	at, err := availableAt(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	onlyAvailable := r.URL.Query().Get("available") == "true"
+	loc := placeZone(ctx, placeID)
+
+	categories, err := placeCategories(ctx, placeID)
+	if err != nil {
+		http.Error(w, "Failed to fetch menu", http.StatusInternalServerError)
+		return
+	}
+	cursor, err := db.MenuCollection.Find(ctx, bson.M{"placeid": placeID}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		http.Error(w, "Failed to fetch menu", http.StatusInternalServerError)
+		return
+	}
+	var items []Item
+	if err := cursor.All(ctx, &items); err != nil {
+		http.Error(w, "Failed to decode menu", http.StatusInternalServerError)
+		return
+	}
+
+	sections := make([]Section, len(categories))
+	index := map[string]int{}
+	for i, c := range categories {
+		sections[i] = Section{Category: c, Items: []Item{}}
+		index[c.CategoryID] = i
+	}
+	uncategorized := []Item{}
+	for _, it := range items {
+		it.setAvailability(at, loc)
+		if onlyAvailable && !it.Available {
+			continue
+		}
+		if i, ok := index[it.CategoryID]; ok {
+			sections[i].Items = append(sections[i].Items, it)
+		} else {
+			uncategorized = append(uncategorized, it)
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"placeid":       placeID,
+		"sections":      sections,
+		"uncategorized": uncategorized,
+	})
+}
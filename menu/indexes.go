@@ -0,0 +1,36 @@
+package menu
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes for menu items, categories and table orders
+func EnsureIndexes() {
+	ctx := context.TODO()
+
+	if _, err := db.MenuCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "categoryid", Value: 1}},
+	}); err != nil {
+		log.Printf("Error creating menu index: %v", err)
+	}
+
+	if _, err := db.MenuCategoriesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "categoryid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "position", Value: 1}}},
+	}); err != nil {
+		log.Printf("Error creating menu category indexes: %v", err)
+	}
+
+	if _, err := db.OrdersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "orderid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+	}); err != nil {
+		log.Printf("Error creating order indexes: %v", err)
+	}
+}
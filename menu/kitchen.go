@@ -0,0 +1,113 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"naevis/middleware"
+	"naevis/rdx"
+	"naevis/structs"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	kitchenPingEvery = 30 * time.Second
+	kitchenWriteWait = 10 * time.Second
+)
+
+// kitchenChannel is the Redis channel a place's order changes go out on
+func kitchenChannel(placeID string) string {
+	return "kitchen:" + placeID
+}
+
+func publishKitchen(ctx context.Context, placeID string, msg []byte) error {
+	return rdx.Conn.Publish(ctx, kitchenChannel(placeID), msg).Err()
+}
+
+// KitchenWS streams a place's orders to a kitchen display. It first sends
+// {"type": "snapshot", "orders": [...]} with every active order, then an
+// order_created or order_updated message for each change. Browsers cannot
+// set headers on a WebSocket, so the token may also be passed as ?token=.
+func KitchenWS(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+
+	token := r.Header.Get("Authorization")
+	if token == "" && r.URL.Query().Get("token") != "" {
+		token = "Bearer " + r.URL.Query().Get("token")
+	}
+	claims, err := middleware.ValidateJWT(token)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if ok, err := middleware.IsPlaceManager(placeID, claims.UserID); err != nil || !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	conn, err := structs.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Kitchen WebSocket upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Subscribe before the snapshot so no order is missed in between
+	pubsub := rdx.Conn.Subscribe(ctx, kitchenChannel(placeID))
+	defer pubsub.Close()
+
+	orders, err := findOrders(ctx, bson.M{"placeid": placeID, "status": bson.M{"$in": activeStatuses}})
+	if err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "failed to load orders"))
+		return
+	}
+	snapshot, _ := json.Marshal(map[string]any{"type": "snapshot", "orders": orders})
+	conn.SetWriteDeadline(time.Now().Add(kitchenWriteWait))
+	if err := conn.WriteMessage(websocket.TextMessage, snapshot); err != nil {
+		return
+	}
+
+	// The display only listens; reading notices when it goes away
+	go func() {
+		defer cancel()
+		conn.SetReadDeadline(time.Now().Add(2 * kitchenPingEvery))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * kitchenPingEvery))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(kitchenPingEvery)
+	defer ping.Stop()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(kitchenWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(kitchenWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
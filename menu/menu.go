@@ -56,8 +56,17 @@ func CreateMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	// Optional category; variants and modifiers are set with SetMenuOptions
+	categoryID := r.FormValue("categoryid")
+	if categoryID != "" {
+		if _, err := findCategory(r.Context(), placeID, categoryID); err != nil {
+			http.Error(w, "Category not found.", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Create a new Menu instance
-	menu := structs.Menu{
+	menu := Item{Menu: structs.Menu{
 		PlaceID:   placeID,
 		Name:      name,
 		Price:     price,
@@ -65,7 +74,7 @@ func CreateMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		MenuID:    utils.GenerateID(14), // Generate unique menu ID
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	}
+	}, CategoryID: categoryID}
 
 	// Handle banner file upload
 	bannerFile, bannerHeader, err := r.FormFile("image")
@@ -138,34 +147,41 @@ func GetMenu(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	cacheKey := fmt.Sprintf("menu:%s:%s", placeID, menuID)
 
 	// Check if the menu is cached
+	// Availability depends on the time, so it is worked out after the cache
+	var menu Item
 	cachedMenu, err := rdx.RdxGet(cacheKey)
-	if err == nil && cachedMenu != "" {
-		// Return cached data
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(cachedMenu))
-		return
-	}
+	if err != nil || cachedMenu == "" || json.Unmarshal([]byte(cachedMenu), &menu) != nil {
+		// collection := client.Database("placedb").Collection("menu")
+		menu = Item{}
+		err = db.MenuCollection.FindOne(context.TODO(), bson.M{"placeid": placeID, "menuid": menuID}).Decode(&menu)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Menu not found: %v", err), http.StatusNotFound)
+			return
+		}
 
-	// collection := client.Database("placedb").Collection("menu")
-	var menu structs.Menu
-	err = db.MenuCollection.FindOne(context.TODO(), bson.M{"placeid": placeID, "menuid": menuID}).Decode(&menu)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Menu not found: %v", err), http.StatusNotFound)
-		return
+		// Cache the result
+		menuJSON, _ := json.Marshal(menu)
+		rdx.RdxSet(cacheKey, string(menuJSON))
 	}
-
-	// Cache the result
-	menuJSON, _ := json.Marshal(menu)
-	rdx.RdxSet(cacheKey, string(menuJSON))
+	menu.setAvailability(time.Now(), placeZone(r.Context(), placeID))
 
 	// Respond with menu data
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(menu)
 }
 
-// Fetch a list of menu items
+// Fetch a list of menu items, optionally in one ?category. Each is flagged
+// with whether it can be ordered ?at= a time (now by default);
+// ?available=true leaves out the ones that cannot.
 func GetMenus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	placeID := ps.ByName("placeid")
+	at, err := availableAt(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	onlyAvailable := r.URL.Query().Get("available") == "true"
+	loc := placeZone(r.Context(), placeID)
 	// cacheKey := fmt.Sprintf("menulist:%s", placeID)
 	fmt.Println("::::------------------------------::", placeID)
 	// // Check if the menu list is cached
@@ -178,8 +194,11 @@ func GetMenus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// }
 
 	// collection := client.Database("placedb").Collection("menu")
-	var menuList []structs.Menu
+	var menuList []Item
 	filter := bson.M{"placeid": placeID}
+	if category := r.URL.Query().Get("category"); category != "" {
+		filter["categoryid"] = category
+	}
 
 	cursor, err := db.MenuCollection.Find(context.Background(), filter)
 	if err != nil {
@@ -189,11 +208,15 @@ func GetMenus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	defer cursor.Close(context.Background())
 
 	for cursor.Next(context.Background()) {
-		var menu structs.Menu
+		var menu Item
 		if err := cursor.Decode(&menu); err != nil {
 			http.Error(w, "Failed to decode menu", http.StatusInternalServerError)
 			return
 		}
+		menu.setAvailability(at, loc)
+		if onlyAvailable && !menu.Available {
+			continue
+		}
 		menuList = append(menuList, menu)
 	}
 
@@ -203,7 +226,7 @@ func GetMenus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	if len(menuList) == 0 {
-		menuList = []structs.Menu{}
+		menuList = []Item{}
 	}
 
 	// Cache the list
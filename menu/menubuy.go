@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/mq"
+	"naevis/rdx"
 	"naevis/stripe"
 	"naevis/structs"
 	"naevis/tickets"
@@ -16,6 +18,8 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // POST /menu/event/:placeId/:menuId/payment-session
@@ -23,15 +27,23 @@ func CreateMenuPaymentSession(w http.ResponseWriter, r *http.Request, ps httprou
 	menuId := ps.ByName("menuid")
 	placeId := ps.ByName("placeid")
 
-	// Parse request body for stock
+	// Parse request body for stock and the chosen variant and modifiers
 	var body struct {
 		Stock int `json:"stock"`
+		Selection
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Stock < 1 {
 		http.Error(w, "Invalid request or stock", http.StatusBadRequest)
 		return
 	}
 
+	// Price the selection before payment so invalid choices never reach it
+	_, unitPrice, status, err := priceSelection(r.Context(), placeId, menuId, body.Selection)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	// Generate a Stripe payment session
 	session, err := stripe.CreateMenuSession(menuId, placeId, body.Stock)
 	if err != nil {
@@ -46,6 +58,10 @@ func CreateMenuPaymentSession(w http.ResponseWriter, r *http.Request, ps httprou
 		"placeid":    session.PlaceID,
 		"menuid":     session.MenuID,
 		"stock":      session.Stock,
+		"variantId":  body.VariantID,
+		"modifiers":  body.Modifiers,
+		"unitPrice":  unitPrice,
+		"total":      lineTotal(unitPrice, session.Stock),
 	}
 
 	// Respond with the session URL
@@ -79,11 +95,35 @@ type MenuPurchaseRequest struct {
 	MenuID  string `json:"menuId"`
 	PlaceId string `json:"placeId"`
 	Stock   int    `json:"stock"`
+	Selection
 }
 
 // MenuPurchaseResponse represents the response body for menu purchase confirmation
 type MenuPurchaseResponse struct {
-	Message string `json:"message"`
+	Message   string  `json:"message"`
+	UnitPrice float64 `json:"unitPrice"`
+	Total     float64 `json:"total"`
+}
+
+// priceSelection loads the item and prices the buyer's selection. On
+// failure it returns the HTTP status to respond with.
+func priceSelection(ctx context.Context, placeId, menuId string, sel Selection) (Item, float64, int, error) {
+	item, err := findItem(ctx, placeId, menuId)
+	if err != nil {
+		return item, 0, http.StatusNotFound, fmt.Errorf("Menu not found")
+	}
+	if err := item.unavailableError(ctx); err != nil {
+		return item, 0, http.StatusConflict, err
+	}
+	unitPrice, err := item.UnitPrice(sel)
+	if err != nil {
+		return item, 0, http.StatusBadRequest, err
+	}
+	return item, unitPrice, http.StatusOK, nil
+}
+
+func lineTotal(unitPrice float64, quantity int) float64 {
+	return math.Round(unitPrice*float64(quantity)*100) / 100
 }
 
 // ProcessMenuPayment simulates the payment processing logic
@@ -122,6 +162,16 @@ func ConfirmMenuPurchase(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	request.MenuID = ps.ByName("menuid")
 
 	fmt.Println(request)
+	if request.Stock < 1 {
+		http.Error(w, "Invalid stock", http.StatusBadRequest)
+		return
+	}
+	_, unitPrice, status, err := priceSelection(r.Context(), request.PlaceId, request.MenuID, request.Selection)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	// Process the payment
 	paymentProcessed := ProcessMenuPayment(request.MenuID, request.PlaceId, request.Stock)
 
@@ -140,16 +190,48 @@ func ConfirmMenuPurchase(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		// w.Header().Set("Content-Type", "application/json")
 		// w.WriteHeader(http.StatusOK)
 		// json.NewEncoder(w).Encode(response)
-		buyxMenu(w, request, requestingUserID)
+		buyxMenu(w, request, requestingUserID, unitPrice)
 	} else {
 		// If payment failed, respond with a failure message
 		http.Error(w, "Payment failed", http.StatusBadRequest)
 	}
 }
 
+// takeStock takes quantity items out of stock in one conditional update, so
+// concurrent buyers cannot take more than there is. It reports false when
+// there is not enough. Taking the last one marks the item sold out until it
+// is restocked.
+func takeStock(ctx context.Context, placeId, menuId string, quantity int) (bool, error) {
+	var item Item
+	err := db.MenuCollection.FindOneAndUpdate(ctx,
+		bson.M{"placeid": placeId, "menuid": menuId, "stock": bson.M{"$gte": quantity}},
+		bson.M{"$inc": bson.M{"stock": -quantity}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if item.Stock == 0 {
+		menuChanged(placeId, menuId, "menu-sold-out")
+	}
+	return true, nil
+}
+
+// returnStock puts items back, e.g. when a later line of an order fails,
+// which also ends a sold out
+func returnStock(ctx context.Context, placeId, menuId string, quantity int) error {
+	_, err := db.MenuCollection.UpdateOne(ctx,
+		bson.M{"placeid": placeId, "menuid": menuId},
+		bson.M{"$inc": bson.M{"stock": quantity}})
+	rdx.RdxDel(fmt.Sprintf("menu:%s:%s", placeId, menuId))
+	return err
+}
+
 // Buy Menu
 
-func buyxMenu(w http.ResponseWriter, request MenuPurchaseRequest, requestingUserID string) {
+func buyxMenu(w http.ResponseWriter, request MenuPurchaseRequest, requestingUserID string, unitPrice float64) {
 	placeId := request.PlaceId
 	menuID := request.MenuID
 	stockRequested := request.Stock
@@ -163,19 +245,16 @@ func buyxMenu(w http.ResponseWriter, request MenuPurchaseRequest, requestingUser
 		return
 	}
 
-	// Check if there are enough menu available for purchase
-	if menu.Stock < stockRequested {
-		http.Error(w, "Not enough menu available for purchase", http.StatusBadRequest)
-		return
-	}
-
-	// Decrease the menu stock by the requested quantity
-	update := bson.M{"$inc": bson.M{"stock": -stockRequested}}
-	_, err = db.MenuCollection.UpdateOne(context.TODO(), bson.M{"placeid": placeId, "menuid": menuID}, update)
+	// Decrease the menu stock by the requested quantity, if there is enough
+	ok, err := takeStock(context.TODO(), placeId, menuID, stockRequested)
 	if err != nil {
 		http.Error(w, "Failed to update menu stock", http.StatusInternalServerError)
 		return
 	}
+	if !ok {
+		http.Error(w, "Not enough menu available for purchase", http.StatusBadRequest)
+		return
+	}
 
 	userdata.SetUserData("menu", menuID, requestingUserID)
 
@@ -184,7 +263,9 @@ func buyxMenu(w http.ResponseWriter, request MenuPurchaseRequest, requestingUser
 
 	// Respond with a success message
 	response := MenuPurchaseResponse{
-		Message: "Payment successfully processed. Menu purchased.",
+		Message:   "Payment successfully processed. Menu purchased.",
+		UnitPrice: unitPrice,
+		Total:     lineTotal(unitPrice, stockRequested),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,230 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"naevis/db"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Item is a menu entry with its category, size variants, add-on modifier
+// groups and availability. It is stored in the same document as the flat
+// structs.Menu it extends.
+type Item struct {
+	structs.Menu   `bson:",inline"`
+	CategoryID     string                  `json:"categoryid,omitempty" bson:"categoryid,omitempty"`
+	Variants       []Variant               `json:"variants,omitempty" bson:"variants,omitempty"`
+	ModifierGroups []ModifierGroup         `json:"modifier_groups,omitempty" bson:"modifier_groups,omitempty"`
+	Schedule       *structs.OperatingHours `json:"schedule,omitempty" bson:"schedule,omitempty"` // When it is served; nil is always
+	EightySixed    bool                    `json:"eighty_sixed" bson:"eighty_sixed,omitempty"`
+	Availability   `bson:"-"`
+}
+
+// Variant is a size or version of an item. When an item has variants one
+// must be chosen, and its Price replaces the item's.
+type Variant struct {
+	VariantID string  `json:"variantid" bson:"variantid"`
+	Name      string  `json:"name" bson:"name"`
+	Price     float64 `json:"price" bson:"price"`
+}
+
+// ModifierGroup is a set of add-ons with a selection rule: between Min and
+// Max different modifiers must be chosen. Min 0 makes the group optional;
+// "choose 2 sides" is Min 2, Max 2.
+type ModifierGroup struct {
+	GroupID   string     `json:"groupid" bson:"groupid"`
+	Name      string     `json:"name" bson:"name"`
+	Min       int        `json:"min" bson:"min"`
+	Max       int        `json:"max" bson:"max"`
+	Modifiers []Modifier `json:"modifiers" bson:"modifiers"`
+}
+
+// Modifier is one add-on; its Price is added to the item's
+type Modifier struct {
+	ModifierID string  `json:"modifierid" bson:"modifierid"`
+	Name       string  `json:"name" bson:"name"`
+	Price      float64 `json:"price" bson:"price"`
+}
+
+// Selection is what a buyer picked for an item: a variant, if the item has
+// any, and modifier IDs from its groups
+type Selection struct {
+	VariantID string   `json:"variantId,omitempty"`
+	Modifiers []string `json:"modifiers,omitempty"`
+}
+
+// validateOptions checks the item's variants and modifier groups and gives
+// new ones IDs. IDs sent back unchanged are kept so saved carts stay valid.
+func (it *Item) validateOptions() error {
+	seen := map[string]bool{}
+	id := func(cur string) (string, error) {
+		if cur == "" {
+			cur = utils.GenerateID(8)
+		}
+		if seen[cur] {
+			return "", fmt.Errorf("duplicate option id %q", cur)
+		}
+		seen[cur] = true
+		return cur, nil
+	}
+
+	var err error
+	for i := range it.Variants {
+		v := &it.Variants[i]
+		v.Name = strings.TrimSpace(v.Name)
+		if v.Name == "" || v.Price <= 0 {
+			return fmt.Errorf("every variant needs a name and a positive price")
+		}
+		if v.VariantID, err = id(v.VariantID); err != nil {
+			return err
+		}
+	}
+	for i := range it.ModifierGroups {
+		g := &it.ModifierGroups[i]
+		g.Name = strings.TrimSpace(g.Name)
+		if g.Name == "" || len(g.Modifiers) == 0 {
+			return fmt.Errorf("every modifier group needs a name and at least one modifier")
+		}
+		if g.Min < 0 || g.Max < 1 || g.Min > g.Max || g.Max > len(g.Modifiers) {
+			return fmt.Errorf("%s: rules must satisfy 0 <= min <= max <= number of modifiers, with max at least 1", g.Name)
+		}
+		if g.GroupID, err = id(g.GroupID); err != nil {
+			return err
+		}
+		for j := range g.Modifiers {
+			m := &g.Modifiers[j]
+			m.Name = strings.TrimSpace(m.Name)
+			if m.Name == "" || m.Price < 0 {
+				return fmt.Errorf("%s: every modifier needs a name and a price of 0 or more", g.Name)
+			}
+			if m.ModifierID, err = id(m.ModifierID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnitPrice checks a selection against the item's variants and modifier
+// rules and returns the price of one item made that way
+func (it Item) UnitPrice(sel Selection) (float64, error) {
+	price := it.Price
+	if len(it.Variants) > 0 {
+		if sel.VariantID == "" {
+			return 0, fmt.Errorf("choose a variant of %s", it.Name)
+		}
+		found := false
+		for _, v := range it.Variants {
+			if v.VariantID == sel.VariantID {
+				price, found = v.Price, true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown variant %q", sel.VariantID)
+		}
+	} else if sel.VariantID != "" {
+		return 0, fmt.Errorf("%s has no variants", it.Name)
+	}
+
+	picked := map[string]bool{}
+	for _, id := range sel.Modifiers {
+		if picked[id] {
+			return 0, fmt.Errorf("modifier %q chosen twice", id)
+		}
+		picked[id] = true
+	}
+	for _, g := range it.ModifierGroups {
+		n := 0
+		for _, m := range g.Modifiers {
+			if picked[m.ModifierID] {
+				n++
+				price += m.Price
+				delete(picked, m.ModifierID)
+			}
+		}
+		if n < g.Min || n > g.Max {
+			if g.Min == g.Max {
+				return 0, fmt.Errorf("%s: choose %d", g.Name, g.Min)
+			}
+			return 0, fmt.Errorf("%s: choose between %d and %d", g.Name, g.Min, g.Max)
+		}
+	}
+	for id := range picked {
+		return 0, fmt.Errorf("unknown modifier %q", id)
+	}
+	return math.Round(price*100) / 100, nil
+}
+
+// findItem loads a place's menu item with its options
+func findItem(ctx context.Context, placeID, menuID string) (Item, error) {
+	var it Item
+	err := db.MenuCollection.FindOne(ctx, bson.M{"placeid": placeID, "menuid": menuID}).Decode(&it)
+	return it, err
+}
+
+// SetMenuOptions replaces an item's category, variants and modifier groups:
+//
+//	{"categoryid": "...",
+//	 "variants": [{"name": "Small", "price": 8}, {"name": "Large", "price": 11}],
+//	 "modifier_groups": [{"name": "Sides", "min": 2, "max": 2, "modifiers": [
+//	   {"name": "Fries", "price": 0}, {"name": "Salad", "price": 1.5}, {"name": "Slaw", "price": 0}]}]}
+func SetMenuOptions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID, menuID := ps.ByName("placeid"), ps.ByName("menuid")
+	ctx := r.Context()
+
+	var req Item
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if err := req.validateOptions(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.CategoryID != "" {
+		if _, err := findCategory(ctx, placeID, req.CategoryID); err != nil {
+			http.Error(w, "Category not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	it, err := findItem(ctx, placeID, menuID)
+	if err != nil {
+		http.Error(w, "Menu not found", http.StatusNotFound)
+		return
+	}
+	it.CategoryID, it.Variants, it.ModifierGroups = req.CategoryID, req.Variants, req.ModifierGroups
+	it.UpdatedAt = time.Now()
+
+	update := bson.M{"$set": bson.M{
+		"variants":        it.Variants,
+		"modifier_groups": it.ModifierGroups,
+		"updated_at":      it.UpdatedAt,
+	}}
+	if it.CategoryID != "" {
+		update["$set"].(bson.M)["categoryid"] = it.CategoryID
+	} else {
+		update["$unset"] = bson.M{"categoryid": ""}
+	}
+	if _, err := db.MenuCollection.UpdateOne(ctx, bson.M{"placeid": placeID, "menuid": menuID}, update); err != nil {
+		http.Error(w, "Failed to update menu", http.StatusInternalServerError)
+		return
+	}
+
+	rdx.RdxDel(fmt.Sprintf("menu:%s:%s", placeID, menuID))
+	go mq.Emit("menu-edited", mq.Index{EntityType: "menu", EntityId: menuID, Method: "PUT", ItemType: "place", ItemId: placeID})
+
+	utils.SendJSONResponse(w, http.StatusOK, it)
+}
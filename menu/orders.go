@@ -0,0 +1,354 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/middleware"
+	"naevis/notifications"
+	"naevis/userdata"
+	"naevis/utils"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Order statuses, in lifecycle order. An order can be cancelled until it is
+// served.
+const (
+	OrderReceived  = "received"
+	OrderPreparing = "preparing"
+	OrderReady     = "ready"
+	OrderServed    = "served"
+	OrderPaid      = "paid"
+	OrderCancelled = "cancelled"
+)
+
+// nextStatuses lists the statuses each status can move to
+var nextStatuses = map[string][]string{
+	OrderReceived:  {OrderPreparing, OrderCancelled},
+	OrderPreparing: {OrderReady, OrderCancelled},
+	OrderReady:     {OrderServed, OrderCancelled},
+	OrderServed:    {OrderPaid},
+}
+
+const (
+	maxOrderLines = 50
+	maxLineQty    = 20
+)
+
+// Order is what a table ordered through its QR code
+type Order struct {
+	OrderID   string               `json:"orderid" bson:"orderid"`
+	PlaceID   string               `json:"placeid" bson:"placeid"`
+	Table     string               `json:"table" bson:"table"`
+	UserID    string               `json:"userid" bson:"userid"`
+	Lines     []OrderLine          `json:"lines" bson:"lines"`
+	Note      string               `json:"note,omitempty" bson:"note,omitempty"`
+	Total     float64              `json:"total" bson:"total"`
+	Status    string               `json:"status" bson:"status"`
+	History   map[string]time.Time `json:"history" bson:"history"` // When each status was reached
+	CreatedAt time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+// OrderLine is one item of an order, priced when the order was placed
+type OrderLine struct {
+	MenuID        string   `json:"menuId" bson:"menuid"`
+	Name          string   `json:"name" bson:"name"`
+	Quantity      int      `json:"quantity" bson:"quantity"`
+	Variant       string   `json:"variant,omitempty" bson:"variant,omitempty"`
+	ModifierNames []string `json:"modifierNames,omitempty" bson:"modifier_names,omitempty"`
+	UnitPrice     float64  `json:"unitPrice" bson:"unit_price"`
+	Total         float64  `json:"total" bson:"total"`
+	Selection     `bson:"selection"`
+}
+
+// describe fills the line's variant and modifier names from the item
+func (l *OrderLine) describe(it Item) {
+	l.Name = it.Name
+	for _, v := range it.Variants {
+		if v.VariantID == l.VariantID {
+			l.Variant = v.Name
+		}
+	}
+	for _, g := range it.ModifierGroups {
+		for _, m := range g.Modifiers {
+			if slices.Contains(l.Modifiers, m.ModifierID) {
+				l.ModifierNames = append(l.ModifierNames, m.Name)
+			}
+		}
+	}
+}
+
+// PlaceOrder places an order for the table whose QR code the diner scanned:
+//
+//	{"table": "12", "sig": "...", "note": "no nuts",
+//	 "lines": [{"menuId": "...", "quantity": 2, "variantId": "...", "modifiers": ["..."]}]}
+//
+// Each line is priced and checked against its item's rules, and taken out
+// of stock. The kitchen display hears about the order at once.
+func PlaceOrder(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	ctx := r.Context()
+
+	var req struct {
+		Table string      `json:"table"`
+		Sig   string      `json:"sig"`
+		Note  string      `json:"note"`
+		Lines []OrderLine `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if !validTableSig(placeID, req.Table, req.Sig) {
+		http.Error(w, "Scan the QR code on your table to order", http.StatusForbidden)
+		return
+	}
+	if len(req.Lines) == 0 || len(req.Lines) > maxOrderLines {
+		http.Error(w, fmt.Sprintf("An order needs between 1 and %d lines", maxOrderLines), http.StatusBadRequest)
+		return
+	}
+	if len(req.Note) > 500 {
+		http.Error(w, "Note is too long", http.StatusBadRequest)
+		return
+	}
+
+	order := Order{
+		OrderID: utils.GenerateID(12),
+		PlaceID: placeID,
+		Table:   req.Table,
+		UserID:  userID,
+		Note:    strings.TrimSpace(req.Note),
+		Status:  OrderReceived,
+	}
+	for i := range req.Lines {
+		line := req.Lines[i]
+		if line.Quantity < 1 || line.Quantity > maxLineQty {
+			http.Error(w, fmt.Sprintf("Quantities must be between 1 and %d", maxLineQty), http.StatusBadRequest)
+			return
+		}
+		it, unitPrice, status, err := priceSelection(ctx, placeID, line.MenuID, line.Selection)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		line.Variant, line.ModifierNames = "", nil
+		line.describe(it)
+		line.UnitPrice = unitPrice
+		line.Total = lineTotal(unitPrice, line.Quantity)
+		order.Lines = append(order.Lines, line)
+		order.Total += line.Total
+	}
+	order.Total = math.Round(order.Total*100) / 100
+
+	// Take stock line by line, giving it back if a later line runs out
+	for i, line := range order.Lines {
+		ok, err := takeStock(ctx, placeID, line.MenuID, line.Quantity)
+		if err != nil || !ok {
+			for _, taken := range order.Lines[:i] {
+				returnStock(ctx, placeID, taken.MenuID, taken.Quantity)
+			}
+			if err != nil {
+				http.Error(w, "Failed to update menu stock", http.StatusInternalServerError)
+			} else {
+				http.Error(w, line.Name+" is sold out", http.StatusConflict)
+			}
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	order.History = map[string]time.Time{OrderReceived: now}
+	order.CreatedAt, order.UpdatedAt = now, now
+	if _, err := db.OrdersCollection.InsertOne(ctx, order); err != nil {
+		for _, line := range order.Lines {
+			returnStock(ctx, placeID, line.MenuID, line.Quantity)
+		}
+		http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		return
+	}
+
+	publishOrder(ctx, "order_created", order)
+	utils.SendJSONResponse(w, http.StatusCreated, order)
+}
+
+// activeStatuses are the orders a kitchen is still working on
+var activeStatuses = []string{OrderReceived, OrderPreparing, OrderReady, OrderServed}
+
+// GetOrders lists a place's orders for staff, oldest first. By default only
+// active ones; ?status=paid (or any status) narrows to one status and
+// ?table to one table.
+func GetOrders(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q := r.URL.Query()
+	filter := bson.M{"placeid": ps.ByName("placeid"), "status": bson.M{"$in": activeStatuses}}
+	if status := q.Get("status"); status != "" {
+		filter["status"] = status
+	}
+	if table := q.Get("table"); table != "" {
+		filter["table"] = table
+	}
+
+	orders, err := findOrders(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, orders)
+}
+
+func findOrders(ctx context.Context, filter bson.M) ([]Order, error) {
+	cursor, err := db.OrdersCollection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(500))
+	if err != nil {
+		return nil, err
+	}
+	orders := []Order{}
+	err = cursor.All(ctx, &orders)
+	return orders, err
+}
+
+// loadOrder finds an order the caller may see: their own, or any at a
+// place they manage
+func loadOrder(ctx context.Context, placeID, orderID, userID string) (Order, int, error) {
+	var order Order
+	if err := db.OrdersCollection.FindOne(ctx, bson.M{"placeid": placeID, "orderid": orderID}).Decode(&order); err != nil {
+		return order, http.StatusNotFound, fmt.Errorf("Order not found")
+	}
+	if order.UserID != userID {
+		if ok, _ := middleware.IsPlaceManager(placeID, userID); !ok {
+			return order, http.StatusNotFound, fmt.Errorf("Order not found")
+		}
+	}
+	return order, http.StatusOK, nil
+}
+
+// GetOrder shows an order to the diner who placed it or to staff
+func GetOrder(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	order, status, err := loadOrder(r.Context(), ps.ByName("placeid"), ps.ByName("orderid"), userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, order)
+}
+
+// setOrderStatus moves an order on if its lifecycle allows it. A cancelled
+// order's items go back into stock.
+func setOrderStatus(ctx context.Context, order Order, status string) (Order, int, error) {
+	if !slices.Contains(nextStatuses[order.Status], status) {
+		return order, http.StatusConflict, fmt.Errorf("A %s order cannot become %s", order.Status, status)
+	}
+
+	now := time.Now().UTC()
+	result, err := db.OrdersCollection.UpdateOne(ctx,
+		bson.M{"orderid": order.OrderID, "status": order.Status},
+		bson.M{"$set": bson.M{"status": status, "history." + status: now, "updated_at": now}})
+	if err != nil {
+		return order, http.StatusInternalServerError, fmt.Errorf("Failed to update order")
+	}
+	if result.ModifiedCount == 0 {
+		return order, http.StatusConflict, fmt.Errorf("This order was changed meanwhile")
+	}
+
+	if status == OrderCancelled {
+		for _, line := range order.Lines {
+			returnStock(ctx, order.PlaceID, line.MenuID, line.Quantity)
+		}
+	}
+	if order.History == nil {
+		order.History = map[string]time.Time{}
+	}
+	order.Status, order.History[status], order.UpdatedAt = status, now, now
+	publishOrder(ctx, "order_updated", order)
+	return order, http.StatusOK, nil
+}
+
+// UpdateOrderStatus lets staff move an order through its lifecycle:
+//
+//	{"status": "preparing"}
+//
+// The diner is told when their order is ready or cancelled.
+func UpdateOrderStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	var order Order
+	if err := db.OrdersCollection.FindOne(r.Context(), bson.M{"placeid": ps.ByName("placeid"), "orderid": ps.ByName("orderid")}).Decode(&order); err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	order, status, err := setOrderStatus(r.Context(), order, req.Status)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch order.Status {
+	case OrderReady:
+		go notifications.Send(order.UserID, "order-ready", "Your order is ready", "Your order for table "+order.Table+" is on its way.", "place", order.PlaceID)
+	case OrderCancelled:
+		go notifications.Send(order.UserID, "order-cancelled", "Your order was cancelled", "Please ask the staff at your table.", "place", order.PlaceID)
+	}
+	utils.SendJSONResponse(w, http.StatusOK, order)
+}
+
+// PayOrder settles a served order for the diner who placed it, through the
+// same payment step as a menu purchase
+func PayOrder(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	ctx := r.Context()
+
+	order, status, err := loadOrder(ctx, ps.ByName("placeid"), ps.ByName("orderid"), userID)
+	if err == nil && order.UserID != userID {
+		status, err = http.StatusForbidden, fmt.Errorf("Only the diner who ordered can pay here")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if order.Status != OrderServed {
+		http.Error(w, "Orders are paid once they have been served", http.StatusConflict)
+		return
+	}
+
+	for _, line := range order.Lines {
+		if !ProcessMenuPayment(line.MenuID, order.PlaceID, line.Quantity) {
+			http.Error(w, "Payment failed", http.StatusBadRequest)
+			return
+		}
+	}
+	order, status, err = setOrderStatus(ctx, order, OrderPaid)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	for _, line := range order.Lines {
+		userdata.SetUserData("menu", line.MenuID, userID)
+	}
+	utils.SendJSONResponse(w, http.StatusOK, order)
+}
+
+// publishOrder tells kitchen displays about a new or changed order
+func publishOrder(ctx context.Context, kind string, order Order) {
+	msg, _ := json.Marshal(map[string]any{"type": kind, "order": order})
+	if err := publishKitchen(ctx, order.PlaceID, msg); err != nil {
+		log.Printf("kitchen display: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package menu
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/structs"
+	"naevis/trash"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/phpdave11/gofpdf"
+	qrcode "github.com/skip2/go-qrcode"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The most table codes printed in one sheet
+const maxTables = 200
+
+// Table labels are short names such as "12" or "patio-3"
+var tableLabel = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+
+// tableSig signs a place's table label so orders cannot name a table whose
+// QR code the diner never scanned
+func tableSig(placeID, table string) string {
+	h := hmac.New(sha256.New, globals.JwtSecret)
+	h.Write([]byte("table|" + placeID + "|" + table))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func validTableSig(placeID, table, sig string) bool {
+	return hmac.Equal([]byte(tableSig(placeID, table)), []byte(sig))
+}
+
+// tableLink is what a table's QR code opens
+func tableLink(placeID, table string) string {
+	q := url.Values{"table": {table}, "sig": {tableSig(placeID, table)}}
+	return globals.FrontendURL() + "/place/" + placeID + "/order?" + q.Encode()
+}
+
+// parseTables expands a list such as "1-12,bar,patio-1" into labels.
+// Numeric ranges are written low-high.
+func parseTables(spec string) ([]string, error) {
+	var tables []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			from, err1 := strconv.Atoi(lo)
+			to, err2 := strconv.Atoi(hi)
+			if err1 == nil && err2 == nil {
+				if from < 1 || to < from || to-from >= maxTables {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+				for n := from; n <= to; n++ {
+					tables = append(tables, strconv.Itoa(n))
+				}
+				continue
+			}
+		}
+		if !tableLabel.MatchString(part) {
+			return nil, fmt.Errorf("invalid table %q; use letters, digits, - and _", part)
+		}
+		tables = append(tables, part)
+	}
+	if len(tables) == 0 || len(tables) > maxTables {
+		return nil, fmt.Errorf("give between 1 and %d tables", maxTables)
+	}
+	return tables, nil
+}
+
+// GetTableQR generates the QR codes diners scan to order at a table.
+// ?tables=1-12,bar gives a printable A4 PDF with one labelled code per
+// table; ?tables=5&format=png gives a single code as an image.
+func GetTableQR(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	q := r.URL.Query()
+
+	if globals.FrontendURL() == "" {
+		http.Error(w, "Frontend URL is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	tables, err := parseTables(q.Get("tables"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("format") == "png" {
+		if len(tables) != 1 {
+			http.Error(w, "A PNG holds one table's code", http.StatusBadRequest)
+			return
+		}
+		png, err := qrcode.Encode(tableLink(placeID, tables[0]), qrcode.Medium, 512)
+		if err != nil {
+			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+		return
+	}
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+
+	// Three columns of four 65mm cards per A4 page
+	const cols, rows, card, size = 3, 4, 65.0, 45.0
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	imageOpts := gofpdf.ImageOptions{ImageType: "PNG"}
+	for i, table := range tables {
+		if i%(cols*rows) == 0 {
+			pdf.AddPage()
+		}
+		x := 10 + float64(i%cols)*card
+		y := 10 + float64((i/cols)%rows)*card
+
+		png, err := qrcode.Encode(tableLink(placeID, table), qrcode.Medium, 512)
+		if err != nil {
+			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+			return
+		}
+		name := "table-" + table
+		pdf.RegisterImageOptionsReader(name, imageOpts, bytes.NewReader(png))
+		pdf.ImageOptions(name, x+(card-size)/2, y, size, size, false, imageOpts, 0, "")
+
+		pdf.SetXY(x, y+size+1)
+		pdf.SetFont("Arial", "B", 14)
+		pdf.CellFormat(card, 7, "Table "+table, "", 2, "C", false, 0, "")
+		pdf.SetFont("Arial", "", 9)
+		pdf.CellFormat(card, 5, pdf.UnicodeTranslatorFromDescriptor("")(place.Name)+" - scan to order", "", 0, "C", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		http.Error(w, "Failed to generate PDF", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=tables-"+placeID+".pdf")
+	w.Write(buf.Bytes())
+}
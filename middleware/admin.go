@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"naevis/db"
+	"naevis/globals"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RoleAdmin is the User.Role of site administrators
+const RoleAdmin = "admin"
+
+// IsAdmin reports whether the user has the admin role
+func IsAdmin(userID string) bool {
+	var user struct {
+		Role string `bson:"role"`
+	}
+	err := db.UserCollection.FindOne(context.TODO(), bson.M{"userid": userID},
+		options.FindOne().SetProjection(bson.M{"role": 1})).Decode(&user)
+	return err == nil && user.Role == RoleAdmin
+}
+
+// RequireAdmin rejects callers who are not site administrators. It must run
+// inside Authenticate.
+func RequireAdmin(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, ok := r.Context().Value(globals.UserIDKey).(string)
+		if !ok || userID == "" {
+			http.Error(w, "Invalid user", http.StatusUnauthorized)
+			return
+		}
+		if !IsAdmin(userID) {
+			http.Error(w, "Admins only", http.StatusForbidden)
+			return
+		}
+		next(w, r, ps)
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/structs"
+	"naevis/trash"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Event permissions checked by RequireEventPermission
+const (
+	PermEventView    = "event:view"
+	PermEventEdit    = "event:edit"
+	PermEventDelete  = "event:delete"
+	PermTeamManage   = "team:manage"
+	PermTicketManage = "ticket:manage"
+	PermTicketScan   = "ticket:scan"
+	PermMerchManage  = "merch:manage"
+	PermMediaManage  = "media:manage"
+	PermAnalytics    = "analytics:view"
+)
+
+var eventRolePermissions = map[string][]string{
+	structs.EventRoleOwner: {
+		PermEventView, PermEventEdit, PermEventDelete, PermTeamManage,
+		PermTicketManage, PermTicketScan, PermMerchManage, PermMediaManage, PermAnalytics,
+	},
+	structs.EventRoleManager: {
+		PermEventView, PermEventEdit, PermTeamManage,
+		PermTicketManage, PermTicketScan, PermMerchManage, PermMediaManage, PermAnalytics,
+	},
+	structs.EventRoleBoxOffice: {PermEventView, PermTicketManage, PermTicketScan},
+	structs.EventRoleScanner:   {PermEventView, PermTicketScan},
+	structs.EventRoleViewer:    {PermEventView},
+}
+
+// EventRole returns the user's role on the event, or "" if they have none.
+// The team of a recurring series covers all its occurrences, so an
+// occurrence falls back to the role on its series master.
+func EventRole(eventID, userID string) (string, error) {
+	role, seriesID, err := ownEventRole(eventID, userID)
+	if err != nil || role != "" || seriesID == "" {
+		return role, err
+	}
+	role, _, err = ownEventRole(seriesID, userID)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	return role, err
+}
+
+// ownEventRole is the user's role from the event's own creator and team,
+// with the series the event belongs to, if any
+func ownEventRole(eventID, userID string) (string, string, error) {
+	var event struct {
+		CreatorID string `bson:"creatorid"`
+		SeriesID  string `bson:"seriesid"`
+	}
+	err := db.EventsCollection.FindOne(context.TODO(), trash.Live(bson.M{"eventid": eventID})).Decode(&event)
+	if err != nil {
+		return "", "", err
+	}
+	if event.CreatorID == userID {
+		return structs.EventRoleOwner, event.SeriesID, nil
+	}
+
+	var member structs.EventMember
+	err = db.EventMembersCollection.FindOne(context.TODO(), bson.M{
+		"eventid": eventID, "userid": userID, "status": "accepted",
+	}).Decode(&member)
+	if err == mongo.ErrNoDocuments {
+		return "", event.SeriesID, nil
+	}
+	return member.Role, event.SeriesID, err
+}
+
+// RoleHasPermission reports whether an event role grants the permission
+func RoleHasPermission(role, perm string) bool {
+	for _, p := range eventRolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasEventPermission reports whether the user may perform perm on the event
+func HasEventPermission(eventID, userID, perm string) bool {
+	role, err := EventRole(eventID, userID)
+	return err == nil && RoleHasPermission(role, perm)
+}
+
+// eventIDFromParams finds the event a request targets. Routes shared with
+// places (merch, media) carry an entity type; non-event entities are not
+// covered by event roles.
+func eventIDFromParams(ps httprouter.Params) (string, bool) {
+	entityType := ps.ByName("entitytype")
+	if entityType == "" {
+		entityType = ps.ByName("entityType")
+	}
+	if entityType != "" && entityType != "event" {
+		return "", false
+	}
+	if id := ps.ByName("eventid"); id != "" {
+		return id, true
+	}
+	return ps.ByName("entityid"), true
+}
+
+// RequireEventPermission rejects callers whose role on the event does not grant
+// perm. It must run inside Authenticate.
+func RequireEventPermission(perm string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		eventID, isEvent := eventIDFromParams(ps)
+		if !isEvent {
+			next(w, r, ps)
+			return
+		}
+
+		userID, ok := r.Context().Value(globals.UserIDKey).(string)
+		if !ok || userID == "" {
+			http.Error(w, "Invalid user", http.StatusUnauthorized)
+			return
+		}
+
+		role, err := EventRole(eventID, userID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				http.Error(w, "Event not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+			}
+			return
+		}
+		if !RoleHasPermission(role, perm) {
+			http.Error(w, "You do not have permission to do this on this event", http.StatusForbidden)
+			return
+		}
+
+		next(w, r, ps)
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/structs"
+	"naevis/trash"
+	"net/http"
+	"slices"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CanManagePlace reports whether the user owns the place or is one of its
+// managers
+func CanManagePlace(place structs.Place, userID string) bool {
+	return userID != "" && (place.CreatedBy == userID || slices.Contains(place.Managers, userID))
+}
+
+// IsPlaceManager loads the place and checks CanManagePlace
+func IsPlaceManager(placeID, userID string) (bool, error) {
+	var place structs.Place
+	err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place)
+	if err != nil {
+		return false, err
+	}
+	return CanManagePlace(place, userID), nil
+}
+
+// RequirePlaceManager rejects callers who neither own nor manage the place
+// named by the placeid route parameter. It must run inside Authenticate.
+func RequirePlaceManager(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, ok := r.Context().Value(globals.UserIDKey).(string)
+		if !ok || userID == "" {
+			http.Error(w, "Invalid user", http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := IsPlaceManager(ps.ByName("placeid"), userID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				http.Error(w, "Place not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+			}
+			return
+		}
+		if !allowed {
+			http.Error(w, "Only the place's owner and managers can do this", http.StatusForbidden)
+			return
+		}
+
+		next(w, r, ps)
+	}
+}
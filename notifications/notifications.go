@@ -0,0 +1,126 @@
+package notifications
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/mq"
+	"naevis/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Notification is a message shown in a user's inbox
+type Notification struct {
+	NotificationID string    `json:"notificationid" bson:"notificationid"`
+	UserID         string    `json:"userid" bson:"userid"`
+	Type           string    `json:"type" bson:"type"` // e.g. "event-cancelled", "question-answered"
+	Title          string    `json:"title" bson:"title"`
+	Body           string    `json:"body,omitempty" bson:"body,omitempty"`
+	EntityType     string    `json:"entity_type,omitempty" bson:"entity_type,omitempty"`
+	EntityID       string    `json:"entity_id,omitempty" bson:"entity_id,omitempty"`
+	Read           bool      `json:"read" bson:"read"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Send stores a notification for a single user
+func Send(userID, notifType, title, body, entityType, entityID string) {
+	SendMany([]string{userID}, notifType, title, body, entityType, entityID)
+}
+
+// SendMany stores the same notification for several users in one write
+func SendMany(userIDs []string, notifType, title, body, entityType, entityID string) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	now := time.Now()
+	docs := make([]any, 0, len(userIDs))
+	for _, userID := range userIDs {
+		docs = append(docs, Notification{
+			NotificationID: utils.GenerateID(16),
+			UserID:         userID,
+			Type:           notifType,
+			Title:          title,
+			Body:           body,
+			EntityType:     entityType,
+			EntityID:       entityID,
+			CreatedAt:      now,
+		})
+	}
+
+	if _, err := db.NotificationsCollection.InsertMany(context.TODO(), docs); err != nil {
+		log.Printf("Error storing %s notifications: %v", notifType, err)
+		return
+	}
+
+	mq.Notify(notifType, mq.Index{EntityType: entityType, EntityId: entityID})
+}
+
+// GetNotifications lists the caller's notifications, newest first
+func GetNotifications(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := bson.M{"userid": requestingUserID}
+	if r.URL.Query().Get("unread") == "true" {
+		filter["read"] = false
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := db.NotificationsCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		http.Error(w, "Failed to fetch notifications", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var list []Notification
+	if err := cursor.All(context.TODO(), &list); err != nil {
+		http.Error(w, "Failed to decode notifications", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []Notification{}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, list)
+}
+
+// MarkNotificationRead marks one of the caller's notifications as read
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.NotificationsCollection.UpdateOne(context.TODO(),
+		bson.M{"notificationid": ps.ByName("id"), "userid": requestingUserID},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		http.Error(w, "Failed to update notification", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]bool{"success": true})
+}
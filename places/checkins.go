@@ -0,0 +1,339 @@
+package places
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"naevis/activity"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/middleware"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// A check-in must be this close to the place, plus the device's reported
+	// accuracy up to maxCheckInAccuracy
+	checkInRadiusMeters = 150.0
+	maxCheckInAccuracy  = 100.0
+	// Repeat check-ins at the same place within this window are refused so
+	// they cannot inflate views or leaderboards
+	checkInCooldown      = time.Hour
+	maxCheckInImages     = 5
+	defaultCheckInsLimit = 20
+	maxCheckInsLimit     = 100
+	leaderboardSize      = 10
+)
+
+type checkInRequest struct {
+	Lat      *float64        `json:"lat"`
+	Lng      *float64        `json:"lng"`
+	Accuracy float64         `json:"accuracy"` // Meters, as reported by the device
+	Comment  string          `json:"comment"`
+	Rating   float64         `json:"rating"`
+	Images   []structs.Media `json:"images"`
+}
+
+// LeaderboardEntry is one visitor's check-in count for the week. The user
+// ID is only filled in for the place's owner and managers.
+type LeaderboardEntry struct {
+	UserID   string `json:"userId,omitempty" bson:"_id"`
+	Username string `json:"username" bson:"username"`
+	CheckIns int    `json:"checkins" bson:"checkins"`
+}
+
+func checkInsLimit(r *http.Request) int64 {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		return defaultCheckInsLimit
+	}
+	return int64(min(limit, maxCheckInsLimit))
+}
+
+// CheckIn records the caller at a place. The body carries the device's
+// lat/lng, which must be within checkInRadiusMeters of the place.
+func CheckIn(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	var req checkInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Lat == nil || req.Lng == nil {
+		http.Error(w, "lat and lng are required", http.StatusBadRequest)
+		return
+	}
+	if *req.Lat < -90 || *req.Lat > 90 || *req.Lng < -180 || *req.Lng > 180 {
+		http.Error(w, "lat must be within ±90 and lng within ±180", http.StatusBadRequest)
+		return
+	}
+	if req.Rating != 0 && (req.Rating < 1 || req.Rating > 5) {
+		http.Error(w, "rating must be between 1 and 5", http.StatusBadRequest)
+		return
+	}
+	if len(req.Images) > maxCheckInImages {
+		http.Error(w, fmt.Sprintf("at most %d images", maxCheckInImages), http.StatusBadRequest)
+		return
+	}
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	lat, lng, ok := place.Geo.LatLng()
+	if !ok {
+		http.Error(w, "This place has no location to check in against", http.StatusConflict)
+		return
+	}
+
+	distance := haversineMeters(*req.Lat, *req.Lng, lat, lng)
+	if distance > checkInRadiusMeters+min(max(req.Accuracy, 0), maxCheckInAccuracy) {
+		http.Error(w, fmt.Sprintf("You are %.0f m away; get closer to check in", distance), http.StatusForbidden)
+		return
+	}
+
+	// The count gives the friendly answer; the unique bucket index below
+	// settles check-ins that race past it
+	now := time.Now().UTC()
+	recent, err := db.CheckInsCollection.CountDocuments(context.TODO(), bson.M{
+		"placeId":   placeID,
+		"userId":    requestingUserID,
+		"timestamp": bson.M{"$gt": now.Add(-checkInCooldown)},
+	})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if recent > 0 {
+		http.Error(w, "You have already checked in here recently", http.StatusTooManyRequests)
+		return
+	}
+
+	images := make([]structs.Media, 0, len(req.Images))
+	for _, img := range req.Images {
+		if img.URL != "" {
+			images = append(images, structs.Media{Type: img.Type, URL: img.URL, Caption: img.Caption, CreatorID: requestingUserID})
+		}
+	}
+
+	checkIn := structs.CheckIn{
+		CheckInID: utils.GenerateID(16),
+		UserID:    requestingUserID,
+		PlaceID:   placeID,
+		Timestamp: now,
+		Comment:   req.Comment,
+		Rating:    req.Rating,
+		Medias:    images,
+		Distance:  distance,
+		Bucket:    now.Unix() / int64(checkInCooldown/time.Second),
+	}
+	if _, err := db.CheckInsCollection.InsertOne(context.TODO(), checkIn); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			http.Error(w, "You have already checked in here recently", http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Failed to check in", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := db.PlacesCollection.UpdateOne(context.TODO(), bson.M{"placeid": placeID}, bson.M{"$inc": bson.M{"views": 1}}); err != nil {
+		log.Printf("Error counting check-in view for place %s: %v", placeID, err)
+	}
+	rdx.RdxDel("place:" + placeID)
+
+	go activity.Record(structs.Activity{
+		Username:     usernameOf(requestingUserID),
+		PlaceID:      placeID,
+		Action:       "checkin",
+		PerformedBy:  requestingUserID,
+		ActivityType: "checkin",
+		Timestamp:    now,
+		Details:      place.Name,
+	})
+
+	checkIn.PlaceName = place.Name
+	utils.SendJSONResponse(w, http.StatusCreated, checkIn)
+}
+
+// GetPlaceCheckIns lists the most recent check-ins at a place. Who checked
+// in is only shown to the place's owner and managers, and how far away they
+// were to nobody.
+func GetPlaceCheckIns(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	manager := viewerManagesPlace(r, placeID)
+
+	cursor, err := db.CheckInsCollection.Find(context.TODO(), bson.M{"placeId": placeID},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(checkInsLimit(r)))
+	if err != nil {
+		http.Error(w, "Failed to fetch check-ins", http.StatusInternalServerError)
+		return
+	}
+	checkIns := []structs.CheckIn{}
+	if err := cursor.All(context.TODO(), &checkIns); err != nil {
+		http.Error(w, "Failed to decode check-ins", http.StatusInternalServerError)
+		return
+	}
+	for i := range checkIns {
+		checkIns[i].Distance = 0
+		if !manager {
+			checkIns[i].UserID = ""
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, checkIns)
+}
+
+// GetMyCheckIns is the caller's check-in history, newest first. Pass
+// ?before= with an RFC3339 timestamp to page back.
+func GetMyCheckIns(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	filter := bson.M{"userId": requestingUserID}
+	if v := r.URL.Query().Get("before"); v != "" {
+		before, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "before must be an RFC3339 time", http.StatusBadRequest)
+			return
+		}
+		filter["timestamp"] = bson.M{"$lt": before}
+	}
+
+	cursor, err := db.CheckInsCollection.Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(checkInsLimit(r)))
+	if err != nil {
+		http.Error(w, "Failed to fetch check-ins", http.StatusInternalServerError)
+		return
+	}
+	checkIns := []structs.CheckIn{}
+	if err := cursor.All(context.TODO(), &checkIns); err != nil {
+		http.Error(w, "Failed to decode check-ins", http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]string, 0, len(checkIns))
+	for _, c := range checkIns {
+		ids = append(ids, c.PlaceID)
+	}
+	names := map[string]string{}
+	if len(ids) > 0 {
+		pc, err := db.PlacesCollection.Find(context.TODO(), bson.M{"placeid": bson.M{"$in": ids}},
+			options.Find().SetProjection(bson.M{"placeid": 1, "name": 1}))
+		if err == nil {
+			var places []structs.Place
+			pc.All(context.TODO(), &places)
+			for _, p := range places {
+				names[p.PlaceID] = p.Name
+			}
+		}
+	}
+	for i := range checkIns {
+		checkIns[i].PlaceName = names[checkIns[i].PlaceID]
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, checkIns)
+}
+
+// GetCheckInLeaderboard ranks a place's visitors by check-ins in one week,
+// Monday to Sunday in the place's time zone. ?week= takes any date in the
+// week wanted (YYYY-MM-DD); the default is the current week. Visitors are
+// shown by username, which is public; user IDs only to the place's team.
+func GetCheckInLeaderboard(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	zone := structs.LoadZone(place.TimeZone)
+
+	day := time.Now().In(zone)
+	if v := r.URL.Query().Get("week"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, zone)
+		if err != nil {
+			http.Error(w, "week must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		day = t
+	}
+	y, m, d := day.Date()
+	sinceMonday := (int(day.Weekday()) + 6) % 7
+	start := time.Date(y, m, d-sinceMonday, 0, 0, 0, 0, zone)
+	end := time.Date(y, m, d-sinceMonday+7, 0, 0, 0, 0, zone)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"placeId": placeID, "timestamp": bson.M{"$gte": start, "$lt": end}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$userId", "checkins": bson.M{"$sum": 1}, "first": bson.M{"$min": "$timestamp"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "checkins", Value: -1}, {Key: "first", Value: 1}}}},
+		{{Key: "$limit", Value: leaderboardSize}},
+		{{Key: "$lookup", Value: bson.M{"from": "users", "localField": "_id", "foreignField": "userid", "as": "user"}}},
+		{{Key: "$project", Value: bson.M{"checkins": 1, "username": bson.M{"$first": "$user.username"}}}},
+	}
+	cursor, err := db.CheckInsCollection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		http.Error(w, "Failed to build leaderboard", http.StatusInternalServerError)
+		return
+	}
+	entries := []LeaderboardEntry{}
+	if err := cursor.All(context.TODO(), &entries); err != nil {
+		http.Error(w, "Failed to decode leaderboard", http.StatusInternalServerError)
+		return
+	}
+	if !viewerManagesPlace(r, placeID) {
+		for i := range entries {
+			entries[i].UserID = ""
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"placeid":    placeID,
+		"week_start": start.Format(time.RFC3339),
+		"week_end":   end.Format(time.RFC3339),
+		"leaders":    entries,
+	})
+}
+
+// viewerManagesPlace reports whether the request carries a token of the
+// place's owner or one of its managers. These routes are public, so no token
+// is fine.
+func viewerManagesPlace(r *http.Request, placeID string) bool {
+	claims, err := middleware.ValidateJWT(r.Header.Get("Authorization"))
+	if err != nil || claims.UserID == "" {
+		return false
+	}
+	manager, _ := middleware.IsPlaceManager(placeID, claims.UserID)
+	return manager
+}
+
+func usernameOf(userID string) string {
+	var user structs.User
+	err := db.UserCollection.FindOne(context.TODO(), bson.M{"userid": userID},
+		options.FindOne().SetProjection(bson.M{"username": 1})).Decode(&user)
+	if err != nil {
+		return ""
+	}
+	return user.Username
+}
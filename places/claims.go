@@ -0,0 +1,414 @@
+package places
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/mq"
+	"naevis/notifications"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/userdata"
+	"naevis/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Claim evidence may contain business documents, so it is kept outside
+// ./static and only served to admins
+var claimEvidenceDir = "./uploads/placeclaims"
+
+const maxClaimEvidenceFiles = 5
+
+var claimEvidenceTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// saveClaimEvidence stores the uploaded "evidence" files for a claim
+func saveClaimEvidence(r *http.Request, claimID string) ([]string, error) {
+	files := r.MultipartForm.File["evidence"]
+	if len(files) == 0 {
+		return nil, fmt.Errorf("at least one evidence file is required, e.g. a business licence or utility bill")
+	}
+	if len(files) > maxClaimEvidenceFiles {
+		return nil, fmt.Errorf("at most %d evidence files", maxClaimEvidenceFiles)
+	}
+
+	dir := filepath.Join(claimEvidenceDir, claimID)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating evidence directory")
+	}
+
+	var names []string
+	for i, fh := range files {
+		ext, ok := claimEvidenceTypes[fh.Header.Get("Content-Type")]
+		if !ok {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("evidence must be JPG, PNG, WEBP or PDF")
+		}
+		src, err := fh.Open()
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("error reading evidence")
+		}
+		name := fmt.Sprintf("%d%s", i+1, ext)
+		out, err := os.Create(filepath.Join(dir, name))
+		if err == nil {
+			_, err = io.Copy(out, src)
+			out.Close()
+		}
+		src.Close()
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("error saving evidence")
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// ClaimPlace files a request to take over a place listing. It takes a
+// multipart form with business_name, contact_email, contact_phone, message
+// and one or more evidence files.
+func ClaimPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	if place.Verified && place.CreatedBy == requestingUserID {
+		http.Error(w, "You already own this place", http.StatusConflict)
+		return
+	}
+
+	pending, err := db.PlaceClaimsCollection.CountDocuments(context.TODO(), bson.M{
+		"placeid": placeID, "userid": requestingUserID, "status": structs.ClaimPending,
+	})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if pending > 0 {
+		http.Error(w, "You already have a pending claim for this place", http.StatusConflict)
+		return
+	}
+
+	if err := r.ParseMultipartForm(25 << 20); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+	businessName := strings.TrimSpace(r.FormValue("business_name"))
+	email := strings.TrimSpace(r.FormValue("contact_email"))
+	phone := strings.TrimSpace(r.FormValue("contact_phone"))
+	if businessName == "" {
+		http.Error(w, "business_name is required", http.StatusBadRequest)
+		return
+	}
+	if email == "" && phone == "" {
+		http.Error(w, "contact_email or contact_phone is required", http.StatusBadRequest)
+		return
+	}
+
+	claim := structs.PlaceClaim{
+		ClaimID:      utils.GenerateID(16),
+		PlaceID:      placeID,
+		UserID:       requestingUserID,
+		Status:       structs.ClaimPending,
+		BusinessName: businessName,
+		ContactEmail: email,
+		ContactPhone: phone,
+		Message:      r.FormValue("message"),
+		CreatedAt:    time.Now().UTC(),
+	}
+	if claim.Evidence, err = saveClaimEvidence(r, claim.ClaimID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.PlaceClaimsCollection.InsertOne(context.TODO(), claim); err != nil {
+		os.RemoveAll(filepath.Join(claimEvidenceDir, claim.ClaimID))
+		http.Error(w, "Failed to submit claim", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, claim)
+}
+
+// GetMyClaims lists the caller's claims, newest first
+func GetMyClaims(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+	listClaims(w, bson.M{"userid": requestingUserID}, -1)
+}
+
+// GetClaimQueue is the admin review queue. ?status= defaults to pending,
+// which is listed oldest first.
+func GetClaimQueue(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = structs.ClaimPending
+	}
+	filter := bson.M{"status": status}
+	if p := r.URL.Query().Get("placeid"); p != "" {
+		filter["placeid"] = p
+	}
+	order := -1
+	if status == structs.ClaimPending {
+		order = 1
+	}
+	listClaims(w, filter, order)
+}
+
+// listClaims writes claims matching filter sorted by created_at in order (1 or -1)
+func listClaims(w http.ResponseWriter, filter bson.M, order int) {
+	cursor, err := db.PlaceClaimsCollection.Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: order}}).SetLimit(200))
+	if err != nil {
+		http.Error(w, "Failed to fetch claims", http.StatusInternalServerError)
+		return
+	}
+	claims := []structs.PlaceClaim{}
+	if err := cursor.All(context.TODO(), &claims); err != nil {
+		http.Error(w, "Failed to decode claims", http.StatusInternalServerError)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, claims)
+}
+
+// GetClaimEvidence serves one evidence file to admins
+func GetClaimEvidence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var claim structs.PlaceClaim
+	if err := db.PlaceClaimsCollection.FindOne(context.TODO(), bson.M{"claimid": ps.ByName("claimid")}).Decode(&claim); err != nil {
+		http.Error(w, "Claim not found", http.StatusNotFound)
+		return
+	}
+	file := ps.ByName("file")
+	if !slices.Contains(claim.Evidence, file) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(claimEvidenceDir, claim.ClaimID, file))
+}
+
+type claimReview struct {
+	Note string `json:"note"`
+}
+
+// loadPendingClaim reads the review body and the claim being reviewed
+func loadPendingClaim(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (structs.PlaceClaim, claimReview, bool) {
+	var claim structs.PlaceClaim
+	var review claimReview
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return claim, review, false
+		}
+	}
+	if err := db.PlaceClaimsCollection.FindOne(context.TODO(), bson.M{"claimid": ps.ByName("claimid")}).Decode(&claim); err != nil {
+		http.Error(w, "Claim not found", http.StatusNotFound)
+		return claim, review, false
+	}
+	if claim.Status != structs.ClaimPending {
+		http.Error(w, "Claim has already been reviewed", http.StatusConflict)
+		return claim, review, false
+	}
+	return claim, review, true
+}
+
+// ApproveClaim transfers the place to the claimant and marks it verified.
+// The previous owner's managers are removed and other pending claims for
+// the place are rejected.
+func ApproveClaim(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	adminID, _ := r.Context().Value(globals.UserIDKey).(string)
+	claim, review, ok := loadPendingClaim(w, r, ps)
+	if !ok {
+		return
+	}
+
+	var before structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": claim.PlaceID})).Decode(&before); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	res, err := db.PlaceClaimsCollection.UpdateOne(context.TODO(),
+		bson.M{"claimid": claim.ClaimID, "status": structs.ClaimPending},
+		bson.M{"$set": bson.M{"status": structs.ClaimApproved, "reviewed_by": adminID, "reviewed_at": now, "review_note": review.Note}})
+	if err != nil || res.ModifiedCount == 0 {
+		http.Error(w, "Claim has already been reviewed", http.StatusConflict)
+		return
+	}
+
+	var after structs.Place
+	err = db.PlacesCollection.FindOneAndUpdate(context.TODO(), bson.M{"placeid": claim.PlaceID},
+		bson.M{
+			"$set":   bson.M{"createdBy": claim.UserID, "verified": true, "verified_at": now, "updated_at": now, "updatedBy": adminID},
+			"$unset": bson.M{"managers": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&after)
+	if err != nil {
+		http.Error(w, "Failed to transfer place", http.StatusInternalServerError)
+		return
+	}
+
+	if before.CreatedBy != claim.UserID {
+		userdata.DelUserData("place", claim.PlaceID, before.CreatedBy)
+		userdata.SetUserData("place", claim.PlaceID, claim.UserID)
+	}
+	if _, err := RecordPlaceVersion(before, after, adminID, 0); err != nil {
+		log.Printf("Error recording version of place %s: %v", claim.PlaceID, err)
+	}
+	rdx.RdxDel("place:" + claim.PlaceID)
+	go mq.Emit("place-edited", mq.Index{EntityType: "place", EntityId: claim.PlaceID, Method: "PUT"})
+
+	// Only one business can own the place
+	cursor, err := db.PlaceClaimsCollection.Find(context.TODO(), bson.M{"placeid": claim.PlaceID, "status": structs.ClaimPending})
+	if err == nil {
+		var others []structs.PlaceClaim
+		cursor.All(context.TODO(), &others)
+		var losers []string
+		for _, o := range others {
+			losers = append(losers, o.UserID)
+		}
+		db.PlaceClaimsCollection.UpdateMany(context.TODO(),
+			bson.M{"placeid": claim.PlaceID, "status": structs.ClaimPending},
+			bson.M{"$set": bson.M{"status": structs.ClaimRejected, "reviewed_by": adminID, "reviewed_at": now, "review_note": "Another claim for this place was approved"}})
+		notifications.SendMany(losers, "place-claim-rejected", "Your claim for "+after.Name+" was not approved",
+			"Another claim for this place was approved.", "place", claim.PlaceID)
+	}
+
+	notifications.Send(claim.UserID, "place-claim-approved", "Your claim for "+after.Name+" was approved",
+		"You now own this listing and it shows as a verified business.", "place", claim.PlaceID)
+	if before.CreatedBy != "" && before.CreatedBy != claim.UserID {
+		notifications.Send(before.CreatedBy, "place-ownership-transferred", after.Name+" was claimed by its business",
+			"Ownership of this listing has moved to the verified business.", "place", claim.PlaceID)
+	}
+
+	claim.Status, claim.ReviewedBy, claim.ReviewedAt, claim.ReviewNote = structs.ClaimApproved, adminID, &now, review.Note
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{"claim": claim, "place": after})
+}
+
+// RejectClaim turns a claim down with an optional note for the claimant
+func RejectClaim(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	adminID, _ := r.Context().Value(globals.UserIDKey).(string)
+	claim, review, ok := loadPendingClaim(w, r, ps)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	res, err := db.PlaceClaimsCollection.UpdateOne(context.TODO(),
+		bson.M{"claimid": claim.ClaimID, "status": structs.ClaimPending},
+		bson.M{"$set": bson.M{"status": structs.ClaimRejected, "reviewed_by": adminID, "reviewed_at": now, "review_note": review.Note}})
+	if err != nil || res.ModifiedCount == 0 {
+		http.Error(w, "Claim has already been reviewed", http.StatusConflict)
+		return
+	}
+
+	notifications.Send(claim.UserID, "place-claim-rejected", "Your place claim was not approved", review.Note, "place", claim.PlaceID)
+
+	claim.Status, claim.ReviewedBy, claim.ReviewedAt, claim.ReviewNote = structs.ClaimRejected, adminID, &now, review.Note
+	utils.SendJSONResponse(w, http.StatusOK, claim)
+}
+
+// AddPlaceManager lets the owner give another user edit rights. Body: {"userid": "..."}
+func AddPlaceManager(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var body struct {
+		UserID string `json:"userid"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserID == "" {
+		http.Error(w, "userid is required", http.StatusBadRequest)
+		return
+	}
+	if err := db.UserCollection.FindOne(context.TODO(), bson.M{"userid": body.UserID}).Err(); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	setPlaceManager(w, r, ps, body.UserID, true)
+}
+
+// RemovePlaceManager revokes a manager's edit rights
+func RemovePlaceManager(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setPlaceManager(w, r, ps, ps.ByName("userid"), false)
+}
+
+func setPlaceManager(w http.ResponseWriter, r *http.Request, ps httprouter.Params, managerID string, add bool) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Place not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if place.CreatedBy != requestingUserID {
+		http.Error(w, "Only the owner can change managers", http.StatusForbidden)
+		return
+	}
+	if managerID == place.CreatedBy {
+		http.Error(w, "The owner is not a manager", http.StatusBadRequest)
+		return
+	}
+
+	update := bson.M{"$pull": bson.M{"managers": managerID}}
+	if add {
+		update = bson.M{"$addToSet": bson.M{"managers": managerID}}
+	}
+	var after structs.Place
+	err := db.PlacesCollection.FindOneAndUpdate(context.TODO(), bson.M{"placeid": placeID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&after)
+	if err != nil {
+		http.Error(w, "Failed to update managers", http.StatusInternalServerError)
+		return
+	}
+	if _, err := RecordPlaceVersion(place, after, requestingUserID, 0); err != nil {
+		log.Printf("Error recording version of place %s: %v", placeID, err)
+	}
+	rdx.RdxDel("place:" + placeID)
+
+	if add && !slices.Contains(place.Managers, managerID) {
+		notifications.Send(managerID, "place-manager-added", "You can now manage "+place.Name, "", "place", placeID)
+	}
+
+	managers := after.Managers
+	if managers == nil {
+		managers = []string{}
+	}
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{"placeid": placeID, "managers": managers})
+}
@@ -0,0 +1,382 @@
+package places
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"naevis/db"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultDiscoverLimit = 20
+	maxDiscoverLimit     = 100
+	maxFacetValues       = 30
+)
+
+// PlaceFilter is a set of facet selections. Values within category, city
+// and price level are alternatives (any of them matches); amenities, tags
+// and keywords must all be present.
+type PlaceFilter struct {
+	Categories  []string
+	Cities      []string
+	PriceLevels []int
+	Amenities   []string
+	Tags        []string
+	Keywords    []string
+	Wheelchair  bool
+}
+
+// NormalizeTerms lower-cases, trims and de-duplicates amenity, tag and
+// keyword values so they match facet filters
+func NormalizeTerms(values []string) []string {
+	terms := []string{}
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v != "" && !slices.Contains(terms, v) {
+			terms = append(terms, v)
+		}
+	}
+	return terms
+}
+
+// Fields whose values NormalizeTerms applies to
+var termFields = []string{"amenities", "tags", "keywords"}
+
+// normalizeStoredTerms lower-cases the amenities, tags and keywords of places
+// saved before NormalizeTerms, so "WiFi" matches amenities=wifi
+func normalizeStoredTerms(ctx context.Context) {
+	unnormalized := bson.A{}
+	projection := bson.M{"placeid": 1}
+	for _, f := range termFields {
+		unnormalized = append(unnormalized, bson.M{f: bson.M{"$regex": `[A-Z]|^\s|\s$`}})
+		projection[f] = 1
+	}
+	cursor, err := db.PlacesCollection.Find(ctx, bson.M{"$or": unnormalized}, options.Find().SetProjection(projection))
+	if err != nil {
+		log.Printf("Error finding places to normalize terms: %v", err)
+		return
+	}
+	var places []structs.Place
+	if err := cursor.All(ctx, &places); err != nil {
+		log.Printf("Error decoding places to normalize terms: %v", err)
+		return
+	}
+
+	for _, p := range places {
+		set := bson.M{}
+		for field, values := range map[string][]string{"amenities": p.Amenities, "tags": p.Tags, "keywords": p.Keywords} {
+			if values != nil {
+				set[field] = NormalizeTerms(values)
+			}
+		}
+		if _, err := db.PlacesCollection.UpdateOne(ctx, bson.M{"placeid": p.PlaceID}, bson.M{"$set": set}); err != nil {
+			log.Printf("Error normalizing terms of place %s: %v", p.PlaceID, err)
+			continue
+		}
+		rdx.RdxDel("place:" + p.PlaceID)
+	}
+}
+
+// multiValue reads a parameter given repeatedly or comma separated
+func multiValue(q url.Values, key string) []string {
+	var values []string
+	for _, v := range q[key] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+// ParsePlaceFilter reads category, city, price_level, amenities, tags,
+// keywords and wheelchair=true. Multi-select values may be repeated or
+// comma separated, e.g. amenities=wifi,parking.
+func ParsePlaceFilter(q url.Values) (PlaceFilter, error) {
+	f := PlaceFilter{
+		Categories: multiValue(q, "category"),
+		Cities:     multiValue(q, "city"),
+		Amenities:  NormalizeTerms(multiValue(q, "amenities")),
+		Tags:       NormalizeTerms(multiValue(q, "tags")),
+		Keywords:   NormalizeTerms(multiValue(q, "keywords")),
+	}
+	for _, v := range multiValue(q, "price_level") {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 4 {
+			return f, fmt.Errorf("price_level must be between 1 and 4")
+		}
+		f.PriceLevels = append(f.PriceLevels, n)
+	}
+	if v := q.Get("wheelchair"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("wheelchair must be true or false")
+		}
+		f.Wheelchair = b
+	}
+	return f, nil
+}
+
+// IsEmpty reports whether no facet is selected
+func (f PlaceFilter) IsEmpty() bool {
+	return len(f.Categories) == 0 && len(f.Cities) == 0 && len(f.PriceLevels) == 0 &&
+		len(f.Amenities) == 0 && len(f.Tags) == 0 && len(f.Keywords) == 0 && !f.Wheelchair
+}
+
+// required holds the selections every result must satisfy, so they are
+// applied before faceting
+func (f PlaceFilter) required() bson.M {
+	m := trash.Live(bson.M{})
+	if len(f.Amenities) > 0 {
+		m["amenities"] = bson.M{"$all": f.Amenities}
+	}
+	if len(f.Tags) > 0 {
+		m["tags"] = bson.M{"$all": f.Tags}
+	}
+	if len(f.Keywords) > 0 {
+		m["keywords"] = bson.M{"$all": f.Keywords}
+	}
+	if f.Wheelchair {
+		m["wheelchair"] = true
+	}
+	return m
+}
+
+// alternatives holds the any-of selections, leaving out the named facet so
+// its own counts still show the other choices
+func (f PlaceFilter) alternatives(except string) bson.M {
+	m := bson.M{}
+	if len(f.Categories) > 0 && except != "category" {
+		m["category"] = bson.M{"$in": f.Categories}
+	}
+	if len(f.Cities) > 0 && except != "city" {
+		m["city"] = bson.M{"$in": f.Cities}
+	}
+	if len(f.PriceLevels) > 0 && except != "price_level" {
+		m["price_level"] = bson.M{"$in": f.PriceLevels}
+	}
+	return m
+}
+
+// Filter is the complete query for the selection
+func (f PlaceFilter) Filter() bson.M {
+	m := f.required()
+	for k, v := range f.alternatives("") {
+		m[k] = v
+	}
+	return m
+}
+
+// FacetCount is one facet value and the number of matching places, shown
+// to users as e.g. "wifi (42)"
+type FacetCount struct {
+	Value any `json:"value" bson:"_id"`
+	Count int `json:"count" bson:"count"`
+}
+
+// PlaceDiscovery is the response of DiscoverPlaces
+type PlaceDiscovery struct {
+	Places []structs.Place         `json:"places"`
+	Total  int                     `json:"total"`
+	Facets map[string][]FacetCount `json:"facets"`
+}
+
+var discoverSorts = map[string]bson.D{
+	"reviews": {{Key: "reviewcount", Value: -1}, {Key: "placeid", Value: 1}},
+	"views":   {{Key: "views", Value: -1}, {Key: "placeid", Value: 1}},
+	"newest":  {{Key: "created_at", Value: -1}, {Key: "placeid", Value: 1}},
+	"name":    {{Key: "name", Value: 1}, {Key: "placeid", Value: 1}},
+}
+
+func facetStages(match bson.M, field string, array bool) mongo.Pipeline {
+	stages := mongo.Pipeline{{{Key: "$match", Value: match}}}
+	if array {
+		stages = append(stages, bson.D{{Key: "$unwind", Value: "$" + field}})
+	} else {
+		stages = append(stages, bson.D{{Key: "$match", Value: bson.M{field: bson.M{"$nin": bson.A{nil, "", 0}}}}})
+	}
+	return append(stages,
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: maxFacetValues}},
+	)
+}
+
+// DiscoverPlaces searches places by facets and returns a page of results
+// with counts for each facet value, e.g.
+//
+//	GET /api/places/discover?category=cafe&amenities=wifi,parking&wheelchair=true&price_level=1,2
+//
+// Counts for category, city and price level ignore that facet's own
+// selection so other choices stay visible; counts for amenities and tags
+// show how many results would remain after adding each value. Paging uses
+// limit and offset; sort is reviews (default), views, newest or name.
+func DiscoverPlaces(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+
+	f, err := ParsePlaceFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := defaultDiscoverLimit, 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxDiscoverLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	sortBy := q.Get("sort")
+	if sortBy == "" {
+		sortBy = "reviews"
+	}
+	sortOrder, ok := discoverSorts[sortBy]
+	if !ok {
+		http.Error(w, "sort must be reviews, views, newest or name", http.StatusBadRequest)
+		return
+	}
+
+	all := f.alternatives("")
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: f.required()}},
+		{{Key: "$facet", Value: bson.M{
+			"places": mongo.Pipeline{
+				{{Key: "$match", Value: all}},
+				{{Key: "$sort", Value: sortOrder}},
+				{{Key: "$skip", Value: offset}},
+				{{Key: "$limit", Value: limit}},
+			},
+			"total": mongo.Pipeline{
+				{{Key: "$match", Value: all}},
+				{{Key: "$count", Value: "count"}},
+			},
+			"category":    facetStages(f.alternatives("category"), "category", false),
+			"city":        facetStages(f.alternatives("city"), "city", false),
+			"price_level": facetStages(f.alternatives("price_level"), "price_level", false),
+			"amenities":   facetStages(all, "amenities", true),
+			"tags":        facetStages(all, "tags", true),
+			"wheelchair": mongo.Pipeline{
+				{{Key: "$match", Value: all}},
+				{{Key: "$match", Value: bson.M{"wheelchair": true}}},
+				{{Key: "$group", Value: bson.M{"_id": true, "count": bson.M{"$sum": 1}}}},
+			},
+		}}},
+	}
+
+	cursor, err := db.PlacesCollection.Aggregate(r.Context(), pipeline)
+	if err != nil {
+		http.Error(w, "Failed to search places", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var result []struct {
+		Places     []structs.Place `bson:"places"`
+		Total      []FacetCount    `bson:"total"`
+		Category   []FacetCount    `bson:"category"`
+		City       []FacetCount    `bson:"city"`
+		PriceLevel []FacetCount    `bson:"price_level"`
+		Amenities  []FacetCount    `bson:"amenities"`
+		Tags       []FacetCount    `bson:"tags"`
+		Wheelchair []FacetCount    `bson:"wheelchair"`
+	}
+	if err := cursor.All(r.Context(), &result); err != nil || len(result) == 0 {
+		http.Error(w, "Failed to decode places", http.StatusInternalServerError)
+		return
+	}
+	res := result[0]
+
+	resp := PlaceDiscovery{
+		Places: res.Places,
+		Facets: map[string][]FacetCount{
+			"category":    res.Category,
+			"city":        res.City,
+			"price_level": res.PriceLevel,
+			"amenities":   res.Amenities,
+			"tags":        res.Tags,
+			"wheelchair":  res.Wheelchair,
+		},
+	}
+	if resp.Places == nil {
+		resp.Places = []structs.Place{}
+	}
+	for i := range resp.Places {
+		resp.Places[i].Localize()
+	}
+	if len(res.Total) > 0 {
+		resp.Total = res.Total[0].Count
+	}
+	for k, v := range resp.Facets {
+		if v == nil {
+			resp.Facets[k] = []FacetCount{}
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, resp)
+}
+
+// applyFacetForm reads the facet fields of a place form (amenities, tags and
+// keywords comma separated, city, price_level, wheelchair and
+// accessibility_info) into place and returns the fields it set. Fields that
+// are not in the form are left alone.
+func applyFacetForm(r *http.Request, place *structs.Place) (bson.M, error) {
+	set := bson.M{}
+	terms := map[string]*[]string{"amenities": &place.Amenities, "tags": &place.Tags, "keywords": &place.Keywords}
+	for key, field := range terms {
+		if _, ok := r.Form[key]; ok {
+			*field = NormalizeTerms(multiValue(r.Form, key))
+			set[key] = *field
+		}
+	}
+	if _, ok := r.Form["city"]; ok {
+		place.City = strings.TrimSpace(r.FormValue("city"))
+		set["city"] = place.City
+	}
+	if _, ok := r.Form["accessibility_info"]; ok {
+		place.AccessibilityInfo = r.FormValue("accessibility_info")
+		set["accessibility_info"] = place.AccessibilityInfo
+	}
+	if v := r.FormValue("price_level"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 4 {
+			return nil, fmt.Errorf("price_level must be between 1 and 4, or 0 if unknown")
+		}
+		place.PriceLevel = n
+		set["price_level"] = n
+	}
+	if v := r.FormValue("wheelchair"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("wheelchair must be true or false")
+		}
+		place.Wheelchair = b
+		set["wheelchair"] = b
+	}
+	return set, nil
+}
@@ -7,9 +7,11 @@ import (
 	"naevis/autocom"
 	"naevis/db"
 	"naevis/globals"
+	"naevis/middleware"
 	"naevis/mq"
 	"naevis/rdx"
 	"naevis/structs"
+	"naevis/trash"
 	"naevis/userdata"
 	"naevis/utils"
 	"net/http"
@@ -51,7 +53,7 @@ func EditPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Fetch the existing place
 	var place structs.Place
-	err := db.PlacesCollection.FindOne(context.TODO(), bson.M{"placeid": placeID}).Decode(&place)
+	err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			http.Error(w, "Place not found", http.StatusNotFound)
@@ -62,7 +64,7 @@ func EditPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	// Ensure authorization
-	if place.CreatedBy != requestingUserID {
+	if !middleware.CanManagePlace(place, requestingUserID) {
 		http.Error(w, "You are not authorized to edit this place", http.StatusForbidden)
 		return
 	}
@@ -88,6 +90,39 @@ func EditPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	if category := r.FormValue("category"); category != "" {
 		updateFields["category"] = category
 	}
+	if r.FormValue("lat") != "" || r.FormValue("lng") != "" {
+		lat, lng, err := ParseCoordinates(r.FormValue("lat"), r.FormValue("lng"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updateFields["location"] = structs.Coordinates{Latitude: lat, Longitude: lng}
+		updateFields["geo"] = structs.NewGeoPoint(lat, lng)
+	}
+	if timeZone := r.FormValue("timezone"); timeZone != "" {
+		if !structs.ValidTimeZone(timeZone) {
+			http.Error(w, "timezone must be an IANA time zone such as Europe/Berlin", http.StatusBadRequest)
+			return
+		}
+		updateFields["timezone"] = timeZone
+	}
+	if v := r.FormValue("operating_hours"); v != "" {
+		hours, err := parseOperatingHours([]byte(v))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updateFields["operating_hours"] = hours
+	}
+	edited := place
+	facets, err := applyFacetForm(r, &edited)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for k, v := range facets {
+		updateFields[k] = v
+	}
 
 	// Handle banner upload
 	banner, err := handleBannerUpload(w, r, placeID)
@@ -101,10 +136,19 @@ func EditPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Update database
 	updateFields["updated_at"] = time.Now()
+	updateFields["updatedBy"] = requestingUserID
 	if err := updatePlaceInDB(w, placeID, updateFields); err != nil {
 		return
 	}
 
+	// Record the edit in the place's history
+	var updated structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&updated); err == nil {
+		if _, err := RecordPlaceVersion(place, updated, requestingUserID, 0); err != nil {
+			log.Printf("Error recording version of place %s: %v", placeID, err)
+		}
+	}
+
 	utils.CreateThumb(placeID, bannerDir, ".jpg", 300, 200)
 
 	go mq.Emit("place-edited", mq.Index{EntityType: "place", EntityId: placeID, Method: "PUT"})
@@ -125,7 +169,7 @@ func DeletePlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// log.Println("Requesting User ID:", requestingUserID)
 
 	// Get the place from the database using placeID
-	err := db.PlacesCollection.FindOne(context.TODO(), bson.M{"placeid": placeID}).Decode(&place)
+	err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			http.Error(w, "Place not found", http.StatusNotFound)
@@ -141,8 +185,10 @@ func DeletePlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
-	// Delete the place from MongoDB
-	_, err = db.PlacesCollection.DeleteOne(context.TODO(), bson.M{"placeid": placeID})
+	// Move the place to the trash; menus, media and files stay until the
+	// purge job so it can be restored (see PurgeDeletedPlaces)
+	now := time.Now().UTC()
+	_, err = db.PlacesCollection.UpdateOne(context.TODO(), trash.Live(bson.M{"placeid": placeID}), bson.M{"$set": bson.M{trash.Field: now}})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -157,8 +203,9 @@ func DeletePlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Respond with success
 	w.WriteHeader(http.StatusOK)
 	response := map[string]any{
-		"status":  http.StatusNoContent,
-		"message": "Place deleted successfully",
+		"status":   http.StatusNoContent,
+		"message":  "Place moved to trash",
+		"purge_at": now.Add(trash.Retention),
 	}
 	json.NewEncoder(w).Encode(response)
 }
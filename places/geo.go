@@ -0,0 +1,330 @@
+package places
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"naevis/db"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultNearbyRadiusKm = 5.0
+	maxNearbyRadiusKm     = 100.0
+	defaultNearbyLimit    = 20
+	maxNearbyLimit        = 100
+	defaultBBoxLimit      = 200
+	maxBBoxLimit          = 500
+	earthRadiusMeters     = 6371008.8
+)
+
+// NearbyQuery describes a radius search around a point
+type NearbyQuery struct {
+	Lat, Lng  float64
+	RadiusKm  float64
+	Category  string
+	ExcludeID string
+	Sort      string // "distance" (default) or "reviews"
+	Limit     int
+}
+
+// ParseCoordinates reads a latitude/longitude pair and checks its range
+func ParseCoordinates(latStr, lngStr string) (float64, float64, error) {
+	lat, err1 := strconv.ParseFloat(latStr, 64)
+	lng, err2 := strconv.ParseFloat(lngStr, 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return 0, 0, fmt.Errorf("lat must be within ±90 and lng within ±180")
+	}
+	return lat, lng, nil
+}
+
+// ParseNearbyQuery reads lat, lng (or place to search around another place),
+// radius (km), category, sort and limit
+func ParseNearbyQuery(q url.Values) (NearbyQuery, error) {
+	nq := NearbyQuery{
+		RadiusKm: defaultNearbyRadiusKm,
+		Category: q.Get("category"),
+		Sort:     q.Get("sort"),
+		Limit:    defaultNearbyLimit,
+	}
+
+	switch {
+	case q.Get("lat") != "" || q.Get("lng") != "":
+		lat, lng, err := ParseCoordinates(q.Get("lat"), q.Get("lng"))
+		if err != nil {
+			return nq, err
+		}
+		nq.Lat, nq.Lng = lat, lng
+		nq.ExcludeID = q.Get("place")
+	case q.Get("place") != "":
+		var place structs.Place
+		if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": q.Get("place")})).Decode(&place); err != nil {
+			return nq, fmt.Errorf("place not found")
+		}
+		lat, lng, ok := place.Geo.LatLng()
+		if !ok {
+			return nq, fmt.Errorf("place has no location")
+		}
+		nq.Lat, nq.Lng, nq.ExcludeID = lat, lng, place.PlaceID
+	default:
+		return nq, fmt.Errorf("lat and lng (or place) are required")
+	}
+
+	if v := q.Get("radius"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 || r > maxNearbyRadiusKm {
+			return nq, fmt.Errorf("radius must be between 0 and %.0f km", maxNearbyRadiusKm)
+		}
+		nq.RadiusKm = r
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nq, fmt.Errorf("invalid limit")
+		}
+		nq.Limit = min(n, maxNearbyLimit)
+	}
+	if nq.Sort == "" {
+		nq.Sort = "distance"
+	}
+	if nq.Sort != "distance" && nq.Sort != "reviews" {
+		return nq, fmt.Errorf("sort must be distance or reviews")
+	}
+	return nq, nil
+}
+
+// FindNearby returns places within the radius, nearest first (or most
+// reviewed first), with Distance set in meters
+func FindNearby(nq NearbyQuery) ([]structs.Place, error) {
+	query := trash.Live(bson.M{})
+	if nq.Category != "" {
+		query["category"] = nq.Category
+	}
+	if nq.ExcludeID != "" {
+		query["placeid"] = bson.M{"$ne": nq.ExcludeID}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          structs.NewGeoPoint(nq.Lat, nq.Lng),
+			"key":           "geo",
+			"distanceField": "distance",
+			"maxDistance":   nq.RadiusKm * 1000,
+			"spherical":     true,
+			"query":         query,
+		}}},
+	}
+	if nq.Sort == "reviews" {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "reviewcount", Value: -1}, {Key: "distance", Value: 1}}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: nq.Limit}})
+
+	cursor, err := db.PlacesCollection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	places := []structs.Place{}
+	if err := cursor.All(context.TODO(), &places); err != nil {
+		return nil, err
+	}
+	return places, nil
+}
+
+// GetNearbyPlaces returns places around lat/lng. See ParseNearbyQuery.
+func GetNearbyPlaces(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	nq, err := ParseNearbyQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	places, err := FindNearby(nq)
+	if err != nil {
+		http.Error(w, "Failed to search nearby places", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, places)
+}
+
+// GetPlacesInBBox returns places inside bbox=west,south,east,north for map
+// views. Distance is measured from lat/lng when given, otherwise from the
+// centre of the box, and results are sorted by it.
+func GetPlacesInBBox(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+
+	parts := strings.Split(q.Get("bbox"), ",")
+	if len(parts) != 4 {
+		http.Error(w, "bbox must be west,south,east,north", http.StatusBadRequest)
+		return
+	}
+	var box [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			http.Error(w, "bbox must be west,south,east,north", http.StatusBadRequest)
+			return
+		}
+		box[i] = v
+	}
+	west, south, east, north := box[0], box[1], box[2], box[3]
+	if south >= north || west >= east || south < -90 || north > 90 || west < -180 || east > 180 {
+		http.Error(w, "bbox is out of range or inverted", http.StatusBadRequest)
+		return
+	}
+
+	refLat, refLng := (south+north)/2, (west+east)/2
+	if q.Get("lat") != "" || q.Get("lng") != "" {
+		lat, lng, err := ParseCoordinates(q.Get("lat"), q.Get("lng"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		refLat, refLng = lat, lng
+	}
+
+	limit := defaultBBoxLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxBBoxLimit)
+	}
+
+	// A box polygon is used rather than $box, which only works on legacy pairs
+	filter := trash.Live(bson.M{"geo": bson.M{"$geoWithin": bson.M{"$geometry": bson.M{
+		"type": "Polygon",
+		"coordinates": bson.A{bson.A{
+			bson.A{west, south}, bson.A{east, south}, bson.A{east, north}, bson.A{west, north}, bson.A{west, south},
+		}},
+	}}}})
+	if c := q.Get("category"); c != "" {
+		filter["category"] = c
+	}
+
+	cursor, err := db.PlacesCollection.Find(context.TODO(), filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		http.Error(w, "Failed to search places", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	places := []structs.Place{}
+	if err := cursor.All(context.TODO(), &places); err != nil {
+		http.Error(w, "Failed to decode places", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range places {
+		if lat, lng, ok := places[i].Geo.LatLng(); ok {
+			places[i].Distance = haversineMeters(refLat, refLng, lat, lng)
+		}
+	}
+	sort.SliceStable(places, func(i, j int) bool { return places[i].Distance < places[j].Distance })
+
+	utils.SendJSONResponse(w, http.StatusOK, places)
+}
+
+// haversineMeters is the great-circle distance between two points
+func haversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// EnsurePlaceIndexes creates the 2dsphere index used by nearby and bbox
+// searches, fills geo for places stored with only lat/lng fields, moves
+// hours stored under the old key, lower-cases stored facet terms, and
+// indexes place history, check-ins and claims
+func EnsurePlaceIndexes() {
+	ctx := context.TODO()
+
+	migrateLegacyHours(ctx)
+	normalizeStoredTerms(ctx)
+
+	cursor, err := db.PlacesCollection.Find(ctx, bson.M{
+		"geo":                bson.M{"$exists": false},
+		"location.latitude":  bson.M{"$exists": true},
+		"location.longitude": bson.M{"$exists": true},
+	}, options.Find().SetProjection(bson.M{"placeid": 1, "location": 1}))
+	if err != nil {
+		log.Printf("Error finding places to backfill geo: %v", err)
+	} else {
+		var places []structs.Place
+		if err := cursor.All(ctx, &places); err != nil {
+			log.Printf("Error decoding places to backfill geo: %v", err)
+		}
+		for _, p := range places {
+			geo := structs.NewGeoPoint(p.Location.Latitude, p.Location.Longitude)
+			if _, err := db.PlacesCollection.UpdateOne(ctx, bson.M{"placeid": p.PlaceID}, bson.M{"$set": bson.M{"geo": geo}}); err != nil {
+				log.Printf("Error backfilling geo for place %s: %v", p.PlaceID, err)
+			}
+		}
+	}
+
+	if _, err := db.PlacesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "geo", Value: "2dsphere"}, {Key: "category", Value: 1}}},
+	}); err != nil {
+		log.Printf("Error creating place geo index: %v", err)
+	}
+
+	// Facet filters; see DiscoverPlaces
+	if _, err := db.PlacesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "placeid", Value: 1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "city", Value: 1}, {Key: "price_level", Value: 1}}},
+		{Keys: bson.D{{Key: "city", Value: 1}, {Key: "price_level", Value: 1}}},
+		{Keys: bson.D{{Key: "amenities", Value: 1}, {Key: "category", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "keywords", Value: 1}}},
+		{Keys: bson.D{{Key: "wheelchair", Value: 1}, {Key: "category", Value: 1}}, Options: options.Index().SetPartialFilterExpression(bson.M{"wheelchair": true})},
+	}); err != nil {
+		log.Printf("Error creating place facet indexes: %v", err)
+	}
+
+	if _, err := db.PlaceVersionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "placeId", Value: 1}, {Key: "version", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "updatedBy", Value: 1}, {Key: "updatedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "updatedAt", Value: -1}}},
+	}); err != nil {
+		log.Printf("Error creating place version indexes: %v", err)
+	}
+
+	if _, err := db.CheckInsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "checkinid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "placeId", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "timestamp", Value: -1}}},
+		// One check-in per user, place and cooldown window; see CheckIn
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "placeId", Value: 1}, {Key: "bucket", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"bucket": bson.M{"$exists": true}})},
+	}); err != nil {
+		log.Printf("Error creating check-in indexes: %v", err)
+	}
+
+	if _, err := db.PlaceClaimsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "claimid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "placeid", Value: 1}, {Key: "userid", Value: 1}, {Key: "status", Value: 1}}},
+	}); err != nil {
+		log.Printf("Error creating place claim indexes: %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package places
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"naevis/autocom"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/middleware"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Fields that are not part of a place's editable content. They are left out
+// of diffs and never restored by a rollback.
+var unversionedPlaceFields = map[string]bool{
+	"_id": true, "placeid": true, "created_at": true, "updated_at": true,
+	"updatedBy": true, "reviewcount": true, "views": true, "external_id": true,
+	"deletedAt": true,
+}
+
+// Fields that say who owns and runs a place. Changes to them show in the
+// history, e.g. a claim moving ownership, but a rollback leaves them alone.
+var ownershipPlaceFields = map[string]bool{
+	"createdBy": true, "verified": true, "verified_at": true, "managers": true,
+}
+
+// restorable reports whether a rollback may set the field
+func restorable(field string) bool {
+	return !unversionedPlaceFields[field] && !ownershipPlaceFields[field]
+}
+
+func placeDoc(p structs.Place) bson.M {
+	raw, _ := bson.Marshal(p)
+	var m bson.M
+	bson.Unmarshal(raw, &m)
+	return m
+}
+
+func diffValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// diffPlaces returns "old → new" for every content field that differs
+func diffPlaces(before, after structs.Place) map[string]string {
+	b, a := placeDoc(before), placeDoc(after)
+	changes := map[string]string{}
+	for k := range a {
+		if !unversionedPlaceFields[k] && !reflect.DeepEqual(a[k], b[k]) {
+			changes[k] = diffValue(b[k]) + " → " + diffValue(a[k])
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok && !unversionedPlaceFields[k] {
+			changes[k] = diffValue(b[k]) + " → "
+		}
+	}
+	return changes
+}
+
+func latestPlaceVersion(placeID string) (int, error) {
+	var last structs.PlaceVersion
+	err := db.PlaceVersionsCollection.FindOne(context.TODO(), bson.M{"placeId": placeID},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return last.Version, err
+}
+
+// RecordPlaceVersion stores the place as it is after an edit, with a diff
+// against before. Places edited for the first time also get their original
+// state saved as version 1 so it can be rolled back to.
+func RecordPlaceVersion(before, after structs.Place, editor string, restoredFrom int) (*structs.PlaceVersion, error) {
+	changes := diffPlaces(before, after)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	last, err := latestPlaceVersion(after.PlaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	if last == 0 {
+		baseline := structs.PlaceVersion{
+			PlaceID:   before.PlaceID,
+			Version:   1,
+			Data:      before,
+			UpdatedAt: before.CreatedAt,
+			UpdatedBy: before.CreatedBy,
+		}
+		if !before.UpdatedAt.IsZero() {
+			baseline.UpdatedAt = before.UpdatedAt
+		}
+		if _, err := db.PlaceVersionsCollection.InsertOne(ctx, baseline); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		last = 1
+	}
+
+	v := structs.PlaceVersion{
+		PlaceID:      after.PlaceID,
+		Data:         after,
+		UpdatedAt:    time.Now().UTC(),
+		UpdatedBy:    editor,
+		Changes:      changes,
+		RestoredFrom: restoredFrom,
+	}
+
+	// Concurrent edits race for the next number; the unique index picks a winner
+	for attempt := 0; attempt < 3; attempt++ {
+		v.Version = last + 1
+		_, err = db.PlaceVersionsCollection.InsertOne(ctx, v)
+		if err == nil || !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+		if last, err = latestPlaceVersion(after.PlaceID); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func parseHistoryLimit(r *http.Request) int64 {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return int64(limit)
+}
+
+// GetPlaceHistory lists a place's versions, newest first. Only the owner and
+// admins can see it since versions record who made each change.
+func GetPlaceHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, _ := r.Context().Value(globals.UserIDKey).(string)
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	if !middleware.CanManagePlace(place, requestingUserID) && !middleware.IsAdmin(requestingUserID) {
+		http.Error(w, "You are not authorized to view this place's history", http.StatusForbidden)
+		return
+	}
+
+	filter := bson.M{"placeId": placeID}
+	if before, err := strconv.Atoi(r.URL.Query().Get("before")); err == nil {
+		filter["version"] = bson.M{"$lt": before}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}}).SetLimit(parseHistoryLimit(r))
+	if r.URL.Query().Get("full") != "true" {
+		opts.SetProjection(bson.M{"data": 0})
+	}
+
+	cursor, err := db.PlaceVersionsCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		http.Error(w, "Failed to fetch history", http.StatusInternalServerError)
+		return
+	}
+	versions := []structs.PlaceVersion{}
+	if err := cursor.All(context.TODO(), &versions); err != nil {
+		http.Error(w, "Failed to decode history", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, versions)
+}
+
+// GetPlaceVersion returns one version including its full snapshot
+func GetPlaceVersion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, _ := r.Context().Value(globals.UserIDKey).(string)
+
+	version, err := strconv.Atoi(ps.ByName("version"))
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	if !middleware.CanManagePlace(place, requestingUserID) && !middleware.IsAdmin(requestingUserID) {
+		http.Error(w, "You are not authorized to view this place's history", http.StatusForbidden)
+		return
+	}
+
+	var v structs.PlaceVersion
+	if err := db.PlaceVersionsCollection.FindOne(context.TODO(), bson.M{"placeId": placeID, "version": version}).Decode(&v); err != nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, v)
+}
+
+// RollbackPlace restores a place's content to an earlier version. The
+// rollback is itself recorded as a new version.
+func RollbackPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	version, err := strconv.Atoi(ps.ByName("version"))
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	var current structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&current); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	if !middleware.CanManagePlace(current, requestingUserID) {
+		http.Error(w, "You are not authorized to edit this place", http.StatusForbidden)
+		return
+	}
+
+	var target structs.PlaceVersion
+	if err := db.PlaceVersionsCollection.FindOne(context.TODO(), bson.M{"placeId": placeID, "version": version}).Decode(&target); err != nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	snapshot, live := placeDoc(target.Data), placeDoc(current)
+	set := bson.M{"updated_at": time.Now(), "updatedBy": requestingUserID}
+	unset := bson.M{}
+	for k, v := range snapshot {
+		if restorable(k) {
+			set[k] = v
+		}
+	}
+	for k := range live {
+		if _, ok := snapshot[k]; !ok && restorable(k) {
+			unset[k] = ""
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var restored structs.Place
+	err = db.PlacesCollection.FindOneAndUpdate(context.TODO(), bson.M{"placeid": placeID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&restored)
+	if err != nil {
+		http.Error(w, "Failed to roll back place", http.StatusInternalServerError)
+		return
+	}
+
+	v, err := RecordPlaceVersion(current, restored, requestingUserID, version)
+	if err != nil {
+		log.Printf("Error recording rollback of place %s: %v", placeID, err)
+	}
+
+	if _, err := rdx.RdxDel("place:" + placeID); err != nil {
+		log.Printf("Cache deletion failed for place ID: %s. Error: %v", placeID, err)
+	}
+	if restored.Name != current.Name {
+		autocom.AddPlaceToAutocorrect(rdx.Conn, placeID, restored.Name)
+	}
+	go mq.Emit("place-edited", mq.Index{EntityType: "place", EntityId: placeID, Method: "PUT"})
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{"place": restored, "version": v})
+}
+
+// GetPlaceChangeLog is the admin view of place edits across the site,
+// filterable by ?user= and ?placeid=
+func GetPlaceChangeLog(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	filter := bson.M{"changes": bson.M{"$exists": true}}
+	if u := r.URL.Query().Get("user"); u != "" {
+		filter["updatedBy"] = u
+	}
+	if p := r.URL.Query().Get("placeid"); p != "" {
+		filter["placeId"] = p
+	}
+
+	cursor, err := db.PlaceVersionsCollection.Find(context.TODO(), filter, options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}}).
+		SetLimit(parseHistoryLimit(r)).
+		SetProjection(bson.M{"data": 0}))
+	if err != nil {
+		http.Error(w, "Failed to fetch change log", http.StatusInternalServerError)
+		return
+	}
+	versions := []structs.PlaceVersion{}
+	if err := cursor.All(context.TODO(), &versions); err != nil {
+		http.Error(w, "Failed to decode change log", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, versions)
+}
@@ -0,0 +1,127 @@
+package places
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/middleware"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PlaceHours is the response of the hours endpoints
+type PlaceHours struct {
+	PlaceID        string                  `json:"placeid"`
+	TimeZone       string                  `json:"timezone"`
+	LocalTime      string                  `json:"local_time"`
+	OperatingHours *structs.OperatingHours `json:"operating_hours"`
+	IsOpenNow      *bool                   `json:"is_open_now,omitempty"`
+	NextOpenAt     *time.Time              `json:"next_open_at,omitempty"`
+}
+
+func placeHours(p structs.Place) PlaceHours {
+	p.Localize()
+	return PlaceHours{
+		PlaceID:        p.PlaceID,
+		TimeZone:       structs.LoadZone(p.TimeZone).String(),
+		LocalTime:      p.LocalTime,
+		OperatingHours: p.OperatingHours,
+		IsOpenNow:      p.IsOpenNow,
+		NextOpenAt:     p.NextOpenAt,
+	}
+}
+
+// parseOperatingHours reads and validates hours sent as JSON
+func parseOperatingHours(data []byte) (*structs.OperatingHours, error) {
+	var hours structs.OperatingHours
+	if err := json.Unmarshal(data, &hours); err != nil {
+		return nil, fmt.Errorf("operating_hours must be JSON with weekly shifts and exceptions")
+	}
+	if err := hours.Validate(); err != nil {
+		return nil, fmt.Errorf("operating_hours: %v", err)
+	}
+	if hours.Weekly == nil {
+		hours.Weekly = map[string][]structs.Shift{}
+	}
+	return &hours, nil
+}
+
+// GetPlaceHours returns a place's hours and whether it is open now
+func GetPlaceHours(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": ps.ByName("placeid")})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, placeHours(place))
+}
+
+// SetPlaceHours replaces a place's weekly hours and exceptions. The body is
+// an OperatingHours object, e.g.
+//
+//	{"weekly": {"mon": [{"open": "11:30", "close": "14:30"}, {"open": "18:00", "close": "23:00"}]},
+//	 "exceptions": [{"date": "2025-12-25", "closed": true, "note": "Christmas"}]}
+//
+// Times are in the place's time zone.
+func SetPlaceHours(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Live(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found", http.StatusNotFound)
+		return
+	}
+	if !middleware.CanManagePlace(place, requestingUserID) {
+		http.Error(w, "You are not authorized to edit this place", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	hours, err := parseOperatingHours(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var updated structs.Place
+	err = db.PlacesCollection.FindOneAndUpdate(context.TODO(), bson.M{"placeid": placeID},
+		bson.M{"$set": bson.M{"operating_hours": hours, "updated_at": time.Now(), "updatedBy": requestingUserID}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err != nil {
+		http.Error(w, "Error updating place", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := RecordPlaceVersion(place, updated, requestingUserID, 0); err != nil {
+		log.Printf("Error recording version of place %s: %v", placeID, err)
+	}
+	if _, err := rdx.RdxDel("place:" + placeID); err != nil {
+		log.Printf("Cache deletion failed for place ID: %s. Error: %v", placeID, err)
+	}
+	go mq.Emit("place-edited", mq.Index{EntityType: "place", EntityId: placeID, Method: "PUT"})
+
+	utils.SendJSONResponse(w, http.StatusOK, placeHours(updated))
+}
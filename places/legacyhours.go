@@ -0,0 +1,188 @@
+package places
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"naevis/db"
+	"naevis/rdx"
+	"naevis/structs"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Places saved before structured hours kept them as free text lines under
+// "operatinghours", e.g. ["Mon-Fri 09:00-17:00", "Sat 10am-2pm", "Sun closed"],
+// and a stored "isopen" flag that nothing kept current
+const legacyHoursField = "operatinghours"
+
+var legacyDayNames = map[string]string{
+	"sun": "sun", "sunday": "sun",
+	"mon": "mon", "monday": "mon",
+	"tue": "tue", "tues": "tue", "tuesday": "tue",
+	"wed": "wed", "wednesday": "wed",
+	"thu": "thu", "thur": "thu", "thurs": "thu", "thursday": "thu",
+	"fri": "fri", "friday": "fri",
+	"sat": "sat", "saturday": "sat",
+}
+
+// legacyDays reads "mon", "mon-fri", "sat, sun" or "daily" as day keys
+func legacyDays(s string) ([]string, error) {
+	s = strings.Trim(strings.TrimSpace(s), ":")
+	switch s {
+	case "", "daily", "everyday", "every day", "all days":
+		return structs.Weekdays, nil
+	}
+	var days []string
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, ok := legacyDayNames[strings.TrimSpace(from)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", from)
+		}
+		if !isRange {
+			days = append(days, first)
+			continue
+		}
+		last, ok := legacyDayNames[strings.TrimSpace(to)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", to)
+		}
+		i := indexOfDay(first)
+		for {
+			days = append(days, structs.Weekdays[i])
+			if structs.Weekdays[i] == last {
+				break
+			}
+			i = (i + 1) % len(structs.Weekdays)
+		}
+	}
+	return days, nil
+}
+
+func indexOfDay(day string) int {
+	for i, d := range structs.Weekdays {
+		if d == day {
+			return i
+		}
+	}
+	return 0
+}
+
+// legacyClock reads "9", "09:30", "9am" or "9:30 pm" as "HH:MM"
+func legacyClock(s string) (string, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	pm := strings.HasSuffix(s, "pm")
+	am := strings.HasSuffix(s, "am")
+	if am || pm {
+		s = s[:len(s)-2]
+	}
+	var h, m int
+	if strings.Contains(s, ":") {
+		if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+			return "", fmt.Errorf("%q is not a time", s)
+		}
+	} else if _, err := fmt.Sscanf(s, "%d", &h); err != nil {
+		return "", fmt.Errorf("%q is not a time", s)
+	}
+	if am || pm {
+		if h < 1 || h > 12 {
+			return "", fmt.Errorf("%q is not a time", s)
+		}
+		h %= 12
+		if pm {
+			h += 12
+		}
+	}
+	return fmt.Sprintf("%02d:%02d", h, m), nil
+}
+
+// parseLegacyHours converts the old free text lines. A day listed as closed,
+// or not listed, has no shifts.
+func parseLegacyHours(lines []string) (*structs.OperatingHours, error) {
+	hours := &structs.OperatingHours{Weekly: map[string][]structs.Shift{}}
+	for _, line := range lines {
+		line = strings.ToLower(strings.NewReplacer("–", "-", "—", "-", " to ", "-").Replace(line))
+		cut := strings.IndexAny(line, "0123456789")
+		if i := strings.Index(line, "closed"); i >= 0 && (cut < 0 || i < cut) {
+			if _, err := legacyDays(line[:i]); err != nil {
+				return nil, fmt.Errorf("%q: %v", line, err)
+			}
+			continue
+		}
+		if cut < 0 {
+			return nil, fmt.Errorf("%q has no times", line)
+		}
+		days, err := legacyDays(line[:cut])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", line, err)
+		}
+		var shifts []structs.Shift
+		for _, span := range strings.FieldsFunc(line[cut:], func(r rune) bool { return r == ',' || r == '&' || r == ';' }) {
+			open, closing, ok := strings.Cut(span, "-")
+			if !ok {
+				return nil, fmt.Errorf("%q: %q is not open-close", line, span)
+			}
+			var shift structs.Shift
+			if shift.Open, err = legacyClock(open); err != nil {
+				return nil, fmt.Errorf("%q: %v", line, err)
+			}
+			if shift.Close, err = legacyClock(closing); err != nil {
+				return nil, fmt.Errorf("%q: %v", line, err)
+			}
+			shifts = append(shifts, shift)
+		}
+		for _, day := range days {
+			hours.Weekly[day] = append(hours.Weekly[day], shifts...)
+		}
+	}
+	if err := hours.Validate(); err != nil {
+		return nil, err
+	}
+	return hours, nil
+}
+
+// migrateLegacyHours moves hours stored under the old key into
+// operating_hours. Lines it cannot read are left in place and logged so an
+// owner can re-enter them through SetPlaceHours.
+func migrateLegacyHours(ctx context.Context) {
+	if _, err := db.PlacesCollection.UpdateMany(ctx, bson.M{"isopen": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"isopen": ""}}); err != nil {
+		log.Printf("Error removing stored isopen flags: %v", err)
+	}
+
+	cursor, err := db.PlacesCollection.Find(ctx, bson.M{legacyHoursField: bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"placeid": 1, legacyHoursField: 1, "operating_hours": 1}))
+	if err != nil {
+		log.Printf("Error finding places with legacy hours: %v", err)
+		return
+	}
+	var legacy []struct {
+		PlaceID string                  `bson:"placeid"`
+		Lines   []string                `bson:"operatinghours"`
+		Hours   *structs.OperatingHours `bson:"operating_hours"`
+	}
+	if err := cursor.All(ctx, &legacy); err != nil {
+		log.Printf("Error decoding places with legacy hours: %v", err)
+		return
+	}
+
+	for _, p := range legacy {
+		update := bson.M{"$unset": bson.M{legacyHoursField: ""}}
+		// Hours set through the new API win over the old text
+		if p.Hours == nil && len(p.Lines) > 0 {
+			hours, err := parseLegacyHours(p.Lines)
+			if err != nil {
+				log.Printf("Keeping legacy hours of place %s: %v", p.PlaceID, err)
+				continue
+			}
+			update["$set"] = bson.M{"operating_hours": hours}
+		}
+		if _, err := db.PlacesCollection.UpdateOne(ctx, bson.M{"placeid": p.PlaceID}, update); err != nil {
+			log.Printf("Error migrating hours of place %s: %v", p.PlaceID, err)
+			continue
+		}
+		rdx.RdxDel("place:" + p.PlaceID)
+	}
+}
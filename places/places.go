@@ -11,6 +11,7 @@ import (
 	"naevis/mq"
 	"naevis/rdx"
 	"naevis/structs"
+	"naevis/trash"
 	"naevis/userdata"
 	"naevis/utils"
 	"net/http"
@@ -36,7 +37,21 @@ func GetPlaces(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// 	return
 	// }
 
-	cursor, err := db.PlacesCollection.Find(context.TODO(), bson.M{})
+	// Facet parameters (see ParsePlaceFilter) narrow the list using the
+	// place indexes. ?open_now=true keeps places whose hours say they are
+	// open; places without hours are left out since their status is unknown.
+	pf, err := ParsePlaceFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	openNow := r.URL.Query().Get("open_now") == "true"
+	filter := pf.Filter()
+	if openNow {
+		filter["operating_hours"] = bson.M{"$exists": true}
+	}
+
+	cursor, err := db.PlacesCollection.Find(context.TODO(), filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -50,12 +65,22 @@ func GetPlaces(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	// Cache the result
-	placesJSON, _ := json.Marshal(places)
-	rdx.RdxSet("places", string(placesJSON))
+	if !openNow && pf.IsEmpty() {
+		placesJSON, _ := json.Marshal(places)
+		rdx.RdxSet("places", string(placesJSON))
+	}
 
 	if places == nil {
 		places = []structs.Place{}
 	}
+	open := places[:0]
+	for i := range places {
+		places[i].Localize()
+		if !openNow || (places[i].IsOpenNow != nil && *places[i].IsOpenNow) {
+			open = append(open, places[i])
+		}
+	}
+	places = open
 
 	// Encode and return places data
 	json.NewEncoder(w).Encode(places)
@@ -67,6 +92,7 @@ func GetPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Aggregation pipeline to fetch place along with related tickets, media, and merch
 	pipeline := mongo.Pipeline{
 		bson.D{{Key: "$match", Value: bson.D{{Key: "placeid", Value: id}}}},
+		trash.LiveStage(),
 	}
 
 	// Execute the aggregation query
@@ -95,6 +121,8 @@ func GetPlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	place.Localize()
+
 	// Encode the place as JSON and write to response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(place); err != nil {
@@ -108,6 +136,7 @@ func GetPlaceQ(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// Aggregation pipeline to fetch place along with related tickets, media, and merch
 	pipeline := mongo.Pipeline{
 		bson.D{{Key: "$match", Value: bson.D{{Key: "placeid", Value: id}}}},
+		trash.LiveStage(),
 	}
 
 	// Execute the aggregation query
@@ -136,6 +165,8 @@ func GetPlaceQ(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
+	place.Localize()
+
 	// Encode the place as JSON and write to response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(place); err != nil {
@@ -198,16 +229,48 @@ func parsePlaceFormData(_ http.ResponseWriter, r *http.Request) (structs.Place,
 		return structs.Place{}, fmt.Errorf("capacity must be a positive integer")
 	}
 
-	return structs.Place{
+	timeZone := r.FormValue("timezone")
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	if !structs.ValidTimeZone(timeZone) {
+		return structs.Place{}, fmt.Errorf("timezone must be an IANA time zone such as Europe/Berlin")
+	}
+
+	place := structs.Place{
 		Name:        name,
 		Address:     address,
 		Description: description,
 		Category:    category,
 		Capacity:    capacity,
+		TimeZone:    timeZone,
 		PlaceID:     utils.GenerateID(14),
 		CreatedAt:   time.Now(),
 		ReviewCount: 0,
-	}, nil
+	}
+
+	if r.FormValue("lat") != "" || r.FormValue("lng") != "" {
+		lat, lng, err := ParseCoordinates(r.FormValue("lat"), r.FormValue("lng"))
+		if err != nil {
+			return structs.Place{}, err
+		}
+		place.Location = structs.Coordinates{Latitude: lat, Longitude: lng}
+		place.Geo = structs.NewGeoPoint(lat, lng)
+	}
+
+	if v := r.FormValue("operating_hours"); v != "" {
+		hours, err := parseOperatingHours([]byte(v))
+		if err != nil {
+			return structs.Place{}, err
+		}
+		place.OperatingHours = hours
+	}
+
+	if _, err := applyFacetForm(r, &place); err != nil {
+		return structs.Place{}, err
+	}
+
+	return place, nil
 }
 
 // Sends a JSON response
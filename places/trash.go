@@ -0,0 +1,152 @@
+package places
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/mq"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/userdata"
+	"naevis/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var menuUploadPath = "./static/menupic"
+
+// RestorePlace brings a place back from the trash. Only the owner can
+// restore, within trash.Retention.
+func RestorePlace(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	requestingUserID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	var place structs.Place
+	if err := db.PlacesCollection.FindOne(context.TODO(), trash.Deleted(bson.M{"placeid": placeID})).Decode(&place); err != nil {
+		http.Error(w, "Place not found in trash", http.StatusNotFound)
+		return
+	}
+	if place.CreatedBy != requestingUserID {
+		http.Error(w, "Only the place's owner can restore it", http.StatusForbidden)
+		return
+	}
+	if trash.Expired(*place.DeletedAt) {
+		http.Error(w, "This place is past the restore window", http.StatusGone)
+		return
+	}
+
+	if _, err := db.PlacesCollection.UpdateOne(context.TODO(), bson.M{"placeid": placeID}, bson.M{"$unset": bson.M{trash.Field: ""}}); err != nil {
+		http.Error(w, "Failed to restore place", http.StatusInternalServerError)
+		return
+	}
+	rdx.RdxDel("place:" + placeID)
+
+	userdata.SetUserData("place", placeID, place.CreatedBy)
+	go mq.Emit("place-created", mq.Index{EntityType: "place", EntityId: placeID, Method: "POST"})
+
+	place.DeletedAt = nil
+	place.Localize()
+	utils.SendJSONResponse(w, http.StatusOK, place)
+}
+
+// purgePlaceData removes everything that hangs off a place: menus and their
+// categories, tickets, media, merch, history, check-ins, claims, bookable
+// resources, slots and booking policy, and uploaded files. Bookings and
+// table orders are kept as records.
+func purgePlaceData(placeID string) error {
+	cursor, err := db.MenuCollection.Find(context.TODO(), bson.M{"placeid": placeID})
+	if err != nil {
+		return err
+	}
+	var menus []structs.Menu
+	if err := cursor.All(context.TODO(), &menus); err != nil {
+		return err
+	}
+	for _, m := range menus {
+		if m.MenuPhoto != "" {
+			os.Remove(filepath.Join(menuUploadPath, filepath.Base(m.MenuPhoto)))
+			os.Remove(filepath.Join(menuUploadPath, "thumb", m.MenuID+".jpg"))
+		}
+	}
+
+	byEntity := bson.M{"entity_id": placeID, "entity_type": "place"}
+	deletes := []struct {
+		coll   *mongo.Collection
+		filter bson.M
+	}{
+		{db.MenuCollection, bson.M{"placeid": placeID}},
+		{db.MenuCategoriesCollection, bson.M{"placeid": placeID}},
+		{db.TicketsCollection, byEntity},
+		{db.MerchCollection, byEntity},
+		{db.MediaCollection, bson.M{"entityid": placeID, "entitytype": "place"}},
+		{db.PlaceVersionsCollection, bson.M{"placeId": placeID}},
+		{db.CheckInsCollection, bson.M{"placeId": placeID}},
+		{db.BookingResourcesCollection, bson.M{"placeid": placeID}},
+		{db.SlotTemplatesCollection, bson.M{"placeid": placeID}},
+		{db.SlotCollection, bson.M{"placeid": placeID}},
+		{db.BookingPoliciesCollection, bson.M{"placeid": placeID}},
+	}
+	for _, d := range deletes {
+		if _, err := d.coll.DeleteMany(context.TODO(), d.filter); err != nil {
+			return err
+		}
+	}
+
+	var claims []structs.PlaceClaim
+	cursor, err = db.PlaceClaimsCollection.Find(context.TODO(), bson.M{"placeid": placeID})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(context.TODO(), &claims); err != nil {
+		return err
+	}
+	for _, c := range claims {
+		os.RemoveAll(filepath.Join(claimEvidenceDir, c.ClaimID))
+	}
+	if _, err := db.PlaceClaimsCollection.DeleteMany(context.TODO(), bson.M{"placeid": placeID}); err != nil {
+		return err
+	}
+
+	os.Remove(filepath.Join(bannerDir, placeID+".jpg"))
+	os.Remove(filepath.Join(bannerDir, "thumb", placeID+".jpg"))
+	return nil
+}
+
+// PurgeDeletedPlaces permanently removes places trashed before cutoff
+// together with their related data
+func PurgeDeletedPlaces(cutoff time.Time) (int, error) {
+	cursor, err := db.PlacesCollection.Find(context.TODO(), bson.M{trash.Field: bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	var expired []structs.Place
+	if err := cursor.All(context.TODO(), &expired); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, place := range expired {
+		if err := purgePlaceData(place.PlaceID); err != nil {
+			log.Printf("Trash: error purging data of place %s: %v", place.PlaceID, err)
+			continue
+		}
+		if _, err := db.PlacesCollection.DeleteOne(context.TODO(), bson.M{"placeid": place.PlaceID}); err != nil {
+			log.Printf("Trash: error purging place %s: %v", place.PlaceID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
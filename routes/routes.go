@@ -4,6 +4,7 @@ import (
 	"naevis/activity"
 	"naevis/ads"
 	"naevis/agi"
+	"naevis/analytics"
 	"naevis/artists"
 	"naevis/auth"
 	"naevis/booking"
@@ -12,12 +13,15 @@ import (
 	"naevis/comments"
 	"naevis/events"
 	"naevis/feed"
+	"naevis/ical"
+	"naevis/importer"
 	"naevis/itinerary"
 	"naevis/maps"
 	"naevis/media"
 	"naevis/menu"
 	"naevis/merch"
 	"naevis/middleware"
+	"naevis/notifications"
 	"naevis/places"
 	"naevis/profile"
 	"naevis/ratelim"
@@ -26,7 +30,9 @@ import (
 	"naevis/settings"
 	"naevis/suggestions"
 	"naevis/tickets"
+	"naevis/trash"
 	"naevis/userdata"
+	"naevis/walkin"
 	"naevis/websock"
 	"net/http"
 	_ "net/http/pprof"
@@ -72,11 +78,32 @@ func AddAuthRoutes(router *httprouter.Router) {
 }
 
 func AddBookingRoutes(router *httprouter.Router) {
-	router.POST("/api/slots", ratelim.RateLimit(booking.AddSlot))
-	router.DELETE("/api/slots/:date/:time", ratelim.RateLimit(booking.DeleteSlot))
+	router.POST("/api/slots", ratelim.RateLimit(middleware.Authenticate(middleware.RequireAdmin(booking.AddSlot))))
+	router.DELETE("/api/slots/:date/:time", ratelim.RateLimit(middleware.Authenticate(middleware.RequireAdmin(booking.DeleteSlot))))
 	router.GET("/api/slots/:date", middleware.Authenticate(booking.GetSlotsByDate))
 	router.GET("/api/bookings/:date", ratelim.RateLimit(middleware.Authenticate(booking.GetBookingsByDate)))
 	router.POST("/api/bookings", ratelim.RateLimit(middleware.Authenticate(booking.CreateBooking)))
+
+	// Place resources, templates and slots; see package booking
+	router.GET("/api/places/place/:placeid/resources", booking.GetResources)
+	router.POST("/api/places/place/:placeid/resources", middleware.Authenticate(middleware.RequirePlaceManager(booking.CreateResource)))
+	router.PUT("/api/places/place/:placeid/resources/:resourceid", middleware.Authenticate(middleware.RequirePlaceManager(booking.UpdateResource)))
+	router.DELETE("/api/places/place/:placeid/resources/:resourceid", middleware.Authenticate(middleware.RequirePlaceManager(booking.DeleteResource)))
+	router.GET("/api/places/place/:placeid/resources/:resourceid/templates", middleware.Authenticate(middleware.RequirePlaceManager(booking.GetSlotTemplates)))
+	router.POST("/api/places/place/:placeid/resources/:resourceid/templates", middleware.Authenticate(middleware.RequirePlaceManager(booking.CreateSlotTemplate)))
+	router.DELETE("/api/places/place/:placeid/resources/:resourceid/templates/:templateid", middleware.Authenticate(middleware.RequirePlaceManager(booking.DeleteSlotTemplate)))
+	router.GET("/api/places/place/:placeid/slots", ratelim.RateLimit(booking.GetPlaceSlots))
+	router.POST("/api/places/place/:placeid/slots/generate", middleware.Authenticate(middleware.RequirePlaceManager(booking.GenerateSlots)))
+	router.DELETE("/api/places/place/:placeid/slots/:slotid", middleware.Authenticate(middleware.RequirePlaceManager(booking.DeletePlaceSlot)))
+	router.GET("/api/places/place/:placeid/bookings", middleware.Authenticate(middleware.RequirePlaceManager(booking.GetPlaceBookings)))
+	router.POST("/api/places/place/:placeid/bookings", ratelim.RateLimit(middleware.Authenticate(booking.BookPlaceSlot)))
+	router.POST("/api/places/place/:placeid/bookings/:bookingid/attendance", middleware.Authenticate(middleware.RequirePlaceManager(booking.MarkAttendance)))
+	router.GET("/api/places/place/:placeid/booking-policy", booking.GetBookingPolicy)
+	router.PUT("/api/places/place/:placeid/booking-policy", middleware.Authenticate(middleware.RequirePlaceManager(booking.SetBookingPolicy)))
+	router.GET("/api/places/place/:placeid/guests/:userid", middleware.Authenticate(middleware.RequirePlaceManager(booking.GetGuestHistory)))
+	router.GET("/api/places/bookings/me", middleware.Authenticate(booking.GetMyBookings))
+	router.POST("/api/places/bookings/:bookingid/cancel", ratelim.RateLimit(middleware.Authenticate(booking.CancelBooking)))
+	router.POST("/api/places/bookings/:bookingid/reschedule", ratelim.RateLimit(middleware.Authenticate(booking.RescheduleBooking)))
 }
 
 func AddEventsRoutes(router *httprouter.Router) {
@@ -84,18 +111,62 @@ func AddEventsRoutes(router *httprouter.Router) {
 	router.GET("/api/events/events/count", ratelim.RateLimit(events.GetEventsCount))
 	router.POST("/api/events/event", middleware.Authenticate(events.CreateEvent))
 	router.GET("/api/events/event/:eventid", events.GetEvent)
-	router.PUT("/api/events/event/:eventid", middleware.Authenticate(events.EditEvent))
-	router.DELETE("/api/events/event/:eventid", middleware.Authenticate(events.DeleteEvent))
-	router.POST("/api/events/event/:eventid/faqs", events.AddFAQs)
+	router.PUT("/api/events/event/:eventid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.EditEvent)))
+	router.DELETE("/api/events/event/:eventid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventDelete, events.DeleteEvent)))
+	router.POST("/api/events/event/:eventid/restore", middleware.Authenticate(events.RestoreEvent))
+	router.POST("/api/events/event/:eventid/faqs", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.AddFAQs)))
+
+	router.GET("/api/events/event/:eventid/questions", ratelim.RateLimit(events.GetEventQuestions))
+	router.POST("/api/events/event/:eventid/questions", ratelim.RateLimit(middleware.Authenticate(events.AskEventQuestion)))
+	router.DELETE("/api/events/event/:eventid/questions/:questionid", middleware.Authenticate(events.DeleteEventQuestion))
+	router.POST("/api/events/event/:eventid/questions/:questionid/upvote", ratelim.RateLimit(middleware.Authenticate(events.UpvoteEventQuestion)))
+	router.DELETE("/api/events/event/:eventid/questions/:questionid/upvote", ratelim.RateLimit(middleware.Authenticate(events.UpvoteEventQuestion)))
+	router.POST("/api/events/event/:eventid/questions/:questionid/answer", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.AnswerEventQuestion)))
+	router.POST("/api/events/event/:eventid/questions/:questionid/faq", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.PromoteEventQuestion)))
+	router.PUT("/api/events/event/:eventid/questions/:questionid/moderation", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.ModerateEventQuestion)))
+
+	router.GET("/api/events/event/:eventid/analytics", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermAnalytics, analytics.GetEventAnalytics)))
+
+	router.GET("/api/events/event/:eventid/schedule", ratelim.RateLimit(events.GetEventSchedule))
+	router.GET("/api/events/event/:eventid/schedule/export", ratelim.RateLimit(events.ExportSchedule))
+	router.GET("/api/events/event/:eventid/myschedule", middleware.Authenticate(events.GetMySchedule))
+	router.POST("/api/events/event/:eventid/stages", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.CreateStage)))
+	router.PUT("/api/events/event/:eventid/stages/:stageid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.EditStage)))
+	router.DELETE("/api/events/event/:eventid/stages/:stageid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.DeleteStage)))
+	router.POST("/api/events/event/:eventid/sessions", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.CreateSession)))
+	router.PUT("/api/events/event/:eventid/sessions/:sessionid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.EditSession)))
+	router.DELETE("/api/events/event/:eventid/sessions/:sessionid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.DeleteSession)))
+	router.POST("/api/events/event/:eventid/sessions/:sessionid/star", middleware.Authenticate(events.StarSession))
+	router.DELETE("/api/events/event/:eventid/sessions/:sessionid/star", middleware.Authenticate(events.StarSession))
+
+	router.POST("/api/events/event/:eventid/recurrence", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.SetEventRecurrence)))
+	router.GET("/api/events/event/:eventid/occurrences", ratelim.RateLimit(events.GetEventOccurrences))
+	router.PUT("/api/events/event/:eventid/occurrences/:occurrenceid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.EditEventOccurrence)))
+	router.DELETE("/api/events/event/:eventid/occurrences/:occurrenceid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.CancelEventOccurrence)))
+	router.GET("/api/events/event/:eventid/ics", ratelim.RateLimit(events.GetEventICS))
+	router.POST("/api/events/event/:eventid/status", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.ChangeEventStatus)))
+
+	router.POST("/api/events/event/:eventid/clone", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.CloneEvent)))
+	router.POST("/api/events/event/:eventid/template", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventEdit, events.SaveEventTemplate)))
+	router.GET("/api/events/templates", middleware.Authenticate(events.GetEventTemplates))
+	router.POST("/api/events/templates/:templateid/events", middleware.Authenticate(events.CreateEventFromTemplate))
+	router.DELETE("/api/events/templates/:templateid", middleware.Authenticate(events.DeleteEventTemplate))
+
+	router.GET("/api/events/event/:eventid/team", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermEventView, events.GetEventTeam)))
+	router.POST("/api/events/event/:eventid/team", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermTeamManage, events.InviteEventMember)))
+	router.PUT("/api/events/event/:eventid/team/:userid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermTeamManage, events.UpdateEventMember)))
+	router.DELETE("/api/events/event/:eventid/team/:userid", middleware.Authenticate(events.RemoveEventMember))
+	router.GET("/api/events/invites", middleware.Authenticate(events.GetMyEventInvites))
+	router.POST("/api/events/invites/:inviteid", middleware.Authenticate(events.RespondEventInvite))
 }
 
 func AddMerchRoutes(router *httprouter.Router) {
-	router.POST("/api/merch/:entityType/:eventid", middleware.Authenticate(merch.CreateMerch))
+	router.POST("/api/merch/:entityType/:eventid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermMerchManage, merch.CreateMerch)))
 	router.POST("/api/merch/:entityType/:eventid/:merchid/buy", ratelim.RateLimit(middleware.Authenticate(merch.BuyMerch)))
 	router.GET("/api/merch/:entityType/:eventid", merch.GetMerchs)
 	router.GET("/api/merch/:entityType/:eventid/:merchid", merch.GetMerch)
-	router.PUT("/api/merch/:entityType/:eventid/:merchid", middleware.Authenticate(merch.EditMerch))
-	router.DELETE("/api/merch/:entityType/:eventid/:merchid", middleware.Authenticate(merch.DeleteMerch))
+	router.PUT("/api/merch/:entityType/:eventid/:merchid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermMerchManage, merch.EditMerch)))
+	router.DELETE("/api/merch/:entityType/:eventid/:merchid", middleware.Authenticate(middleware.RequireEventPermission(middleware.PermMerchManage, merch.DeleteMerch)))
 
 	router.POST("/api/merch/:entityType/:eventid/:merchid/payment-session", middleware.Authenticate(merch.CreateMerchPaymentSession))
 	router.POST("/api/merch/:entityType/:eventid/:merchid/confirm-purchase", middleware.Authenticate(merch.ConfirmMerchPurchase))
@@ -103,13 +174,13 @@ func AddMerchRoutes(router *httprouter.Router) {
 }
 
 func AddTicketRoutes(router *httprouter.Router) {
-	router.POST("/api/ticket/event/:eventid", ratelim.RateLimit(middleware.Authenticate(tickets.CreateTicket)))
+	router.POST("/api/ticket/event/:eventid", ratelim.RateLimit(middleware.Authenticate(middleware.RequireEventPermission(middleware.PermTicketManage, tickets.CreateTicket))))
 	router.GET("/api/ticket/event/:eventid", ratelim.RateLimit(tickets.GetTickets))
 	router.GET("/api/ticket/event/:eventid/:ticketid", ratelim.RateLimit(tickets.GetTicket))
-	router.PUT("/api/ticket/event/:eventid/:ticketid", ratelim.RateLimit(middleware.Authenticate(tickets.EditTicket)))
-	router.DELETE("/api/ticket/event/:eventid/:ticketid", ratelim.RateLimit(middleware.Authenticate(tickets.DeleteTicket)))
+	router.PUT("/api/ticket/event/:eventid/:ticketid", ratelim.RateLimit(middleware.Authenticate(middleware.RequireEventPermission(middleware.PermTicketManage, tickets.EditTicket))))
+	router.DELETE("/api/ticket/event/:eventid/:ticketid", ratelim.RateLimit(middleware.Authenticate(middleware.RequireEventPermission(middleware.PermTicketManage, tickets.DeleteTicket))))
 	router.POST("/api/ticket/event/:eventid/:ticketid/buy", ratelim.RateLimit(middleware.Authenticate(tickets.BuyTicket)))
-	router.GET("/api/ticket/verify/:eventid", ratelim.RateLimit(tickets.VerifyTicket))
+	router.GET("/api/ticket/verify/:eventid", ratelim.RateLimit(middleware.Authenticate(middleware.RequireEventPermission(middleware.PermTicketScan, tickets.VerifyTicket))))
 	router.GET("/api/ticket/print/:eventid", ratelim.RateLimit(tickets.PrintTicket))
 
 	// router.POST("/api/ticket/confirm-purchase", middleware.Authenticate(ConfirmTicketPurchase))
@@ -141,11 +212,11 @@ func AddReviewsRoutes(router *httprouter.Router) {
 
 func AddMediaRoutes(router *httprouter.Router) {
 	// Set up routes with middlewares
-	router.POST("/api/media/:entitytype/:entityid", ratelim.RateLimit(middleware.Authenticate(media.AddMedia)))
+	router.POST("/api/media/:entitytype/:entityid", ratelim.RateLimit(middleware.Authenticate(middleware.RequireEventPermission(middleware.PermMediaManage, media.AddMedia))))
 	router.GET("/api/media/:entitytype/:entityid/:id", ratelim.RateLimit(media.GetMedia))
-	router.PUT("/api/media/:entitytype/:entityid/:id", ratelim.RateLimit(middleware.Authenticate(media.EditMedia)))
+	router.PUT("/api/media/:entitytype/:entityid/:id", ratelim.RateLimit(middleware.Authenticate(middleware.RequireEventPermission(middleware.PermMediaManage, media.EditMedia))))
 	router.GET("/api/media/:entitytype/:entityid", ratelim.RateLimit(media.GetMedias))
-	router.DELETE("/api/media/:entitytype/:entityid/:id", ratelim.RateLimit(middleware.Authenticate(media.DeleteMedia)))
+	router.DELETE("/api/media/:entitytype/:entityid/:id", ratelim.RateLimit(middleware.Authenticate(middleware.RequireEventPermission(middleware.PermMediaManage, media.DeleteMedia))))
 }
 
 func AddPlaceRoutes(router *httprouter.Router) {
@@ -153,18 +224,57 @@ func AddPlaceRoutes(router *httprouter.Router) {
 	router.POST("/api/places/place", middleware.Authenticate(places.CreatePlace))
 	router.GET("/api/places/place/:placeid", places.GetPlace)
 	router.GET("/api/places/place-details", places.GetPlaceQ)
+	router.GET("/api/places/nearby", ratelim.RateLimit(places.GetNearbyPlaces))
+	router.GET("/api/places/bbox", ratelim.RateLimit(places.GetPlacesInBBox))
+	router.GET("/api/places/discover", ratelim.RateLimit(places.DiscoverPlaces))
 	router.PUT("/api/places/place/:placeid", middleware.Authenticate(places.EditPlace))
 	router.DELETE("/api/places/place/:placeid", middleware.Authenticate(places.DeletePlace))
-
-	router.POST("/api/places/menu/:placeid", middleware.Authenticate(menu.CreateMenu))
+	router.POST("/api/places/place/:placeid/restore", middleware.Authenticate(places.RestorePlace))
+	router.POST("/api/places/place/:placeid/checkins", ratelim.RateLimit(middleware.Authenticate(places.CheckIn)))
+	router.GET("/api/places/place/:placeid/checkins", places.GetPlaceCheckIns)
+	router.GET("/api/places/place/:placeid/checkins/leaderboard", places.GetCheckInLeaderboard)
+	router.GET("/api/places/checkins/me", middleware.Authenticate(places.GetMyCheckIns))
+	router.GET("/api/places/place/:placeid/hours", places.GetPlaceHours)
+	router.PUT("/api/places/place/:placeid/hours", middleware.Authenticate(places.SetPlaceHours))
+	router.GET("/api/places/place/:placeid/history", middleware.Authenticate(places.GetPlaceHistory))
+	router.GET("/api/places/place/:placeid/history/:version", middleware.Authenticate(places.GetPlaceVersion))
+	router.POST("/api/places/place/:placeid/history/:version/rollback", middleware.Authenticate(places.RollbackPlace))
+	router.POST("/api/places/place/:placeid/claims", ratelim.RateLimit(middleware.Authenticate(places.ClaimPlace)))
+	router.GET("/api/places/claims/me", middleware.Authenticate(places.GetMyClaims))
+	router.POST("/api/places/place/:placeid/managers", middleware.Authenticate(places.AddPlaceManager))
+	router.DELETE("/api/places/place/:placeid/managers/:userid", middleware.Authenticate(places.RemovePlaceManager))
+	router.GET("/api/admin/places/claims", middleware.Authenticate(middleware.RequireAdmin(places.GetClaimQueue)))
+	router.GET("/api/admin/places/claims/:claimid/evidence/:file", middleware.Authenticate(middleware.RequireAdmin(places.GetClaimEvidence)))
+	router.POST("/api/admin/places/claims/:claimid/approve", middleware.Authenticate(middleware.RequireAdmin(places.ApproveClaim)))
+	router.POST("/api/admin/places/claims/:claimid/reject", middleware.Authenticate(middleware.RequireAdmin(places.RejectClaim)))
+	router.GET("/api/admin/places/history", middleware.Authenticate(middleware.RequireAdmin(places.GetPlaceChangeLog)))
+
+	router.POST("/api/places/menu/:placeid", middleware.Authenticate(middleware.RequirePlaceManager(menu.CreateMenu)))
 	router.GET("/api/places/menu/:placeid", menu.GetMenus)
 	router.GET("/api/places/menu/:placeid/:menuid", menu.GetMenu)
-	router.PUT("/api/places/menu/:placeid/:menuid", middleware.Authenticate(menu.EditMenu))
-	router.DELETE("/api/places/menu/:placeid/:menuid", middleware.Authenticate(menu.DeleteMenu))
+	router.PUT("/api/places/menu/:placeid/:menuid", middleware.Authenticate(middleware.RequirePlaceManager(menu.EditMenu)))
+	router.DELETE("/api/places/menu/:placeid/:menuid", middleware.Authenticate(middleware.RequirePlaceManager(menu.DeleteMenu)))
+	router.PUT("/api/places/menu/:placeid/:menuid/options", middleware.Authenticate(middleware.RequirePlaceManager(menu.SetMenuOptions)))
+	router.PUT("/api/places/menu/:placeid/:menuid/schedule", middleware.Authenticate(middleware.RequirePlaceManager(menu.SetMenuSchedule)))
+	router.PUT("/api/places/menu/:placeid/:menuid/86", middleware.Authenticate(middleware.RequirePlaceManager(menu.EightySix)))
+	router.DELETE("/api/places/menu/:placeid/:menuid/86", middleware.Authenticate(middleware.RequirePlaceManager(menu.UnEightySix)))
+	router.GET("/api/places/place/:placeid/menu", menu.GetPlaceMenu)
+	router.GET("/api/places/place/:placeid/menu/categories", menu.GetCategories)
+	router.POST("/api/places/place/:placeid/menu/categories", middleware.Authenticate(middleware.RequirePlaceManager(menu.CreateCategory)))
+	router.PUT("/api/places/place/:placeid/menu/categories/:categoryid", middleware.Authenticate(middleware.RequirePlaceManager(menu.UpdateCategory)))
+	router.DELETE("/api/places/place/:placeid/menu/categories/:categoryid", middleware.Authenticate(middleware.RequirePlaceManager(menu.DeleteCategory)))
 
 	router.POST("/api/places/menu/:placeid/:menuid/payment-session", middleware.Authenticate(menu.CreateMenuPaymentSession))
 	router.POST("/api/places/menu/:placeid/:menuid/confirm-purchase", middleware.Authenticate(menu.ConfirmMenuPurchase))
 
+	router.GET("/api/places/place/:placeid/table-qr", middleware.Authenticate(middleware.RequirePlaceManager(menu.GetTableQR)))
+	router.POST("/api/places/place/:placeid/orders", ratelim.RateLimit(middleware.Authenticate(menu.PlaceOrder)))
+	router.GET("/api/places/place/:placeid/orders", middleware.Authenticate(middleware.RequirePlaceManager(menu.GetOrders)))
+	router.GET("/api/places/place/:placeid/orders/:orderid", middleware.Authenticate(menu.GetOrder))
+	router.POST("/api/places/place/:placeid/orders/:orderid/status", middleware.Authenticate(middleware.RequirePlaceManager(menu.UpdateOrderStatus)))
+	router.POST("/api/places/place/:placeid/orders/:orderid/pay", middleware.Authenticate(menu.PayOrder))
+	router.GET("/api/places/place/:placeid/kitchen/ws", menu.KitchenWS)
+
 }
 
 func AddProfileRoutes(router *httprouter.Router) {
@@ -206,6 +316,7 @@ func AddArtistRoutes(router *httprouter.Router) {
 	router.POST("/api/artists/:id/events", artists.CreateArtistEvent)
 	router.PUT("/api/artists/:id/events", artists.UpdateArtistEvent)
 	router.DELETE("/api/artists/:id/events", artists.DeleteArtistEvent)
+	router.GET("/api/artists/:id/sessions", artists.GetArtistSessions)
 }
 
 func AddCartoonRoutes(router *httprouter.Router) {
@@ -238,14 +349,15 @@ func AddMapRoutes(router *httprouter.Router) {
 }
 
 func AddItineraryRoutes(router *httprouter.Router) {
-	router.GET("/api/itineraries", itinerary.GetItineraries)               //Fetch all itineraries
-	router.POST("/api/itineraries", itinerary.CreateItinerary)             //Create a new itinerary
-	router.GET("/api/itineraries/all/:id", itinerary.GetItinerary)         //Fetch a single itinerary
-	router.PUT("/api/itineraries/:id", itinerary.UpdateItinerary)          //Update an itinerary
-	router.DELETE("/api/itineraries/:id", itinerary.DeleteItinerary)       //Delete an itinerary
-	router.GET("/api/itineraries/search", itinerary.SearchItineraries)     //Search an itinerary
-	router.POST("/api/itineraries/:id/fork", itinerary.ForkItinerary)      //Fork a new itinerary
-	router.PUT("/api/itineraries/:id/publish", itinerary.PublishItinerary) //Publish an itinerary
+	router.GET("/api/itineraries", itinerary.GetItineraries)                 //Fetch all itineraries
+	router.POST("/api/itineraries", itinerary.CreateItinerary)               //Create a new itinerary
+	router.GET("/api/itineraries/all/:id", itinerary.GetItinerary)           //Fetch a single itinerary
+	router.PUT("/api/itineraries/:id", itinerary.UpdateItinerary)            //Update an itinerary
+	router.DELETE("/api/itineraries/:id", itinerary.DeleteItinerary)         //Delete an itinerary
+	router.GET("/api/itineraries/search", itinerary.SearchItineraries)       //Search an itinerary
+	router.POST("/api/itineraries/:id/fork", itinerary.ForkItinerary)        //Fork a new itinerary
+	router.PUT("/api/itineraries/:id/publish", itinerary.PublishItinerary)   //Publish an itinerary
+	router.GET("/api/itineraries/all/:id/ics", itinerary.ExportItineraryICS) //Export an itinerary as iCalendar
 }
 
 func AddFeedRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter) {
@@ -257,6 +369,7 @@ func AddFeedRoutes(router *httprouter.Router, rateLimiter *ratelim.RateLimiter)
 	router.POST("/api/feed/post", ratelim.RateLimit(middleware.Authenticate(feed.CreateTweetPost)))
 	router.PUT("/api/feed/post/:postid", middleware.Authenticate(feed.EditPost))
 	router.DELETE("/api/feed/post/:postid", middleware.Authenticate(feed.DeletePost))
+	router.POST("/api/feed/post/:postid/restore", middleware.Authenticate(feed.RestorePost))
 }
 
 func AddSettingsRoutes(router *httprouter.Router) {
@@ -280,6 +393,40 @@ func AddSearchRoutes(router *httprouter.Router) {
 	router.POST("/emitted", search.EventHandler)
 }
 
+func AddCalendarRoutes(router *httprouter.Router) {
+	router.POST("/api/calendar/token", ratelim.RateLimit(middleware.Authenticate(ical.CreateFeedToken)))
+	router.DELETE("/api/calendar/token", ratelim.RateLimit(middleware.Authenticate(ical.RevokeFeedToken)))
+	router.GET("/api/calendar/feed/:token", ratelim.RateLimit(ical.GetUserFeed))
+}
+
+func AddNotificationRoutes(router *httprouter.Router) {
+	router.GET("/api/notifications", ratelim.RateLimit(middleware.Authenticate(notifications.GetNotifications)))
+	router.PUT("/api/notifications/:id/read", ratelim.RateLimit(middleware.Authenticate(notifications.MarkNotificationRead)))
+}
+
+func AddImportRoutes(router *httprouter.Router) {
+	router.GET("/api/import/fields", importer.GetImportFields)
+	router.POST("/api/import/:kind", ratelim.RateLimit(middleware.Authenticate(importer.ImportListings)))
+}
+
+func AddWalkInRoutes(router *httprouter.Router) {
+	router.GET("/api/places/place/:placeid/walkin/status", ratelim.RateLimit(walkin.GetQueueStatus))
+	router.POST("/api/places/place/:placeid/walkin", ratelim.RateLimit(middleware.Authenticate(walkin.JoinQueue)))
+	router.GET("/api/places/place/:placeid/walkin/me", middleware.Authenticate(walkin.GetMyEntry))
+	router.DELETE("/api/places/place/:placeid/walkin/me", middleware.Authenticate(walkin.LeaveQueue))
+	router.GET("/api/places/place/:placeid/walkin/stream", middleware.Authenticate(walkin.Stream))
+	router.GET("/api/places/place/:placeid/walkin", middleware.Authenticate(middleware.RequirePlaceManager(walkin.GetQueue)))
+	router.GET("/api/places/place/:placeid/walkin/qr", middleware.Authenticate(middleware.RequirePlaceManager(walkin.GetDoorQR)))
+	router.PUT("/api/places/place/:placeid/walkin/settings", middleware.Authenticate(middleware.RequirePlaceManager(walkin.UpdateQueueSettings)))
+	router.POST("/api/places/place/:placeid/walkin/next", middleware.Authenticate(middleware.RequirePlaceManager(walkin.CallNext)))
+	router.POST("/api/places/place/:placeid/walkin/entries/:entryid/seat", middleware.Authenticate(middleware.RequirePlaceManager(walkin.SeatEntry)))
+	router.POST("/api/places/place/:placeid/walkin/entries/:entryid/skip", middleware.Authenticate(middleware.RequirePlaceManager(walkin.SkipEntry)))
+}
+
+func AddTrashRoutes(router *httprouter.Router) {
+	router.GET("/api/trash", middleware.Authenticate(trash.GetTrash))
+}
+
 func AddMiscRoutes(router *httprouter.Router) {
 	// Example Routes
 	// router.GET("/", ratelim.RateLimit(wrapHandler(proxyWithCircuitBreaker("frontend-service"))))
@@ -7,6 +7,8 @@ import (
 
 	"naevis/db"
 	"naevis/models"
+	"naevis/structs"
+	"naevis/trash"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -46,7 +48,7 @@ func GetResultsOfType(entityType string, query string) interface{} {
 		eventIDs, _ := GetIndexResults(entityType, query)
 		events := []models.Event{}
 		for _, id := range eventIDs {
-			filter := bson.M{"eventid": id}
+			filter := visibleEventFilter(id)
 			var ev models.Event
 			err := FetchAndDecode(entityType, filter, &ev)
 			if err != nil {
@@ -62,7 +64,7 @@ func GetResultsOfType(entityType string, query string) interface{} {
 		placeIDs, _ := GetIndexResults(entityType, query)
 		places := []models.Place{}
 		for _, id := range placeIDs {
-			filter := bson.M{"placeid": id}
+			filter := trash.Live(bson.M{"placeid": id})
 			var p models.Place
 			err := FetchAndDecode(entityType, filter, &p)
 			if err != nil {
@@ -78,7 +80,7 @@ func GetResultsOfType(entityType string, query string) interface{} {
 		eventIDs, _ := GetIndexResults("events", query)
 		events := []models.Event{}
 		for _, id := range eventIDs {
-			filter := bson.M{"eventid": id}
+			filter := visibleEventFilter(id)
 			var ev models.Event
 			err := FetchAndDecode("events", filter, &ev)
 			if err != nil {
@@ -91,7 +93,7 @@ func GetResultsOfType(entityType string, query string) interface{} {
 		placeIDs, _ := GetIndexResults("places", query)
 		places := []models.Place{}
 		for _, id := range placeIDs {
-			filter := bson.M{"placeid": id}
+			filter := trash.Live(bson.M{"placeid": id})
 			var p models.Place
 			err := FetchAndDecode("places", filter, &p)
 			if err != nil {
@@ -110,6 +112,16 @@ func GetResultsOfType(entityType string, query string) interface{} {
 	}
 }
 
+// visibleEventFilter matches an event only if it is public; drafts,
+// scheduled and trashed events stay out of search results even if they were
+// indexed.
+func visibleEventFilter(eventID string) bson.M {
+	return trash.Live(bson.M{
+		"eventid": eventID,
+		"status":  bson.M{"$nin": bson.A{structs.EventStatusDraft, structs.EventStatusScheduled}},
+	})
+}
+
 // FetchAndDecode retrieves a document from MongoDB and decodes it into the provided output struct.
 func FetchAndDecode(collectionName string, filter bson.M, out interface{}) error {
 	collection := db.Client.Database("eventdb").Collection(collectionName)
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"naevis/db"
 	"naevis/globals"
+	"naevis/middleware"
 	"naevis/mq"
+	"naevis/structs"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -97,6 +99,13 @@ func UpdateUserSetting(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
+	if settingType == "time_zone" {
+		if tz, ok := update.Value.(string); !ok || !structs.ValidTimeZone(tz) {
+			http.Error(w, "time_zone must be an IANA time zone such as Europe/Berlin", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Update MongoDB document
 	filter := bson.M{"userID": userID}
 	updateDoc := bson.M{"$set": bson.M{settingType: update.Value}}
@@ -122,6 +131,25 @@ func UpdateUserSetting(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	json.NewEncoder(w).Encode(response)
 }
 
+// DisplayTimeZone picks the zone times are shown in: an explicit ?tz= wins,
+// then the signed-in user's time_zone setting. "" means the event's own zone.
+func DisplayTimeZone(r *http.Request) string {
+	if tz := r.URL.Query().Get("tz"); structs.ValidTimeZone(tz) {
+		return tz
+	}
+	claims, err := middleware.ValidateJWT(r.Header.Get("Authorization"))
+	if err != nil {
+		return ""
+	}
+	var userSettings UserSettings
+	err = db.SettingsCollection.FindOne(context.TODO(), bson.M{"userID": claims.UserID},
+		options.FindOne().SetProjection(bson.M{"time_zone": 1})).Decode(&userSettings)
+	if err != nil || !structs.ValidTimeZone(userSettings.TimeZone) {
+		return ""
+	}
+	return userSettings.TimeZone
+}
+
 // Initialize user settings if they don't exist
 func InitUserSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	userID := r.Context().Value(globals.UserIDKey).(string)
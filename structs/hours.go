@@ -0,0 +1,161 @@
+package structs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Days of the week as used in OperatingHours.Weekly
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// How far ahead NextOpen looks before giving up, e.g. for a place closed for
+// the season with no hours entered after it
+const nextOpenHorizonDays = 400
+
+// Shift is one opening period as "HH:MM" wall-clock times. A close at or
+// before the open runs past midnight; "24:00" closes at the end of the day.
+type Shift struct {
+	Open  string `json:"open" bson:"open"`
+	Close string `json:"close" bson:"close"`
+}
+
+// HoursException replaces the weekly hours on one date, for holidays and
+// special events. Closed with no shifts means closed all day.
+type HoursException struct {
+	Date   string  `json:"date" bson:"date"` // YYYY-MM-DD in the place's zone
+	Closed bool    `json:"closed,omitempty" bson:"closed,omitempty"`
+	Shifts []Shift `json:"shifts,omitempty" bson:"shifts,omitempty"`
+	Note   string  `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// OperatingHours is a place's weekly schedule. Weekly is keyed by the day
+// names in Weekdays; a missing day is closed. Several shifts a day give split
+// hours, e.g. lunch and dinner.
+type OperatingHours struct {
+	Weekly     map[string][]Shift `json:"weekly" bson:"weekly"`
+	Exceptions []HoursException   `json:"exceptions,omitempty" bson:"exceptions,omitempty"`
+}
+
+type period struct{ start, end time.Time }
+
+// parseClock reads "HH:MM" as minutes after midnight
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("%q is not a valid time", s)
+	}
+	return h*60 + m, nil
+}
+
+func validateShifts(shifts []Shift) error {
+	for _, s := range shifts {
+		open, err := parseClock(s.Open)
+		if err != nil {
+			return err
+		}
+		if open == 24*60 {
+			return fmt.Errorf("a shift cannot open at 24:00")
+		}
+		if _, err := parseClock(s.Close); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks day names, times and exception dates
+func (h *OperatingHours) Validate() error {
+	known := map[string]bool{}
+	for _, d := range Weekdays {
+		known[d] = true
+	}
+	for day, shifts := range h.Weekly {
+		if !known[day] {
+			return fmt.Errorf("unknown day %q; use one of %v", day, Weekdays)
+		}
+		if err := validateShifts(shifts); err != nil {
+			return fmt.Errorf("%s: %v", day, err)
+		}
+	}
+	seen := map[string]bool{}
+	for _, ex := range h.Exceptions {
+		if _, err := time.Parse("2006-01-02", ex.Date); err != nil {
+			return fmt.Errorf("exception date %q is not YYYY-MM-DD", ex.Date)
+		}
+		if seen[ex.Date] {
+			return fmt.Errorf("more than one exception for %s", ex.Date)
+		}
+		seen[ex.Date] = true
+		if ex.Closed && len(ex.Shifts) > 0 {
+			return fmt.Errorf("%s: a closed day cannot have shifts", ex.Date)
+		}
+		if err := validateShifts(ex.Shifts); err != nil {
+			return fmt.Errorf("%s: %v", ex.Date, err)
+		}
+	}
+	return nil
+}
+
+// shiftsOn returns the shifts that start on the given local date
+func (h *OperatingHours) shiftsOn(date time.Time) []Shift {
+	key := date.Format("2006-01-02")
+	for _, ex := range h.Exceptions {
+		if ex.Date == key {
+			return ex.Shifts
+		}
+	}
+	return h.Weekly[Weekdays[date.Weekday()]]
+}
+
+// periodsOn returns the opening periods that start on the local date y-m-d
+func (h *OperatingHours) periodsOn(y int, m time.Month, d int, loc *time.Location) []period {
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	var periods []period
+	for _, s := range h.shiftsOn(midnight) {
+		opens, _ := parseClock(s.Open)
+		closes, _ := parseClock(s.Close)
+		if closes <= opens {
+			closes += 24 * 60
+		}
+		// time.Date normalises minutes past the day, which keeps DST days right
+		periods = append(periods, period{
+			start: time.Date(y, m, d, 0, opens, 0, 0, loc),
+			end:   time.Date(y, m, d, 0, closes, 0, 0, loc),
+		})
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].start.Before(periods[j].start) })
+	return periods
+}
+
+// IsOpenAt reports whether t falls in an opening period. Shifts from the day
+// before are checked too since they may run past midnight.
+func (h *OperatingHours) IsOpenAt(t time.Time, loc *time.Location) bool {
+	local := t.In(loc)
+	y, m, d := local.Date()
+	for offset := -1; offset <= 0; offset++ {
+		for _, p := range h.periodsOn(y, m, d+offset, loc) {
+			if !t.Before(p.start) && t.Before(p.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NextOpen returns the first opening after t, if there is one within about
+// a year
+func (h *OperatingHours) NextOpen(t time.Time, loc *time.Location) (time.Time, bool) {
+	y, m, d := t.In(loc).Date()
+	for offset := 0; offset <= nextOpenHorizonDays; offset++ {
+		for _, p := range h.periodsOn(y, m, d+offset, loc) {
+			if p.start.After(t) {
+				return p.start.UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
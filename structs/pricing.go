@@ -0,0 +1,13 @@
+package structs
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// FreeEventFilter matches events that cost nothing to attend. Ticket types
+// must have a price, so these are events without tickets, which have no
+// price range, and any whose cheapest ticket was stored at 0 before that.
+func FreeEventFilter() bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"min_price": 0},
+		bson.M{"min_price": bson.M{"$exists": false}},
+	}}
+}
@@ -0,0 +1,63 @@
+package structs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestFreeEventFilterMatches(t *testing.T) {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		uri = os.Getenv("MONGODB_URI")
+	}
+	if uri == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("MONGO_URI is not set; CI must provide a MongoDB for these tests")
+		}
+		t.Skip("MONGO_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+	database := client.Database(fmt.Sprintf("naevis_test_%d", time.Now().UnixNano()))
+	defer database.Drop(context.Background())
+	events := database.Collection("events")
+
+	if _, err := events.InsertMany(ctx, []any{
+		bson.M{"eventid": "no-tickets"},
+		bson.M{"eventid": "zero", "min_price": 0.0, "max_price": 0.0},
+		bson.M{"eventid": "paid", "min_price": 5.0, "max_price": 20.0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := events.Find(ctx, FreeEventFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []struct {
+		EventID string `bson:"eventid"`
+	}
+	if err := cursor.All(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, e := range got {
+		found[e.EventID] = true
+	}
+	if len(got) != 2 || !found["no-tickets"] || !found["zero"] {
+		t.Errorf("free events = %v, want no-tickets and zero", got)
+	}
+}
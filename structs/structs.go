@@ -99,6 +99,7 @@ type Post struct {
 	Likers      []primitive.ObjectID `json:"likers" bson:"likers"`
 	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
 	Resolutions []int                `json:"resolution" bson:"resolution"`
+	DeletedAt   *time.Time           `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"` // In the trash since; see package trash
 }
 
 type BlogPost struct {
@@ -280,9 +281,11 @@ type Place struct {
 	Country           string            `json:"country,omitempty" bson:"country,omitempty"`
 	ZipCode           string            `json:"zipCode,omitempty" bson:"zipCode,omitempty"`
 	Location          Coordinates       `json:"location,omitempty" bson:"location,omitempty"`
+	Geo               *GeoPoint         `json:"geo,omitempty" bson:"geo,omitempty"` // GeoJSON copy of Location for 2dsphere queries
 	Phone             string            `json:"phone,omitempty" bson:"phone,omitempty"`
 	Website           string            `json:"website,omitempty" bson:"website,omitempty"`
-	IsOpen            bool              `json:"isopen,omitempty" bson:"isopen,omitempty"`
+	IsOpenNow         *bool             `json:"is_open_now,omitempty" bson:"-"`  // Computed from OperatingHours per response
+	NextOpenAt        *time.Time        `json:"next_open_at,omitempty" bson:"-"` // Next opening while closed, per response
 	Distance          float64           `json:"distance,omitempty" bson:"distance,omitempty"`
 	Views             int               `json:"views,omitempty" bson:"views,omitempty"`
 	ReviewCount       int               `json:"reviewcount,omitempty" bson:"reviewcount,omitempty"`
@@ -290,9 +293,17 @@ type Place struct {
 	UpdatedBy         string            `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
 	DeletedAt         *time.Time        `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 	Amenities         []string          `json:"amenities,omitempty" bson:"amenities,omitempty"`
+	Wheelchair        bool              `json:"wheelchair,omitempty" bson:"wheelchair,omitempty"`   // Wheelchair accessible
+	PriceLevel        int               `json:"price_level,omitempty" bson:"price_level,omitempty"` // 1 (cheap) to 4 (expensive), 0 if unknown
 	Events            []string          `json:"events,omitempty" bson:"events,omitempty"`
-	OperatingHours    []string          `json:"operatinghours,omitempty" bson:"operatinghours,omitempty"`
+	OperatingHours    *OperatingHours   `json:"operating_hours,omitempty" bson:"operating_hours,omitempty"` // In the place's TimeZone
 	Keywords          []string          `json:"keywords,omitempty" bson:"keywords,omitempty"`
+	TimeZone          string            `json:"timezone,omitempty" bson:"timezone,omitempty"`       // IANA zone, e.g. "Asia/Kolkata"
+	LocalTime         string            `json:"local_time,omitempty" bson:"-"`                      // Current time at the place, filled per response
+	ExternalID        string            `json:"external_id,omitempty" bson:"external_id,omitempty"` // ID in the venue's own system, set by imports
+	Verified          bool              `json:"verified" bson:"verified,omitempty"`                 // Owned by the business, after an approved claim
+	VerifiedAt        *time.Time        `json:"verified_at,omitempty" bson:"verified_at,omitempty"`
+	Managers          []string          `json:"managers,omitempty" bson:"managers,omitempty"` // Users the owner lets edit the place
 }
 
 type PlaceStatus string
@@ -309,12 +320,40 @@ type Coordinates struct {
 }
 
 type CheckIn struct {
+	CheckInID string    `json:"checkinid" bson:"checkinid"`
 	UserID    string    `json:"userId,omitempty" bson:"userId,omitempty"`
 	PlaceID   string    `json:"placeId,omitempty" bson:"placeId,omitempty"`
 	Timestamp time.Time `json:"timestamp,omitempty" bson:"timestamp,omitempty"`
 	Comment   string    `json:"comment,omitempty" bson:"comment,omitempty"`
-	Rating    float64   `json:"rating,omitempty" bson:"rating,omitempty"` // Optional
-	Medias    []Media   `json:"images,omitempty" bson:"images,omitempty"` // Optional
+	Rating    float64   `json:"rating,omitempty" bson:"rating,omitempty"`     // Optional
+	Medias    []Media   `json:"images,omitempty" bson:"images,omitempty"`     // Optional
+	Distance  float64   `json:"distance,omitempty" bson:"distance,omitempty"` // Meters from the place when checking in
+	Bucket    int64     `json:"-" bson:"bucket,omitempty"`                    // Cooldown window number, unique per user and place
+	PlaceName string    `json:"placename,omitempty" bson:"-"`
+}
+
+// Place claim statuses
+const (
+	ClaimPending  = "pending"
+	ClaimApproved = "approved"
+	ClaimRejected = "rejected"
+)
+
+// PlaceClaim is a request by a business to take over a place listing
+type PlaceClaim struct {
+	ClaimID      string     `json:"claimid" bson:"claimid"`
+	PlaceID      string     `json:"placeid" bson:"placeid"`
+	UserID       string     `json:"userid" bson:"userid"`
+	Status       string     `json:"status" bson:"status"`
+	BusinessName string     `json:"business_name" bson:"business_name"`
+	ContactEmail string     `json:"contact_email,omitempty" bson:"contact_email,omitempty"`
+	ContactPhone string     `json:"contact_phone,omitempty" bson:"contact_phone,omitempty"`
+	Message      string     `json:"message,omitempty" bson:"message,omitempty"`
+	Evidence     []string   `json:"evidence" bson:"evidence"` // File names under the claim's evidence directory
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	ReviewedBy   string     `json:"reviewed_by,omitempty" bson:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty" bson:"reviewed_at,omitempty"`
+	ReviewNote   string     `json:"review_note,omitempty" bson:"review_note,omitempty"`
 }
 
 type PlaceVersion struct {
@@ -324,13 +363,8 @@ type PlaceVersion struct {
 	UpdatedAt time.Time         `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
 	UpdatedBy string            `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
 	Changes   map[string]string `json:"changes,omitempty" bson:"changes,omitempty"`
-}
-
-type OperatingHours struct {
-	Day          []string `json:"day,omitempty" bson:"day,omitempty"`
-	OpeningHours []string `json:"opening,omitempty" bson:"opening,omitempty"`
-	ClosingHours []string `json:"closing,omitempty" bson:"closing,omitempty"`
-	TimeZone     string   `json:"timeZone,omitempty" bson:"timeZone,omitempty"`
+	// Version a rollback restored, if this version is one
+	RestoredFrom int `json:"restoredFrom,omitempty" bson:"restoredFrom,omitempty"`
 }
 
 type Tag struct {
@@ -418,6 +452,142 @@ type Event struct {
 	AccessibilityInfo string            `json:"accessibility_info" bson:"accessibility_info"`
 	Artists           []string          `bson:"artists,omitempty" json:"artists,omitempty"` // ✅ Add this
 	Published         string            `bson:"published,omitempty" json:"published,omitempty"`
+	Recurrence        *Recurrence       `bson:"recurrence,omitempty" json:"recurrence,omitempty"`         // Set on the series master only
+	SeriesID          string            `bson:"seriesid,omitempty" json:"seriesid,omitempty"`             // Master EventID for materialized occurrences
+	Detached          bool              `bson:"detached,omitempty" json:"detached,omitempty"`             // Occurrence edited independently of its series
+	RecurrenceID      *time.Time        `bson:"recurrence_id,omitempty" json:"recurrence_id,omitempty"`   // Start the series rule gave an occurrence, kept when it is moved
+	PublishAt         *time.Time        `bson:"publish_at,omitempty" json:"publish_at,omitempty"`         // When a scheduled event goes live
+	PostponedFrom     *time.Time        `bson:"postponed_from,omitempty" json:"postponed_from,omitempty"` // Original start of a postponed event
+	StatusReason      string            `bson:"status_reason,omitempty" json:"status_reason,omitempty"`
+	StatusChangedAt   *time.Time        `bson:"status_changed_at,omitempty" json:"status_changed_at,omitempty"`
+	// Denormalized for listing filters and sorting
+	MinPrice    *float64    `bson:"min_price,omitempty" json:"min_price,omitempty"`
+	MaxPrice    *float64    `bson:"max_price,omitempty" json:"max_price,omitempty"`
+	TicketsSold int         `bson:"tickets_sold" json:"tickets_sold"`
+	Geo         *GeoPoint   `bson:"geo,omitempty" json:"geo,omitempty"`                 // Copied from the place for radius queries
+	TimeZone    string      `bson:"timezone,omitempty" json:"timezone,omitempty"`       // IANA zone, e.g. "Europe/Berlin"
+	Times       *EventTimes `bson:"-" json:"times,omitempty"`                           // Filled per response by Localize
+	ExternalID  string      `bson:"external_id,omitempty" json:"external_id,omitempty"` // ID in the organizer's own system, set by imports
+	DeletedAt   *time.Time  `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`     // In the trash since; see package trash
+}
+
+// Stage is a stage or room within an event's timetable
+type Stage struct {
+	StageID     string `json:"stageid" bson:"stageid"`
+	EventID     string `json:"eventid" bson:"eventid"`
+	Name        string `json:"name" bson:"name"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	Order       int    `json:"order" bson:"order"`
+}
+
+// Session is a timetable slot on a stage, optionally with artists
+type Session struct {
+	SessionID   string    `json:"sessionid" bson:"sessionid"`
+	EventID     string    `json:"eventid" bson:"eventid"`
+	StageID     string    `json:"stageid" bson:"stageid"`
+	Title       string    `json:"title" bson:"title"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Start       time.Time `json:"start" bson:"start"`
+	End         time.Time `json:"end" bson:"end"`
+	ArtistIDs   []string  `json:"artists" bson:"artists"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// ScheduleStar marks a session as part of a user's personal schedule
+type ScheduleStar struct {
+	UserID    string    `json:"userid" bson:"userid"`
+	EventID   string    `json:"eventid" bson:"eventid"`
+	SessionID string    `json:"sessionid" bson:"sessionid"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// EventQuestion is an attendee question in an event's Q&A
+type EventQuestion struct {
+	QuestionID string     `json:"questionid" bson:"questionid"`
+	EventID    string     `json:"eventid" bson:"eventid"`
+	UserID     string     `json:"userid" bson:"userid"`
+	Text       string     `json:"text" bson:"text"`
+	Upvotes    int        `json:"upvotes" bson:"upvotes"`
+	Upvoters   []string   `json:"-" bson:"upvoters"`
+	Upvoted    bool       `json:"upvoted" bson:"-"` // Whether the caller has upvoted
+	Answer     string     `json:"answer,omitempty" bson:"answer,omitempty"`
+	AnsweredBy string     `json:"answeredby,omitempty" bson:"answeredby,omitempty"`
+	AnsweredAt *time.Time `json:"answered_at,omitempty" bson:"answered_at,omitempty"`
+	InFAQ      bool       `json:"in_faq" bson:"in_faq"`
+	Status     string     `json:"status" bson:"status"` // "visible" or "hidden"
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+}
+
+// Event team roles. The event creator is always an owner.
+const (
+	EventRoleOwner     = "owner"
+	EventRoleManager   = "manager"
+	EventRoleBoxOffice = "box_office"
+	EventRoleScanner   = "scanner"
+	EventRoleViewer    = "viewer"
+)
+
+// EventMember is a user's role on an event team. Invitations are members
+// with status "pending" until accepted.
+type EventMember struct {
+	MemberID  string    `json:"memberid" bson:"memberid"`
+	EventID   string    `json:"eventid" bson:"eventid"`
+	UserID    string    `json:"userid" bson:"userid"`
+	Role      string    `json:"role" bson:"role"`
+	Status    string    `json:"status" bson:"status"` // "pending" or "accepted"
+	InvitedBy string    `json:"invitedby" bson:"invitedby"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// EventTemplate is a reusable snapshot of an event and its related documents
+type EventTemplate struct {
+	TemplateID string    `json:"templateid" bson:"templateid"`
+	Name       string    `json:"name" bson:"name"`
+	CreatorID  string    `json:"creatorid" bson:"creatorid"`
+	Event      Event     `json:"event" bson:"event"`
+	Tickets    []Ticket  `json:"tickets" bson:"tickets"`
+	Merch      []Merch   `json:"merch" bson:"merch"`
+	Media      []Media   `json:"media" bson:"media"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// GeoPoint is a GeoJSON point; Coordinates are [longitude, latitude]
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// NewGeoPoint builds a GeoJSON point from a latitude and longitude
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// LatLng returns the point's latitude and longitude
+func (g *GeoPoint) LatLng() (lat, lng float64, ok bool) {
+	if g == nil || len(g.Coordinates) != 2 {
+		return 0, 0, false
+	}
+	return g.Coordinates[1], g.Coordinates[0], true
+}
+
+// Event lifecycle states. Events created before the lifecycle existed carry
+// the legacy status "active", which is treated as published.
+const (
+	EventStatusDraft     = "draft"
+	EventStatusScheduled = "scheduled"
+	EventStatusPublished = "published"
+	EventStatusPostponed = "postponed"
+	EventStatusCancelled = "cancelled"
+	EventStatusCompleted = "completed"
+	EventStatusLegacy    = "active"
+)
+
+// Recurrence holds an RFC 5545 RRULE subset and its exception dates
+type Recurrence struct {
+	RRule   string      `json:"rrule" bson:"rrule"`
+	ExDates []time.Time `json:"exdates,omitempty" bson:"exdates,omitempty"`
 }
 
 // type FAQ struct {
@@ -438,6 +608,7 @@ type PurchasedTicket struct {
 	BuyerName    string
 	UniqueCode   string
 	PurchaseDate time.Time
+	Status       string `bson:"status,omitempty"` // "refund_pending" once the event is cancelled
 }
 
 type Gig struct {
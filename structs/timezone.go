@@ -0,0 +1,96 @@
+package structs
+
+import "time"
+
+// LocalTime is one instant given in UTC, in the zone of the event or place it
+// belongs to, and formatted for the viewer
+type LocalTime struct {
+	UTC     time.Time `json:"utc"`
+	Local   string    `json:"local"`   // RFC3339 in the event's time zone
+	Display string    `json:"display"` // Human readable in the viewer's time zone
+}
+
+// EventTimes is the localized schedule attached to event responses
+type EventTimes struct {
+	TimeZone        string     `json:"timezone"`
+	DisplayTimeZone string     `json:"display_timezone"`
+	Date            *LocalTime `json:"date,omitempty"`
+	Start           *LocalTime `json:"start,omitempty"`
+	End             *LocalTime `json:"end,omitempty"`
+}
+
+// DisplayTimeLayout is how times are formatted for people
+const DisplayTimeLayout = "Mon, 02 Jan 2006 15:04 MST"
+
+// LoadZone returns the named IANA zone, or UTC when the name is empty or unknown
+func LoadZone(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ValidTimeZone reports whether name is an IANA zone such as "Europe/Berlin"
+func ValidTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+func newLocalTime(t time.Time, zone, display *time.Location) *LocalTime {
+	if t.IsZero() {
+		return nil
+	}
+	return &LocalTime{
+		UTC:     t.UTC(),
+		Local:   t.In(zone).Format(time.RFC3339),
+		Display: t.In(display).Format(DisplayTimeLayout),
+	}
+}
+
+// Zone is the event's time zone, UTC for events created before zones existed
+func (e *Event) Zone() *time.Location {
+	return LoadZone(e.TimeZone)
+}
+
+// Localize fills in Times for a response. An empty displayTZ shows times in the
+// event's own zone.
+func (e *Event) Localize(displayTZ string) {
+	zone := e.Zone()
+	display := zone
+	if displayTZ != "" {
+		display = LoadZone(displayTZ)
+	}
+	e.Times = &EventTimes{
+		TimeZone:        zone.String(),
+		DisplayTimeZone: display.String(),
+		Date:            newLocalTime(e.Date, zone, display),
+		Start:           newLocalTime(e.StartDateTime, zone, display),
+		End:             newLocalTime(e.EndDateTime, zone, display),
+	}
+}
+
+// Localize fills in the place's current local time and, when it has
+// operating hours, whether it is open now and when it next opens
+func (p *Place) Localize() {
+	now := time.Now()
+	zone := LoadZone(p.TimeZone)
+	p.LocalTime = now.In(zone).Format(time.RFC3339)
+
+	if p.OperatingHours == nil {
+		return
+	}
+	open := p.OperatingHours.IsOpenAt(now, zone)
+	p.IsOpenNow = &open
+	if !open {
+		if next, ok := p.OperatingHours.NextOpen(now, zone); ok {
+			p.NextOpenAt = &next
+		}
+	}
+}
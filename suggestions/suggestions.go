@@ -7,6 +7,7 @@ import (
 	"naevis/autocom"
 	"naevis/db"
 	"naevis/globals"
+	"naevis/places"
 	"naevis/rdx"
 	"naevis/structs"
 	"net/http"
@@ -140,48 +141,34 @@ func SuggestionsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 	json.NewEncoder(w).Encode(suggestions)
 }
 
+// GetNearbyPlaces suggests places around lat/lng, or around ?place=<placeid>,
+// nearest first. See places.ParseNearbyQuery for radius, category and limit.
 func GetNearbyPlaces(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 
-	curplace := r.URL.Query().Get("place")
-	if len(curplace) != 14 {
-		fmt.Println("wronggg")
-	} else {
-		fmt.Println(curplace)
-	}
-	fmt.Println(r.URL.Query().Get("lng"))
-	fmt.Println(r.URL.Query().Get("lng"))
-
-	cursor, err := db.PlacesCollection.Find(context.TODO(), bson.M{})
+	nq, err := places.ParseNearbyQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer cursor.Close(context.TODO())
 
-	var places []structs.Place
-	if err = cursor.All(context.TODO(), &places); err != nil {
+	nearby, err := places.FindNearby(nq)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// If no places are found, return an empty array
-	if places == nil {
-		places = []structs.Place{}
-	}
-
 	// Create a slice of sanitized places
-	var sanitizedPlaces []map[string]any
-	for _, place := range places {
-		if place.PlaceID == curplace {
-			continue
-		}
+	sanitizedPlaces := []map[string]any{}
+	for _, place := range nearby {
 		sanitizedPlaces = append(sanitizedPlaces, map[string]any{
 			"placeid":     place.PlaceID,
 			"name":        place.Name,
 			"category":    place.Category,
 			"capacity":    place.Capacity,
 			"reviewCount": place.ReviewCount,
+			"distance":    place.Distance,
+			"geo":         place.Geo,
 		})
 	}
 
@@ -0,0 +1,58 @@
+package tickets
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RefreshEventPriceRange recomputes the cheapest and dearest ticket price stored
+// on the event, which the event listing filters on. Events without tickets
+// have no price range.
+func RefreshEventPriceRange(eventID string) {
+	ctx := context.TODO()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"eventid": eventID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"min": bson.M{"$min": "$price"},
+			"max": bson.M{"$max": "$price"},
+		}}},
+	}
+	cursor, err := db.TicketsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Error computing price range for event %s: %v", eventID, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var update bson.M
+	var res struct {
+		Min float64 `bson:"min"`
+		Max float64 `bson:"max"`
+	}
+	if cursor.Next(ctx) && cursor.Decode(&res) == nil {
+		update = bson.M{"$set": bson.M{"min_price": res.Min, "max_price": res.Max}}
+	} else {
+		update = bson.M{"$unset": bson.M{"min_price": "", "max_price": ""}}
+	}
+
+	if _, err := db.EventsCollection.UpdateOne(ctx, bson.M{"eventid": eventID}, update); err != nil {
+		log.Printf("Error saving price range for event %s: %v", eventID, err)
+	}
+}
+
+// recordTicketsSold bumps the event's sales counter used for popularity sorting
+func recordTicketsSold(eventID string, quantity int) {
+	_, err := db.EventsCollection.UpdateOne(context.TODO(),
+		bson.M{"eventid": eventID},
+		bson.M{"$inc": bson.M{"tickets_sold": quantity}},
+	)
+	if err != nil {
+		log.Printf("Error updating tickets sold for event %s: %v", eventID, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"naevis/analytics"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/mq"
@@ -168,6 +169,8 @@ func CreateTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		return
 	}
 
+	RefreshEventPriceRange(eventID)
+
 	m := mq.Index{EntityType: "ticket", EntityId: tick.TicketID, Method: "POST", ItemType: "event", ItemId: eventID}
 	go mq.Emit("ticket-created", m)
 
@@ -407,6 +410,10 @@ func EditTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	if _, ok := updateFields["price"]; ok {
+		RefreshEventPriceRange(eventID)
+	}
+
 	m := mq.Index{EntityType: "ticket", EntityId: tickID, Method: "PUT", ItemType: "event", ItemId: eventID}
 	go mq.Emit("ticket-edited", m)
 
@@ -441,6 +448,8 @@ func DeleteTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	})
 	// RdxDel("event:" + eventID + ":tickets") // Invalidate cache after deletion
 
+	RefreshEventPriceRange(eventID)
+
 	m := mq.Index{EntityType: "ticket", EntityId: tickID, Method: "DELETE", ItemType: "event", ItemId: eventID}
 	go mq.Emit("ticket-deleted", m)
 }
@@ -500,6 +509,9 @@ func BuyTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	recordTicketsSold(eventID, quantityRequested)
+	analytics.TrackPurchase(r, eventID, ticketID, quantityRequested, ticket.Price*float64(quantityRequested))
+
 	m := mq.Index{}
 	mq.Notify("ticket-bought", m)
 
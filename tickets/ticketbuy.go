@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"naevis/analytics"
 	"naevis/db"
 	"naevis/globals"
 	"naevis/mq"
 	"naevis/stripe"
 	"naevis/structs"
+	"naevis/trash"
 	"naevis/userdata"
 	"naevis/utils"
 	"net/http"
@@ -90,6 +92,8 @@ func CreateTicketPaymentSession(w http.ResponseWriter, r *http.Request, ps httpr
 		return
 	}
 
+	analytics.TrackCheckout(r, eventId, ticketId, body.Quantity)
+
 	// Respond with session details
 	response := map[string]any{
 		"success": true,
@@ -232,6 +236,15 @@ func buyxTicket(w http.ResponseWriter, r *http.Request, request TicketPurchaseRe
 		return
 	}
 
+	// Only live events sell tickets
+	onSale := trash.Live(bson.M{"eventid": eventID, "status": bson.M{"$nin": bson.A{
+		structs.EventStatusDraft, structs.EventStatusScheduled, structs.EventStatusCancelled, structs.EventStatusCompleted,
+	}}})
+	if err := db.EventsCollection.FindOne(context.TODO(), onSale).Err(); err != nil {
+		http.Error(w, "Tickets for this event are not on sale", http.StatusConflict)
+		return
+	}
+
 	var ticket structs.Ticket
 	err := db.TicketsCollection.FindOne(context.TODO(), bson.M{"eventid": eventID, "ticketid": ticketID}).Decode(&ticket)
 	if err != nil {
@@ -286,6 +299,8 @@ func buyxTicket(w http.ResponseWriter, r *http.Request, request TicketPurchaseRe
 	}
 
 	userdata.AddUserDataBatch(userDataDocs)
+	recordTicketsSold(eventID, quantityRequested)
+	analytics.TrackPurchase(r, eventID, ticketID, quantityRequested, ticket.Price*float64(quantityRequested))
 
 	mq.Notify("ticket-bought", mq.Index{})
 
@@ -0,0 +1,161 @@
+// Package trash holds the shared rules for soft-deleted places, events and
+// posts. Deleting one sets its deletedAt; reads skip it via Live, its owner
+// can restore it within Retention, and RunPurger removes it for good after.
+package trash
+
+import (
+	"context"
+	"log"
+	"naevis/db"
+	"naevis/globals"
+	"naevis/utils"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Retention is how long deleted items can be restored before they are purged
+const Retention = 30 * 24 * time.Hour
+
+// Field is the timestamp that marks a document as deleted
+const Field = "deletedAt"
+
+// Live narrows a filter to documents that are not in the trash
+func Live(filter bson.M) bson.M {
+	filter[Field] = nil
+	return filter
+}
+
+// LiveStage is a $match stage for aggregation pipelines
+func LiveStage() bson.D {
+	return bson.D{{Key: "$match", Value: bson.M{Field: nil}}}
+}
+
+// Deleted matches documents in the trash
+func Deleted(filter bson.M) bson.M {
+	filter[Field] = bson.M{"$ne": nil}
+	return filter
+}
+
+// Expired reports whether an item deleted at t is past the restore window
+func Expired(t time.Time) bool {
+	return time.Since(t) > Retention
+}
+
+// A Purger permanently removes items deleted before cutoff, along with the
+// data that hangs off them, and returns how many it removed
+type Purger func(cutoff time.Time) (int, error)
+
+// RunPurger runs each purger every interval. It never returns.
+func RunPurger(interval time.Duration, purgers map[string]Purger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().UTC().Add(-Retention)
+		for kind, purge := range purgers {
+			n, err := purge(cutoff)
+			if err != nil {
+				log.Printf("Trash: error purging %s: %v", kind, err)
+			}
+			if n > 0 {
+				log.Printf("Trash: purged %d %s", n, kind)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// Item is one entry in a user's trash
+type Item struct {
+	Type      string    `json:"type"` // "event", "place" or "feedpost"
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+type source struct {
+	kind       string
+	coll       *mongo.Collection
+	owner      string // field holding the owner's user ID
+	id         string
+	titleField string
+}
+
+func listDeleted(ctx context.Context, s source, userID string) ([]Item, error) {
+	cursor, err := s.coll.Find(ctx, Deleted(bson.M{s.owner: userID}),
+		options.Find().SetProjection(bson.M{s.id: 1, s.titleField: 1, Field: 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(docs))
+	for _, d := range docs {
+		deletedAt, ok := d[Field].(primitive.DateTime)
+		if !ok {
+			continue
+		}
+		id, _ := d[s.id].(string)
+		title, _ := d[s.titleField].(string)
+		items = append(items, Item{
+			Type:      s.kind,
+			ID:        id,
+			Title:     title,
+			DeletedAt: deletedAt.Time().UTC(),
+			PurgeAt:   deletedAt.Time().UTC().Add(Retention),
+		})
+	}
+	return items, nil
+}
+
+// GetTrash lists the caller's deleted events, places and posts, most
+// recently deleted first
+func GetTrash(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	userID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	sources := []source{
+		{kind: "event", coll: db.EventsCollection, owner: "creatorid", id: "eventid", titleField: "title"},
+		{kind: "place", coll: db.PlacesCollection, owner: "createdBy", id: "placeid", titleField: "name"},
+		{kind: "feedpost", coll: db.PostsCollection, owner: "userid", id: "postid", titleField: "text"},
+	}
+	items := []Item{}
+	for _, s := range sources {
+		found, err := listDeleted(r.Context(), s, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+			return
+		}
+		items = append(items, found...)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+
+	utils.SendJSONResponse(w, http.StatusOK, items)
+}
+
+// EnsureIndexes indexes deletedAt so the purge job and trash listing do not scan
+func EnsureIndexes() {
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: Field, Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{Field: bson.M{"$exists": true}}),
+	}
+	for _, coll := range []*mongo.Collection{db.EventsCollection, db.PlacesCollection, db.PostsCollection} {
+		if _, err := coll.Indexes().CreateOne(context.TODO(), model); err != nil {
+			log.Printf("Error creating trash index on %s: %v", coll.Name(), err)
+		}
+	}
+}
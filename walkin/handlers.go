@@ -0,0 +1,198 @@
+package walkin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"naevis/globals"
+	"naevis/notifications"
+	"naevis/utils"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// sendError maps queue errors to responses
+func sendError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotFound), errors.Is(err, errNoPlace):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errFinished), errors.Is(err, errEmpty), errors.Is(err, errClosed), errors.Is(err, errBusy):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errBadJoin), errors.Is(err, errBadSource):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("walk-in queue: %v", err)
+		http.Error(w, "Queue unavailable", http.StatusInternalServerError)
+	}
+}
+
+// GetQueueStatus tells anyone whether a place's queue is open, how many
+// parties are waiting and roughly how long a new party would wait
+func GetQueueStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	if _, err := livePlace(r.Context(), placeID); err != nil {
+		sendError(w, errNoPlace)
+		return
+	}
+	q, err := loadQueue(r.Context(), placeID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, map[string]any{
+		"placeid":      placeID,
+		"open":         q.Settings.Open,
+		"waiting":      len(q.Waiting),
+		"wait_minutes": q.Settings.estimate(len(q.Waiting) + 1),
+	})
+}
+
+// JoinQueue adds the caller's party to the queue, remotely or after
+// scanning the door QR code:
+//
+//	{"name": "Sam", "party": 2, "source": "door"}
+//
+// Guests already in the queue get their current entry back.
+func JoinQueue(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, ok := r.Context().Value(globals.UserIDKey).(string)
+	if !ok || userID == "" {
+		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Name   string `json:"name"`
+		Party  int    `json:"party"`
+		Source string `json:"source"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	e, created, err := join(r.Context(), ps.ByName("placeid"), userID, strings.TrimSpace(req.Name), req.Party, req.Source)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	utils.SendJSONResponse(w, status, e)
+}
+
+// GetMyEntry returns the caller's place in the queue and estimated wait
+func GetMyEntry(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	e, err := userEntry(r.Context(), ps.ByName("placeid"), userID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, e)
+}
+
+// LeaveQueue takes the caller's party out of the queue
+func LeaveQueue(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	e, err := userEntry(r.Context(), ps.ByName("placeid"), userID)
+	if err == nil {
+		e, err = finish(r.Context(), e.PlaceID, e.EntryID, StatusLeft)
+	}
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, e)
+}
+
+// GetQueue shows staff everyone waiting and everyone called but not seated
+func GetQueue(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, err := loadQueue(r.Context(), ps.ByName("placeid"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, q)
+}
+
+// CallNext calls the party that has waited longest and notifies them
+func CallNext(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	e, err := callNext(r.Context(), ps.ByName("placeid"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	go notifications.Send(e.UserID, "walkin-called", "It's your turn", fmt.Sprintf("Please come to the front, your party of %d is being called.", e.Party), "place", e.PlaceID)
+	utils.SendJSONResponse(w, http.StatusOK, e)
+}
+
+// SeatEntry marks a waiting or called party as seated
+func SeatEntry(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	staffFinish(w, r, ps, StatusSeated)
+}
+
+// SkipEntry takes a party that did not come forward out of the queue
+func SkipEntry(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	staffFinish(w, r, ps, StatusSkipped)
+}
+
+func staffFinish(w http.ResponseWriter, r *http.Request, ps httprouter.Params, status string) {
+	e, err := finish(r.Context(), ps.ByName("placeid"), ps.ByName("entryid"), status)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if status == StatusSkipped {
+		go notifications.Send(e.UserID, "walkin-skipped", "You missed your turn", "Your party was taken out of the queue. Join again if you are still nearby.", "place", e.PlaceID)
+	}
+	utils.SendJSONResponse(w, http.StatusOK, e)
+}
+
+// UpdateQueueSettings opens or closes the queue and optionally sets the
+// average minutes between calls used for estimates:
+//
+//	{"open": true, "avg_minutes": 12}
+func UpdateQueueSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req struct {
+		Open       bool    `json:"open"`
+		AvgMinutes float64 `json:"avg_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AvgMinutes < 0 || req.AvgMinutes > 240 {
+		http.Error(w, "avg_minutes must be between 0 and 240", http.StatusBadRequest)
+		return
+	}
+	placeID := ps.ByName("placeid")
+	if err := saveSettings(r.Context(), placeID, req.Open, req.AvgMinutes); err != nil {
+		sendError(w, err)
+		return
+	}
+	settings, err := loadSettings(r.Context(), placeID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, settings)
+}
+
+// GetDoorQR returns a PNG QR code for the place's door that opens the
+// join page
+func GetDoorQR(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	frontend := globals.FrontendURL()
+	if frontend == "" {
+		http.Error(w, "Frontend URL is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	link := frontend + "/place/" + ps.ByName("placeid") + "/walkin?source=door"
+	png, err := qrcode.Encode(link, qrcode.Medium, 512)
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
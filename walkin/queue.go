@@ -0,0 +1,429 @@
+package walkin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"naevis/db"
+	"naevis/rdx"
+	"naevis/structs"
+	"naevis/trash"
+	"naevis/utils"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// A place's queue lives in Redis under walkin:<placeid>:
+//
+//	:waiting   sorted set of waiting entry IDs, scored by join time
+//	:entries   hash of entry ID to the Entry as JSON
+//	:users     hash of user ID to their active entry ID
+//	:settings  hash with open, avg_minutes and last_called
+//
+// Entries are kept for a day after the queue last changed so guests can
+// still see how their visit ended. Every change is published on the
+// walkin:<placeid> channel; see Stream.
+
+// Entry statuses
+const (
+	StatusWaiting = "waiting"
+	StatusCalled  = "called"
+	StatusSeated  = "seated"
+	StatusSkipped = "skipped"
+	StatusLeft    = "left"
+)
+
+const (
+	// How long a queue's entries outlive its last change
+	entryTTL = 24 * time.Hour
+	// Estimated minutes per party until the place sets its own
+	defaultAvgMinutes = 10
+	// Gaps between calls longer than this are breaks, not service time
+	maxCallGap = time.Hour
+	maxParty   = 20
+)
+
+var (
+	errNotFound  = errors.New("not in the queue")
+	errFinished  = errors.New("this guest has already left the queue")
+	errEmpty     = errors.New("nobody is waiting")
+	errBusy      = errors.New("the queue is busy, try again")
+	errClosed    = errors.New("the queue is closed")
+	errNoPlace   = errors.New("place not found")
+	errBadJoin   = errors.New("name and a party size between 1 and 20 are required")
+	errBadSource = errors.New("source must be remote or door")
+)
+
+// Entry is one party in a place's queue
+type Entry struct {
+	EntryID     string     `json:"entryid"`
+	PlaceID     string     `json:"placeid"`
+	UserID      string     `json:"userid"`
+	Name        string     `json:"name"`
+	Party       int        `json:"party"`
+	Source      string     `json:"source"` // "remote" or "door" (scanned the QR)
+	Status      string     `json:"status"`
+	JoinedAt    time.Time  `json:"joined_at"`
+	CalledAt    *time.Time `json:"called_at,omitempty"`
+	DoneAt      *time.Time `json:"done_at,omitempty"`
+	Position    int        `json:"position,omitempty"`     // 1 is next, filled while waiting
+	WaitMinutes *int       `json:"wait_minutes,omitempty"` // Estimated, filled while waiting
+}
+
+// Settings control a place's queue. Queues are closed until a place opens
+// them. AvgMinutes is the time between calls used for wait estimates; it
+// starts from what the place sets and follows the actual pace of calls.
+type Settings struct {
+	Open       bool       `json:"open"`
+	AvgMinutes float64    `json:"avg_minutes"`
+	LastCalled *time.Time `json:"last_called,omitempty"`
+}
+
+// Queue is the staff view of a place's queue
+type Queue struct {
+	PlaceID  string   `json:"placeid"`
+	Settings Settings `json:"settings"`
+	Waiting  []Entry  `json:"waiting"`
+	Called   []Entry  `json:"called"`
+}
+
+func key(placeID, part string) string {
+	return "walkin:" + placeID + ":" + part
+}
+
+func channel(placeID string) string {
+	return "walkin:" + placeID
+}
+
+// livePlace checks the place exists and is not in the trash
+func livePlace(ctx context.Context, placeID string) (structs.Place, error) {
+	var place structs.Place
+	err := db.PlacesCollection.FindOne(ctx, trash.Live(bson.M{"placeid": placeID})).Decode(&place)
+	return place, err
+}
+
+func loadSettings(ctx context.Context, placeID string) (Settings, error) {
+	s := Settings{AvgMinutes: defaultAvgMinutes}
+	vals, err := rdx.Conn.HGetAll(ctx, key(placeID, "settings")).Result()
+	if err != nil {
+		return s, err
+	}
+	s.Open = vals["open"] == "1"
+	if v, err := strconv.ParseFloat(vals["avg_minutes"], 64); err == nil && v > 0 {
+		s.AvgMinutes = v
+	}
+	if v, err := strconv.ParseInt(vals["last_called"], 10, 64); err == nil {
+		at := time.Unix(v, 0).UTC()
+		s.LastCalled = &at
+	}
+	return s, nil
+}
+
+// estimate is the expected wait for the party at position, counting down
+// from the last call. At most one party's time counts down, since a long
+// pause means the next call is late, not that everyone moved up; a call
+// older than maxCallGap, e.g. from the day before, does not count at all.
+func (s Settings) estimate(position int) *int {
+	wait := float64(position) * s.AvgMinutes
+	if s.LastCalled != nil {
+		if since := time.Since(*s.LastCalled); since < maxCallGap {
+			wait -= math.Min(since.Minutes(), s.AvgMinutes)
+		}
+	}
+	n := int(math.Ceil(math.Max(wait, 0)))
+	return &n
+}
+
+func loadEntry(ctx context.Context, placeID, entryID string) (Entry, error) {
+	var e Entry
+	raw, err := rdx.Conn.HGet(ctx, key(placeID, "entries"), entryID).Result()
+	if err == redis.Nil {
+		return e, errNotFound
+	}
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal([]byte(raw), &e)
+	return e, err
+}
+
+// saveEntry stores the entry, refreshes the queue's expiry and tells
+// listeners the queue changed
+func saveEntry(ctx context.Context, e Entry) error {
+	_, err := rdx.Conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return queueEntry(ctx, pipe, e)
+	})
+	return err
+}
+
+// queueEntry adds the commands that store the entry to a transaction
+func queueEntry(ctx context.Context, pipe redis.Pipeliner, e Entry) error {
+	e.Position, e.WaitMinutes = 0, nil
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	pipe.HSet(ctx, key(e.PlaceID, "entries"), e.EntryID, raw)
+	switch e.Status {
+	case StatusWaiting:
+		pipe.ZAdd(ctx, key(e.PlaceID, "waiting"), redis.Z{Score: float64(e.JoinedAt.UnixMilli()), Member: e.EntryID})
+		pipe.HSet(ctx, key(e.PlaceID, "users"), e.UserID, e.EntryID)
+	case StatusCalled:
+		pipe.ZRem(ctx, key(e.PlaceID, "waiting"), e.EntryID)
+	default:
+		pipe.ZRem(ctx, key(e.PlaceID, "waiting"), e.EntryID)
+		pipe.HDel(ctx, key(e.PlaceID, "users"), e.UserID)
+	}
+	for _, part := range []string{"waiting", "entries", "users"} {
+		pipe.Expire(ctx, key(e.PlaceID, part), entryTTL)
+	}
+	pipe.Publish(ctx, channel(e.PlaceID), e.EntryID)
+	return nil
+}
+
+// How often a status change is retried when the queue changed under it
+const maxTxRetries = 20
+
+// transition changes an entry's status under WATCH on the queue's entries,
+// so two requests cannot both act on the same state: pick chooses the entry
+// from what is stored now and change applies the new status. If anything in
+// the queue changed meanwhile the whole step is retried.
+func transition(ctx context.Context, placeID string, pick func(tx *redis.Tx) (string, error), change func(*Entry) error) (Entry, error) {
+	var out Entry
+	txf := func(tx *redis.Tx) error {
+		entryID, err := pick(tx)
+		if err != nil {
+			return err
+		}
+		raw, err := tx.HGet(ctx, key(placeID, "entries"), entryID).Result()
+		if err == redis.Nil {
+			return errNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			return err
+		}
+		if err := change(&e); err != nil {
+			return err
+		}
+		if _, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return queueEntry(ctx, pipe, e)
+		}); err != nil {
+			return err
+		}
+		out = e
+		return nil
+	}
+
+	for range maxTxRetries {
+		err := rdx.Conn.Watch(ctx, txf, key(placeID, "entries"), key(placeID, "waiting"))
+		if err != redis.TxFailedErr {
+			return out, err
+		}
+	}
+	return out, errBusy
+}
+
+// withPosition fills a waiting entry's position and estimated wait
+func withPosition(ctx context.Context, e Entry) (Entry, error) {
+	if e.Status != StatusWaiting {
+		return e, nil
+	}
+	rank, err := rdx.Conn.ZRank(ctx, key(e.PlaceID, "waiting"), e.EntryID).Result()
+	if err == redis.Nil {
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+	settings, err := loadSettings(ctx, e.PlaceID)
+	if err != nil {
+		return e, err
+	}
+	e.Position = int(rank) + 1
+	e.WaitMinutes = settings.estimate(e.Position)
+	return e, nil
+}
+
+// userEntry finds the user's active entry in the place's queue
+func userEntry(ctx context.Context, placeID, userID string) (Entry, error) {
+	entryID, err := rdx.Conn.HGet(ctx, key(placeID, "users"), userID).Result()
+	if err == redis.Nil {
+		return Entry{}, errNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	e, err := loadEntry(ctx, placeID, entryID)
+	if err != nil {
+		return e, err
+	}
+	return withPosition(ctx, e)
+}
+
+// loadQueue reads the whole queue: waiting parties in order, then the ones
+// called and not yet seated
+func loadQueue(ctx context.Context, placeID string) (Queue, error) {
+	q := Queue{PlaceID: placeID, Waiting: []Entry{}, Called: []Entry{}}
+	var err error
+	if q.Settings, err = loadSettings(ctx, placeID); err != nil {
+		return q, err
+	}
+	order, err := rdx.Conn.ZRange(ctx, key(placeID, "waiting"), 0, -1).Result()
+	if err != nil {
+		return q, err
+	}
+	all, err := rdx.Conn.HGetAll(ctx, key(placeID, "entries")).Result()
+	if err != nil {
+		return q, err
+	}
+
+	for i, id := range order {
+		var e Entry
+		if json.Unmarshal([]byte(all[id]), &e) != nil {
+			continue
+		}
+		e.Position = i + 1
+		e.WaitMinutes = q.Settings.estimate(e.Position)
+		q.Waiting = append(q.Waiting, e)
+	}
+	for _, raw := range all {
+		var e Entry
+		if json.Unmarshal([]byte(raw), &e) == nil && e.Status == StatusCalled {
+			q.Called = append(q.Called, e)
+		}
+	}
+	sort.Slice(q.Called, func(i, j int) bool { return q.Called[i].CalledAt.Before(*q.Called[j].CalledAt) })
+	return q, nil
+}
+
+// join adds the user's party to the queue, or returns the entry they
+// already have
+func join(ctx context.Context, placeID, userID, name string, party int, source string) (Entry, bool, error) {
+	if name == "" || party < 1 || party > maxParty {
+		return Entry{}, false, errBadJoin
+	}
+	if source == "" {
+		source = "remote"
+	}
+	if source != "remote" && source != "door" {
+		return Entry{}, false, errBadSource
+	}
+	if _, err := livePlace(ctx, placeID); err != nil {
+		return Entry{}, false, errNoPlace
+	}
+	settings, err := loadSettings(ctx, placeID)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	if !settings.Open {
+		return Entry{}, false, errClosed
+	}
+
+	// One entry per guest: claim the user's slot first
+	e := Entry{
+		EntryID:  utils.GenerateID(10),
+		PlaceID:  placeID,
+		UserID:   userID,
+		Name:     name,
+		Party:    party,
+		Source:   source,
+		Status:   StatusWaiting,
+		JoinedAt: time.Now().UTC(),
+	}
+	claimed, err := rdx.Conn.HSetNX(ctx, key(placeID, "users"), userID, e.EntryID).Result()
+	if err != nil {
+		return Entry{}, false, err
+	}
+	if !claimed {
+		existing, err := userEntry(ctx, placeID, userID)
+		return existing, false, err
+	}
+	if err := saveEntry(ctx, e); err != nil {
+		rdx.Conn.HDel(ctx, key(placeID, "users"), userID)
+		return Entry{}, false, err
+	}
+	e, err = withPosition(ctx, e)
+	return e, true, err
+}
+
+// callNext calls the party that has waited longest
+func callNext(ctx context.Context, placeID string) (Entry, error) {
+	now := time.Now().UTC()
+	e, err := transition(ctx, placeID,
+		func(tx *redis.Tx) (string, error) {
+			first, err := tx.ZRange(ctx, key(placeID, "waiting"), 0, 0).Result()
+			if err != nil {
+				return "", err
+			}
+			if len(first) == 0 {
+				return "", errEmpty
+			}
+			return first[0], nil
+		},
+		func(e *Entry) error {
+			if e.Status != StatusWaiting {
+				return errFinished
+			}
+			e.Status, e.CalledAt = StatusCalled, &now
+			return nil
+		})
+	if err != nil {
+		return Entry{}, err
+	}
+	return e, recordCall(ctx, placeID, now)
+}
+
+// recordCall moves the average time between calls towards the latest gap
+func recordCall(ctx context.Context, placeID string, at time.Time) error {
+	settings, err := loadSettings(ctx, placeID)
+	if err != nil {
+		return err
+	}
+	fields := map[string]any{"last_called": at.Unix()}
+	if settings.LastCalled != nil {
+		if gap := at.Sub(*settings.LastCalled); gap < maxCallGap {
+			fields["avg_minutes"] = 0.8*settings.AvgMinutes + 0.2*gap.Minutes()
+		}
+	}
+	return rdx.Conn.HSet(ctx, key(placeID, "settings"), fields).Err()
+}
+
+// finish ends an entry that is waiting or has been called
+func finish(ctx context.Context, placeID, entryID, status string) (Entry, error) {
+	return transition(ctx, placeID,
+		func(*redis.Tx) (string, error) { return entryID, nil },
+		func(e *Entry) error {
+			if e.Status != StatusWaiting && e.Status != StatusCalled {
+				return errFinished
+			}
+			now := time.Now().UTC()
+			e.Status, e.DoneAt = status, &now
+			return nil
+		})
+}
+
+// saveSettings stores whether the queue is open and, if given, the average
+// minutes between calls, then tells listeners
+func saveSettings(ctx context.Context, placeID string, open bool, avgMinutes float64) error {
+	fields := map[string]any{"open": "0"}
+	if open {
+		fields["open"] = "1"
+	}
+	if avgMinutes > 0 {
+		fields["avg_minutes"] = avgMinutes
+	}
+	pipe := rdx.Conn.TxPipeline()
+	pipe.HSet(ctx, key(placeID, "settings"), fields)
+	pipe.Publish(ctx, channel(placeID), "settings")
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,101 @@
+package walkin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"naevis/globals"
+	"naevis/middleware"
+	"naevis/rdx"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// How often an idle stream sends a comment to keep proxies from closing it
+const keepAlive = 30 * time.Second
+
+// Stream sends server-sent events as the queue changes. Staff receive the
+// whole Queue; guests receive their own Entry with its position and
+// estimated wait, until they are seated, skipped or leave.
+//
+// Changes are published through Redis, so a stream hears about changes made
+// on any server.
+func Stream(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	placeID := ps.ByName("placeid")
+	userID, _ := r.Context().Value(globals.UserIDKey).(string)
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	staff, err := middleware.IsPlaceManager(placeID, userID)
+	if err != nil {
+		sendError(w, errNoPlace)
+		return
+	}
+
+	// Subscribe before the first read so no change is missed in between
+	pubsub := rdx.Conn.Subscribe(ctx, channel(placeID))
+	defer pubsub.Close()
+
+	// view returns what this caller sees and whether the stream is done
+	var view func(context.Context) (any, bool, error)
+	if staff {
+		view = func(ctx context.Context) (any, bool, error) {
+			q, err := loadQueue(ctx, placeID)
+			return q, false, err
+		}
+	} else {
+		mine, err := userEntry(ctx, placeID, userID)
+		if err != nil {
+			sendError(w, err)
+			return
+		}
+		view = func(ctx context.Context) (any, bool, error) {
+			e, err := loadEntry(ctx, placeID, mine.EntryID)
+			if err == nil {
+				e, err = withPosition(ctx, e)
+			}
+			return e, e.Status != StatusWaiting && e.Status != StatusCalled, err
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func() bool {
+		v, done, err := view(ctx)
+		if err != nil {
+			return false
+		}
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "event: queue\ndata: %s\n\n", data)
+		flusher.Flush()
+		return !done
+	}
+	if !send() {
+		return
+	}
+
+	updates := pubsub.Channel()
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok || !send() {
+				return
+			}
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}